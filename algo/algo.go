@@ -0,0 +1,246 @@
+// Package algo works large parent orders as a series of smaller child orders.
+//
+// An Executor is driven by events: feed it quotes, executions and timer ticks, e.g. from the callbacks of a
+// strategy, or let Run wire it to the streams of a listing. It places and cancels child orders through an api.Trader.
+package algo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//ErrNoPrice is reported when a child order can't be priced because the parent has no limit and there is no quote yet.
+var ErrNoPrice = errors.New("algo: no price for child order")
+
+//Errors returned for invalid arguments of the constructors and Run.
+var (
+	ErrInterval = errors.New("algo: interval must be positive")
+	ErrNoLimit  = errors.New("algo: iceberg needs a limit")
+	ErrDisplay  = errors.New("algo: iceberg display must be positive")
+)
+
+//Parent is the order to work.
+type Parent struct {
+	Direction api.OrderDirection
+	Quantity  int
+	//Limit is the worst price for child orders: the highest when buying, the lowest when selling. 0 means no limit.
+	Limit int
+	//Deadline is when the executor stops and cancels its open child orders, done or not.
+	Deadline time.Time
+}
+
+//Progress describes how far a parent order got. Prices are in cents.
+type Progress struct {
+	Quantity int     //quantity of the parent
+	Filled   int     //shares filled
+	Working  int     //shares in open child orders
+	AvgPrice float64 //average fill price, 0 before the first fill
+	Children int     //child orders placed
+	Done     bool    //the parent is filled or the deadline passed, no child orders are open
+	Err      error   //last error placing or cancelling a child order
+}
+
+//schedule decides how child orders are sized and priced.
+type schedule interface {
+	//target returns the quantity that should be filled or working by now.
+	target(x *Executor, now time.Time) int
+	//price returns the price of a new child order, 0 if there is none.
+	price(x *Executor) int
+	//due returns true if the working child orders should be replaced to meet the target.
+	due(x *Executor, now time.Time) bool
+}
+
+//Executor works a parent order. It is not safe for concurrent use; call its methods from one goroutine, as the
+//callbacks of a strategy are.
+//
+//The clock of an Executor is the time passed to OnTimer. Fills are worked at the time of the last tick, so the clock of
+//the exchange never mixes with it.
+type Executor struct {
+	t        api.Trader
+	p        Parent
+	s        schedule
+	started  time.Time
+	now      time.Time //time of the last tick
+	last     time.Time //time of the last slice
+	quote    api.Quote
+	tape     tape
+	children map[int]api.Order //latest known state of every child order by ID
+	order    []int             //IDs of the child orders in the order they were placed
+	done     bool
+	err      error
+	progress []func(Progress)
+}
+
+func newExecutor(t api.Trader, p Parent, s schedule) *Executor {
+	return &Executor{t: t, p: p, s: s, children: map[int]api.Order{}}
+}
+
+//OnProgress registers f to be called with the progress after every change.
+func (x *Executor) OnProgress(f func(Progress)) {
+	x.progress = append(x.progress, f)
+}
+
+//Progress returns the current progress.
+func (x *Executor) Progress() Progress {
+	v := Progress{Quantity: x.p.Quantity, Children: len(x.order), Done: x.done, Err: x.err}
+	notional := 0
+	for _, o := range x.children {
+		v.Filled += o.TotalFilled
+		if o.Open {
+			v.Working += o.Quantity
+		}
+		for _, f := range o.Fills {
+			notional += f.Price * f.Quantity
+		}
+	}
+	if v.Filled > 0 {
+		v.AvgPrice = float64(notional) / float64(v.Filled)
+	}
+	return v
+}
+
+//Done returns true once the parent is filled or the deadline passed and no child orders are open.
+func (x *Executor) Done() bool {
+	return x.done
+}
+
+func (x *Executor) notify() {
+	if len(x.progress) == 0 {
+		return
+	}
+	v := x.Progress()
+	for _, f := range x.progress {
+		f(v)
+	}
+}
+
+//OnQuote updates the market the child orders get priced from and the tape volume VWAP follows.
+func (x *Executor) OnQuote(ctx context.Context, q api.Quote) {
+	if q.Symbol != x.t.Symbol() || q.Venue != x.t.Venue() {
+		return
+	}
+	x.quote = q
+	x.tape.add(q, x.started)
+}
+
+//OnExecution books a fill of a child order and works the parent at the time of the last tick, if there was one.
+//Executions of other orders are ignored.
+func (x *Executor) OnExecution(ctx context.Context, e api.Execution) {
+	if x.update(e.Order) {
+		x.notify()
+		if !x.now.IsZero() {
+			x.work(ctx, x.now)
+		}
+	}
+}
+
+//OnTimer works the parent: it places, replaces or cancels child orders as the schedule demands.
+func (x *Executor) OnTimer(ctx context.Context, now time.Time) {
+	if now.After(x.now) {
+		x.now = now
+	}
+	x.work(ctx, x.now)
+}
+
+//update stores the state of a child order if it is newer than the known one. It returns false for other orders.
+func (x *Executor) update(o api.Order) bool {
+	old, ok := x.children[o.ID]
+	if !ok || o.Account != old.Account || o.Venue != old.Venue {
+		return false
+	}
+	if o.TotalFilled > old.TotalFilled || o.TotalFilled == old.TotalFilled && old.Open && !o.Open {
+		x.children[o.ID] = o
+	}
+	return true
+}
+
+func (x *Executor) work(ctx context.Context, now time.Time) {
+	if x.done {
+		return
+	}
+	if x.started.IsZero() {
+		x.started = now
+	}
+	v := x.Progress()
+	if v.Filled >= x.p.Quantity || !now.Before(x.p.Deadline) {
+		x.cancelAll(ctx)
+		if x.Progress().Working == 0 {
+			x.done = true
+			x.notify()
+		}
+		return
+	}
+	if !x.s.due(x, now) {
+		return
+	}
+	x.last = now
+
+	//replace what is still working; children that can't be cancelled count against the target
+	if v.Working > 0 {
+		x.cancelAll(ctx)
+		v = x.Progress()
+	}
+	want := x.s.target(x, now)
+	if want > x.p.Quantity {
+		want = x.p.Quantity
+	}
+	want -= v.Filled + v.Working
+	if want <= 0 {
+		x.notify()
+		return
+	}
+
+	price := x.s.price(x)
+	if price == 0 {
+		x.err = ErrNoPrice
+		x.notify()
+		return
+	}
+	o, err := x.t.NewOrderCtx(ctx, price, want, x.p.Direction, api.Limit)
+	if err != nil {
+		x.err = err
+	} else {
+		x.children[o.ID] = o
+		x.order = append(x.order, o.ID)
+	}
+	x.notify()
+}
+
+//cancelAll cancels all open child orders.
+func (x *Executor) cancelAll(ctx context.Context) {
+	for _, id := range x.order {
+		if !x.children[id].Open {
+			continue
+		}
+		o, err := x.t.CancelOrderCtx(ctx, id)
+		if err != nil {
+			x.err = err
+			continue
+		}
+		x.update(o)
+	}
+}
+
+//marketable returns the price that takes the best opposite quote, capped by the limit.
+//Without an opposite quote the child rests at the limit.
+func (x *Executor) marketable() int {
+	price := x.quote.Ask
+	if x.p.Direction == api.Sell {
+		price = x.quote.Bid
+	}
+	if price == 0 || x.p.Limit > 0 && worse(price, x.p.Limit, x.p.Direction) {
+		return x.p.Limit
+	}
+	return price
+}
+
+//worse returns true if a is a worse price than b for direction.
+func worse(a, b int, direction api.OrderDirection) bool {
+	if direction == api.Buy {
+		return a > b
+	}
+	return a < b
+}
@@ -0,0 +1,98 @@
+package algo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ianberinger/stockfighter/algo"
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//trader books orders without trading them.
+type trader struct {
+	orders  []api.Order
+	cancels int
+}
+
+func (t *trader) Venue() string  { return "TESTEX" }
+func (t *trader) Symbol() string { return "FOOBAR" }
+
+func (t *trader) NewOrderCtx(ctx context.Context, price, quantity int, direction api.OrderDirection, orderType api.OrderType) (api.Order, error) {
+	o := api.Order{ID: len(t.orders), Price: price, OriginalQuantity: quantity, Quantity: quantity, Direction: direction, OrderType: orderType, Open: true}
+	t.orders = append(t.orders, o)
+	return o, nil
+}
+
+func (t *trader) CancelOrderCtx(ctx context.Context, id int) (api.Order, error) {
+	t.cancels++
+	t.orders[id].Open = false
+	return t.orders[id], nil
+}
+
+func (t *trader) OrderStatusCtx(ctx context.Context, id int) (api.Order, error) {
+	return t.orders[id], nil
+}
+
+//fill fills n shares of order id at its price.
+func (t *trader) fill(id, n int, at time.Time) api.Execution {
+	o := &t.orders[id]
+	o.Quantity -= n
+	o.TotalFilled += n
+	o.Fills = append(o.Fills, api.Fill{Price: o.Price, Quantity: n, TS: at})
+	o.Open = o.Quantity > 0
+	return api.Execution{Order: *o, Price: o.Price, Filled: n, FilledAt: at}
+}
+
+func TestSkewedExecution(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)
+	tr := &trader{}
+	x, err := algo.NewTWAP(tr, algo.Parent{Direction: api.Buy, Quantity: 100, Limit: 101, Deadline: start.Add(10 * time.Second)}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x.OnTimer(ctx, start)
+	if v := x.Progress(); v.Children != 1 || v.Working != 10 {
+		t.Fatalf("first slice %+v", v)
+	}
+	//the exchange clock is an hour ahead, which must neither end the parent nor move its schedule
+	x.OnExecution(ctx, tr.fill(0, 4, start.Add(time.Hour)))
+	if v := x.Progress(); v.Done || v.Filled != 4 || v.Working != 6 || tr.cancels != 0 {
+		t.Fatalf("after fill %+v, %d cancels", v, tr.cancels)
+	}
+	x.OnTimer(ctx, start.Add(time.Second))
+	if v := x.Progress(); v.Children != 2 || v.Filled != 4 || v.Working != 16 {
+		t.Fatalf("second slice %+v", v)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	tr := &trader{}
+	p := algo.Parent{Direction: api.Buy, Quantity: 100, Limit: 101, Deadline: time.Now().Add(time.Minute)}
+	if _, err := algo.NewTWAP(tr, p, 0); err != algo.ErrInterval {
+		t.Error("twap:", err)
+	}
+	if _, err := algo.NewVWAP(tr, p, -time.Second, time.Second); err != algo.ErrInterval {
+		t.Error("vwap:", err)
+	}
+	if _, err := algo.NewIceberg(tr, p, 0); err != algo.ErrDisplay {
+		t.Error("iceberg display:", err)
+	}
+	p.Limit = 0
+	if _, err := algo.NewIceberg(tr, p, 10); err != algo.ErrNoLimit {
+		t.Error("iceberg limit:", err)
+	}
+
+	x, err := algo.NewTWAP(tr, p, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := algo.Run(context.Background(), nil, x, 0); err != algo.ErrInterval {
+		t.Error("run:", err)
+	}
+	if len(tr.orders) != 0 {
+		t.Error("orders placed", tr.orders)
+	}
+}
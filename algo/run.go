@@ -0,0 +1,50 @@
+package algo
+
+import (
+	"context"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//Run drives x with the quotes and executions of l and a timer ticking every tick until x is done or ctx is done.
+//x has to trade the stock of l. When ctx is done first, the open child orders are cancelled (for at most 5 seconds)
+//and ctx.Err() is returned along with the progress. A tick <= 0 returns ErrInterval.
+func Run(ctx context.Context, l *api.Listing, x *Executor, tick time.Duration) (Progress, error) {
+	if tick <= 0 {
+		return x.Progress(), ErrInterval
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	qs, es := l.QuotesCtx(ctx), l.ExecutionsCtx(ctx)
+	quotes, executions := qs.Values, es.Values
+	t := time.NewTicker(tick)
+	defer t.Stop()
+
+	x.OnTimer(ctx, time.Now())
+	for !x.Done() {
+		select {
+		case q, ok := <-quotes:
+			if !ok {
+				quotes = nil
+				continue
+			}
+			x.OnQuote(ctx, q)
+		case e, ok := <-executions:
+			if !ok {
+				executions = nil
+				continue
+			}
+			x.OnExecution(ctx, e)
+		case now := <-t.C:
+			x.OnTimer(ctx, now)
+		case <-ctx.Done():
+			cctx, ccancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer ccancel()
+			x.cancelAll(cctx)
+			x.notify()
+			return x.Progress(), ctx.Err()
+		}
+	}
+	return x.Progress(), nil
+}
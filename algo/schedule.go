@@ -0,0 +1,162 @@
+package algo
+
+import (
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//NewTWAP returns an Executor that spreads p evenly over the time until its deadline. Every interval it replaces the
+//open child order with one that brings the parent to its share of the time, priced to take the best opposite quote.
+//It returns ErrInterval for an interval <= 0.
+func NewTWAP(t api.Trader, p Parent, interval time.Duration) (*Executor, error) {
+	if interval <= 0 {
+		return nil, ErrInterval
+	}
+	return newExecutor(t, p, &twap{interval}), nil
+}
+
+type twap struct {
+	interval time.Duration
+}
+
+//slice returns the number of the slice t falls into. Slices start every interval from the first tick, so late
+//ticks don't shift the following slices.
+func (s *twap) slice(x *Executor, t time.Time) int64 {
+	return int64(t.Sub(x.started) / s.interval)
+}
+
+func (s *twap) due(x *Executor, now time.Time) bool {
+	return x.last.IsZero() || s.slice(x, now) > s.slice(x, x.last)
+}
+
+//target aims for the end of the current slice, so the last slice completes the parent before the deadline.
+func (s *twap) target(x *Executor, now time.Time) int {
+	total := x.p.Deadline.Sub(x.started)
+	elapsed := time.Duration(s.slice(x, now)+1) * s.interval
+	if total <= 0 || elapsed >= total {
+		return x.p.Quantity
+	}
+	return int(int64(x.p.Quantity) * int64(elapsed) / int64(total))
+}
+
+func (s *twap) price(x *Executor) int {
+	return x.marketable()
+}
+
+//NewVWAP returns an Executor that trades in step with the tape. Every interval it aims for the share of p that the
+//volume traded since the first tick is of the volume expected until the deadline, which is extrapolated from the
+//tape rate over the last window. It trades more while the tape is busy and completes the parent in the last slice.
+//It returns ErrInterval for an interval <= 0.
+func NewVWAP(t api.Trader, p Parent, interval, window time.Duration) (*Executor, error) {
+	if interval <= 0 {
+		return nil, ErrInterval
+	}
+	x := newExecutor(t, p, &vwap{twap{interval}})
+	x.tape.window = window
+	return x, nil
+}
+
+type vwap struct {
+	twap
+}
+
+func (s *vwap) target(x *Executor, now time.Time) int {
+	remaining := x.p.Deadline.Sub(x.started) - time.Duration(s.slice(x, now)+1)*s.interval
+	if remaining <= 0 {
+		return x.p.Quantity
+	}
+	volume, rate := x.tape.volume(), x.tape.rate(now, x.started)
+	expected := float64(volume) + rate*remaining.Seconds()
+	if expected <= 0 {
+		return 0
+	}
+	return int(float64(x.p.Quantity) * float64(volume) / expected)
+}
+
+//NewIceberg returns an Executor that shows at most display shares of p at a time, resting at its limit.
+//When a child order is filled, the next one is placed. The parent needs a limit (ErrNoLimit) and display has to be
+//positive (ErrDisplay).
+func NewIceberg(t api.Trader, p Parent, display int) (*Executor, error) {
+	switch {
+	case p.Limit == 0:
+		return nil, ErrNoLimit
+	case display <= 0:
+		return nil, ErrDisplay
+	}
+	return newExecutor(t, p, &iceberg{display}), nil
+}
+
+type iceberg struct {
+	display int
+}
+
+func (s *iceberg) due(x *Executor, now time.Time) bool {
+	return x.Progress().Working == 0
+}
+
+func (s *iceberg) target(x *Executor, now time.Time) int {
+	return x.Progress().Filled + s.display
+}
+
+func (s *iceberg) price(x *Executor) int {
+	return x.p.Limit
+}
+
+//tape keeps the trades seen in quotes.
+type tape struct {
+	window time.Duration
+	last   time.Time
+	trades []trade
+	total  int //volume of the trades that left the window
+}
+
+type trade struct {
+	ts   time.Time
+	size int
+}
+
+//add records the last trade of q if it is new. Trades before start only mark the point the tape continues from.
+func (t *tape) add(q api.Quote, start time.Time) {
+	if !q.LastTrade.After(t.last) {
+		return
+	}
+	t.last = q.LastTrade
+	if q.LastSize <= 0 || start.IsZero() || q.LastTrade.Before(start) {
+		return
+	}
+	t.trades = append(t.trades, trade{q.LastTrade, q.LastSize})
+	//trades older than the window are only needed as a sum
+	for len(t.trades) > 0 && t.window > 0 && q.LastTrade.Sub(t.trades[0].ts) > t.window {
+		t.total += t.trades[0].size
+		t.trades = t.trades[1:]
+	}
+}
+
+//volume returns the volume of all recorded trades.
+func (t *tape) volume() int {
+	v := t.total
+	for _, x := range t.trades {
+		v += x.size
+	}
+	return v
+}
+
+//rate returns the volume per second over the window before now, or since start if that is later.
+func (t *tape) rate(now, start time.Time) float64 {
+	from := now.Add(-t.window)
+	if t.window <= 0 || from.Before(start) {
+		from = start
+	}
+	d := now.Sub(from).Seconds()
+	if d <= 0 {
+		return 0
+	}
+	v := 0
+	for _, x := range t.trades {
+		if !x.ts.Before(from) && !x.ts.After(now) {
+			v += x.size
+		}
+	}
+	return float64(v) / d
+}
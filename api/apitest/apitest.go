@@ -0,0 +1,49 @@
+// Package apitest runs a fakeexchange for tests of code using the api package.
+//
+//	func TestSomething(t *testing.T) {
+//		ex := apitest.Start(t, nil)
+//		i := api.NewTestInstance()
+//		...
+//	}
+package apitest
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/api/fakeexchange"
+)
+
+//Start serves ex on an httptest.Server and points the Trade API, the websockets and the GameMaster-API of the api
+//package at it. A nil ex serves a fakeexchange.NewTestExchange(). The server is closed when the test ends.
+//As the URLs are global, tests using Start must not run in parallel.
+func Start(t testing.TB, ex *fakeexchange.Exchange) *fakeexchange.Exchange {
+	t.Helper()
+	if ex == nil {
+		ex = fakeexchange.NewTestExchange()
+	}
+	srv := httptest.NewServer(ex)
+	t.Cleanup(func() {
+		ex.Close()
+		srv.Close()
+	})
+	api.SetBaseURL(fakeexchange.BaseURL(srv.URL))
+	api.SetBaseWSURL(fakeexchange.BaseWSURL(srv.URL))
+	api.SetGMURL(fakeexchange.GMURL(srv.URL))
+	return ex
+}
+
+//WaitSubscribers waits until ex has at least n websocket clients, so nothing published afterwards gets lost.
+//It fails the test after 5 seconds.
+func WaitSubscribers(t testing.TB, ex *fakeexchange.Exchange, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for ex.Subscribers() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d websocket clients connected", ex.Subscribers(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
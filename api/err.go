@@ -1,7 +1,12 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
 	"sync"
 )
 
@@ -10,21 +15,88 @@ type err struct {
 	v error
 }
 
-//apiError creates an error from an error message and a http status.
-func apiError(str string, status string) error {
+//Sentinel errors which classify an *APIError. Use errors.Is to check for them.
+var (
+	ErrUnauthorized      = errors.New("unauthorized")
+	ErrNotFound          = errors.New("not found")
+	ErrOrderRejected     = errors.New("order rejected")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrServer            = errors.New("server error")
+)
+
+//APIError is returned when the API (or a websocket) answers with an error.
+type APIError struct {
+	StatusCode int    //HTTP status code, 0 for errors sent on a websocket
+	Status     string //HTTP status text, "WS" for errors sent on a websocket
+	Endpoint   string //API call that failed, e.g. "quote" or "new order"
+	Venue      string
+	Symbol     string
+	Message    string //error message sent by the server
+}
+
+func (e *APIError) Error() string {
+	str := e.Message
 	if str == "" {
 		str = "no error message"
 	}
-	return fmt.Errorf("API: %s; %s", status, str)
+	return fmt.Sprintf("API: %s; %s: %s", e.Status, e.Endpoint, str)
+}
+
+//Is allows matching an APIError against the package sentinel errors.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrOrderRejected:
+		return e.Endpoint == "new order" && (e.StatusCode == 0 || e.StatusCode == http.StatusOK || e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity)
+	case ErrInsufficientFunds:
+		msg := strings.ToLower(e.Message)
+		return strings.Contains(msg, "insufficient") || strings.Contains(msg, "not enough")
+	case ErrServer:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+//DecodeError is returned when a response could not be decoded.
+type DecodeError struct {
+	Endpoint   string
+	StatusCode int
+	Err        error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding %s response (status %d): %v", e.Endpoint, e.StatusCode, e.Err)
+}
+
+//Unwrap returns the underlying decoding error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+//TransportError is returned when a call didn't get a response, e.g. because the connection failed or the context was cancelled.
+type TransportError struct {
+	Endpoint string
+	URL      string
+	Err      error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Endpoint, e.URL, e.Err)
+}
+
+//Unwrap returns the underlying error, which allows errors.Is(err, context.Canceled) and the like.
+func (e *TransportError) Unwrap() error {
+	return e.Err
 }
 
 //setErr sets the error value on an instance only when the error isn't nil. Returns true if error was set.
 //This is useful because we don't have to check if the error is nil before calling setErr() if we don't want a current error overwritten by a nil one.
 func (i *Instance) setErr(err error) bool {
 	if err != nil {
-		if i.debug {
-			fmt.Println("err: ", err)
-		}
+		i.log(context.Background(), SubsystemAPI, slog.LevelDebug, "error", slog.Any("err", err))
 		i.err.Lock()
 		i.err.v = err
 		i.err.Unlock()
@@ -46,10 +118,3 @@ func (i *Instance) ResetErr() {
 	i.err.v = nil
 	i.err.Unlock()
 }
-
-//Debug enables comprehensive logging for the instance.
-func (i *Instance) Debug() {
-	i.Lock()
-	i.debug = true
-	i.Unlock()
-}
@@ -0,0 +1,247 @@
+package fakeexchange
+
+import (
+	"sort"
+	"time"
+)
+
+//Order types and directions understood by the matching engine.
+const (
+	limit             = "limit"
+	market            = "market"
+	fillOrKill        = "fill-or-kill"
+	immediateOrCancel = "immediate-or-cancel"
+
+	buy  = "buy"
+	sell = "sell"
+)
+
+type fill struct {
+	Price    int       `json:"price"`
+	Quantity int       `json:"qty"`
+	TS       time.Time `json:"ts"`
+}
+
+//order is both the engine's representation of an order and its wire format.
+type order struct {
+	Ok               bool      `json:"ok"`
+	Symbol           string    `json:"symbol"`
+	Venue            string    `json:"venue"`
+	Direction        string    `json:"direction"`
+	OriginalQuantity int       `json:"originalQty"`
+	Quantity         int       `json:"qty"`
+	Price            int       `json:"price"`
+	OrderType        string    `json:"orderType"`
+	ID               int       `json:"id"`
+	Account          string    `json:"account"`
+	TS               time.Time `json:"ts"`
+	Fills            []fill    `json:"fills"`
+	TotalFilled      int       `json:"totalFilled"`
+	Open             bool      `json:"open"`
+}
+
+//snapshot returns a copy of the order which is safe to hand out while the engine keeps mutating the original.
+func (o *order) snapshot() order {
+	v := *o
+	v.Ok = true
+	v.Fills = append([]fill{}, o.Fills...)
+	return v
+}
+
+func (o *order) isBuy() bool {
+	return o.Direction == buy
+}
+
+//crosses reports whether the incoming order o is willing to trade against a standing order at price.
+func (o *order) crosses(price int) bool {
+	if o.OrderType == market {
+		return true
+	}
+	if o.isBuy() {
+		return price <= o.Price
+	}
+	return price >= o.Price
+}
+
+//match is the result of a single fill between an incoming and a standing order.
+//The orders are snapshots taken right after the fill.
+type match struct {
+	standing order
+	incoming order
+	price    int
+	quantity int
+	ts       time.Time
+}
+
+//book is a price-time priority orderbook for a single stock.
+//Bids are sorted by descending price, asks by ascending price; ties keep arrival order.
+type book struct {
+	bids []*order
+	asks []*order
+
+	last      int
+	lastSize  int
+	lastTrade time.Time
+}
+
+func (b *book) side(isBuy bool) *[]*order {
+	if isBuy {
+		return &b.bids
+	}
+	return &b.asks
+}
+
+//available returns the quantity the incoming order could fill immediately.
+func (b *book) available(o *order) (qty int) {
+	for _, s := range *b.side(!o.isBuy()) {
+		if !o.crosses(s.Price) {
+			break
+		}
+		qty += s.Quantity
+	}
+	return
+}
+
+//execute matches the incoming order against the book, rests any limit remainder and returns the resulting fills.
+func (b *book) execute(o *order, now time.Time) (matches []match) {
+	if o.OrderType == fillOrKill && b.available(o) < o.Quantity {
+		o.Quantity = 0
+		o.Open = false
+		return
+	}
+
+	opposite := b.side(!o.isBuy())
+	for o.Quantity > 0 && len(*opposite) > 0 {
+		s := (*opposite)[0]
+		if !o.crosses(s.Price) {
+			break
+		}
+
+		qty := o.Quantity
+		if s.Quantity < qty {
+			qty = s.Quantity
+		}
+		f := fill{s.Price, qty, now}
+		for _, x := range []*order{s, o} {
+			x.Quantity -= qty
+			x.TotalFilled += qty
+			x.Fills = append(x.Fills, f)
+		}
+		if s.Quantity == 0 {
+			s.Open = false
+			*opposite = (*opposite)[1:]
+		}
+		if o.Quantity == 0 {
+			o.Open = false
+		}
+
+		b.last, b.lastSize, b.lastTrade = s.Price, qty, now
+		matches = append(matches, match{s.snapshot(), o.snapshot(), s.Price, qty, now})
+	}
+
+	if o.Quantity > 0 && o.OrderType == limit {
+		b.rest(o)
+	} else {
+		o.Quantity = 0
+		o.Open = false
+	}
+	return
+}
+
+//rest inserts a standing order behind all orders at the same or a better price.
+func (b *book) rest(o *order) {
+	side := b.side(o.isBuy())
+	n := sort.Search(len(*side), func(k int) bool {
+		if o.isBuy() {
+			return (*side)[k].Price < o.Price
+		}
+		return (*side)[k].Price > o.Price
+	})
+	*side = append(*side, nil)
+	copy((*side)[n+1:], (*side)[n:])
+	(*side)[n] = o
+}
+
+//cancel removes a standing order from the book and closes it.
+func (b *book) cancel(o *order) {
+	side := b.side(o.isBuy())
+	for k, s := range *side {
+		if s == o {
+			*side = append((*side)[:k], (*side)[k+1:]...)
+			break
+		}
+	}
+	o.Quantity = 0
+	o.Open = false
+}
+
+//levels aggregates a side of the book by price, which is how the API reports it.
+func levels(side []*order, isBuy bool) []level {
+	v := []level{}
+	for _, o := range side {
+		if n := len(v); n > 0 && v[n-1].Price == o.Price {
+			v[n-1].Quantity += o.Quantity
+			continue
+		}
+		v = append(v, level{o.Price, o.Quantity, isBuy})
+	}
+	return v
+}
+
+type level struct {
+	Price    int  `json:"price"`
+	Quantity int  `json:"qty"`
+	IsBuy    bool `json:"isBuy"`
+}
+
+type orderbook struct {
+	Ok     bool      `json:"ok"`
+	Venue  string    `json:"venue"`
+	Symbol string    `json:"symbol"`
+	Bids   []level   `json:"bids"`
+	Asks   []level   `json:"asks"`
+	TS     time.Time `json:"ts"`
+}
+
+func (b *book) orderbook(venue, symbol string, now time.Time) orderbook {
+	return orderbook{true, venue, symbol, levels(b.bids, true), levels(b.asks, false), now}
+}
+
+type quote struct {
+	Ok        bool       `json:"ok"`
+	Symbol    string     `json:"symbol"`
+	Venue     string     `json:"venue"`
+	Bid       int        `json:"bid,omitempty"`
+	Ask       int        `json:"ask,omitempty"`
+	BidSize   int        `json:"bidSize"`
+	AskSize   int        `json:"askSize"`
+	BidDepth  int        `json:"bidDepth"`
+	AskDepth  int        `json:"askDepth"`
+	Last      int        `json:"last,omitempty"`
+	LastSize  int        `json:"lastSize,omitempty"`
+	LastTrade *time.Time `json:"lastTrade,omitempty"`
+	QuoteTime time.Time  `json:"quoteTime"`
+}
+
+func (b *book) quote(venue, symbol string, now time.Time) quote {
+	q := quote{Ok: true, Symbol: symbol, Venue: venue, QuoteTime: now}
+	for k, o := range b.bids {
+		if k == 0 || o.Price == b.bids[0].Price {
+			q.Bid = o.Price
+			q.BidSize += o.Quantity
+		}
+		q.BidDepth += o.Quantity
+	}
+	for k, o := range b.asks {
+		if k == 0 || o.Price == b.asks[0].Price {
+			q.Ask = o.Price
+			q.AskSize += o.Quantity
+		}
+		q.AskDepth += o.Quantity
+	}
+	if !b.lastTrade.IsZero() {
+		t := b.lastTrade
+		q.Last, q.LastSize, q.LastTrade = b.last, b.lastSize, &t
+	}
+	return q
+}
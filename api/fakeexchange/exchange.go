@@ -0,0 +1,441 @@
+// Package fakeexchange implements an in-process stand-in for the stockfighter.io Trade API and GameMaster-API.
+//
+// An Exchange serves every endpoint used by the api package, including the tickertape and executions websockets,
+// on top of a price-time priority matching engine. Mount it on an httptest.Server and point the client at it:
+//
+//	ex := fakeexchange.NewTestExchange()
+//	srv := httptest.NewServer(ex)
+//	api.SetBaseURL(fakeexchange.BaseURL(srv.URL))
+//	api.SetBaseWSURL(fakeexchange.BaseWSURL(srv.URL))
+//	api.SetGMURL(fakeexchange.GMURL(srv.URL))
+package fakeexchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiPath string = "/ob/api/"
+	wsPath  string = apiPath + "ws/"
+	gmPath  string = "/gm/"
+)
+
+//BaseURL returns the value to pass to api.SetBaseURL for an Exchange served at serverURL.
+func BaseURL(serverURL string) string {
+	return strings.TrimSuffix(serverURL, "/") + apiPath
+}
+
+//BaseWSURL returns the value to pass to api.SetBaseWSURL for an Exchange served at serverURL.
+func BaseWSURL(serverURL string) string {
+	u := strings.TrimSuffix(serverURL, "/") + wsPath
+	if strings.HasPrefix(u, "https://") {
+		return "wss://" + strings.TrimPrefix(u, "https://")
+	}
+	return "ws://" + strings.TrimPrefix(u, "http://")
+}
+
+//GMURL returns the value to pass to api.SetGMURL for an Exchange served at serverURL.
+func GMURL(serverURL string) string {
+	return strings.TrimSuffix(serverURL, "/") + gmPath
+}
+
+//Stock describes a stock listed on a venue.
+type Stock struct {
+	Name   string `json:"name"`
+	Symbol string `json:"symbol"`
+}
+
+type venue struct {
+	name   string
+	stocks []Stock
+	books  map[string]*book
+	orders []*order //indexed by order id
+}
+
+//Exchange is an http.Handler that emulates the stockfighter.io Trade API for any number of venues,
+//and the GameMaster-API for the levels added with AddLevel.
+type Exchange struct {
+	mu        sync.Mutex
+	venues    map[string]*venue
+	keys      map[string]string //account -> API key
+	subs      map[*subscriber]struct{}
+	levels    map[string]Level
+	instances []*instance //indexed by instance id - 1
+
+	//Now returns the timestamp used for orders, fills and quotes. Defaults to time.Now.
+	Now func() time.Time
+}
+
+//New creates an exchange without any venues.
+func New() *Exchange {
+	return &Exchange{
+		venues: map[string]*venue{},
+		keys:   map[string]string{},
+		subs:   map[*subscriber]struct{}{},
+		levels: map[string]Level{},
+		Now:    time.Now,
+	}
+}
+
+//NewTestExchange creates an exchange that lists the same venue and stock api.NewTestInstance uses.
+func NewTestExchange() *Exchange {
+	e := New()
+	e.AddVenue("TESTEX", Stock{"Foreign Owned Occluded Bridge Architecture Resources", "FOOBAR"})
+	return e
+}
+
+//AddVenue lists the given stocks on a (possibly new) venue.
+func (e *Exchange) AddVenue(name string, stocks ...Stock) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.addVenue(name, stocks...)
+}
+
+//addVenue must be called with e.mu held.
+func (e *Exchange) addVenue(name string, stocks ...Stock) {
+	v, ok := e.venues[name]
+	if !ok {
+		v = &venue{name: name, books: map[string]*book{}}
+		e.venues[name] = v
+	}
+	for _, s := range stocks {
+		if _, ok := v.books[s.Symbol]; !ok {
+			v.stocks = append(v.stocks, s)
+			v.books[s.Symbol] = &book{}
+		}
+	}
+}
+
+//AddAccount restricts trading on account to requests carrying apiKey.
+//Accounts that were never added accept requests with any (or no) API key.
+func (e *Exchange) AddAccount(account, apiKey string) {
+	e.mu.Lock()
+	e.keys[account] = apiKey
+	e.mu.Unlock()
+}
+
+//Subscribers returns the number of connected websocket clients.
+func (e *Exchange) Subscribers() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.subs)
+}
+
+//Close disconnects all websocket subscribers.
+func (e *Exchange) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for s := range e.subs {
+		s.close()
+		delete(e.subs, s)
+	}
+}
+
+//httpError carries a status code and the message returned in the "error" field.
+type httpError struct {
+	status  int
+	message string
+}
+
+func (err *httpError) Error() string {
+	return err.message
+}
+
+func errorf(status int, format string, a ...interface{}) *httpError {
+	return &httpError{status, fmt.Sprintf(format, a...)}
+}
+
+type errorResult struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+//ServeHTTP routes a request to the matching Trade API or GameMaster-API endpoint.
+func (e *Exchange) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, wsPath) {
+		e.serveWS(w, r, strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, wsPath), "/"), "/"))
+		return
+	}
+
+	var (
+		v   interface{}
+		err *httpError
+	)
+	switch {
+	case strings.HasPrefix(r.URL.Path, apiPath):
+		v, err = e.route(r, strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPath), "/"), "/"))
+	case strings.HasPrefix(r.URL.Path, gmPath):
+		v, err = e.routeGM(r, strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, gmPath), "/"), "/"))
+	default:
+		err = errorf(http.StatusNotFound, "not found")
+	}
+	if err != nil {
+		writeJSON(w, err.status, errorResult{false, err.message})
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (e *Exchange) route(r *http.Request, p []string) (interface{}, *httpError) {
+	key := r.Header.Get("X-Starfighter-Authorization")
+	get, post, del := r.Method == "GET", r.Method == "POST", r.Method == "DELETE"
+
+	switch {
+	case len(p) == 1 && p[0] == "heartbeat" && get:
+		return errorResult{true, ""}, nil
+	case len(p) < 3 || p[0] != "venues":
+		return nil, errorf(http.StatusNotFound, "no such endpoint: %s %s", r.Method, r.URL.Path)
+	case len(p) == 3 && p[2] == "heartbeat" && get:
+		return e.venueHeartbeat(p[1])
+	case len(p) == 3 && p[2] == "stocks" && get:
+		return e.stocks(p[1])
+	case len(p) == 4 && p[2] == "stocks" && get:
+		return e.orderbook(p[1], p[3])
+	case len(p) == 5 && p[2] == "stocks" && p[4] == "quote" && get:
+		return e.quote(p[1], p[3])
+	case len(p) == 5 && p[2] == "stocks" && p[4] == "orders" && post:
+		return e.placeOrder(key, p[1], p[3], r)
+	case len(p) == 6 && p[2] == "stocks" && p[4] == "orders" && get:
+		return e.orderStatus(key, p[1], p[3], p[5])
+	case len(p) == 6 && p[2] == "stocks" && p[4] == "orders" && del,
+		len(p) == 7 && p[2] == "stocks" && p[4] == "orders" && p[6] == "cancel" && post:
+		return e.cancelOrder(key, p[1], p[3], p[5])
+	case len(p) == 5 && p[2] == "accounts" && p[4] == "orders" && get:
+		return e.accountOrders(key, p[1], p[3], "")
+	case len(p) == 7 && p[2] == "accounts" && p[4] == "stocks" && p[6] == "orders" && get:
+		return e.accountOrders(key, p[1], p[3], p[5])
+	}
+	return nil, errorf(http.StatusNotFound, "no such endpoint: %s %s", r.Method, r.URL.Path)
+}
+
+//venue looks up a venue. Must be called with e.mu held.
+func (e *Exchange) venue(name string) (*venue, *httpError) {
+	v, ok := e.venues[name]
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "No venue exists with the symbol %s", name)
+	}
+	return v, nil
+}
+
+//book looks up the book of a stock on a venue. Must be called with e.mu held.
+func (e *Exchange) book(venueName, symbol string) (*venue, *book, *httpError) {
+	v, err := e.venue(venueName)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, ok := v.books[symbol]
+	if !ok {
+		return nil, nil, errorf(http.StatusNotFound, "Stock %s does not trade on venue %s", symbol, venueName)
+	}
+	return v, b, nil
+}
+
+//authorize checks that key may act for account. Must be called with e.mu held.
+func (e *Exchange) authorize(key, account string) *httpError {
+	if want, ok := e.keys[account]; ok && want != key {
+		return errorf(http.StatusUnauthorized, "Not authorized to access account %s", account)
+	}
+	return nil
+}
+
+func (e *Exchange) venueHeartbeat(name string) (interface{}, *httpError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.venue(name); err != nil {
+		return nil, err
+	}
+	return struct {
+		Ok    bool   `json:"ok"`
+		Venue string `json:"venue"`
+	}{true, name}, nil
+}
+
+func (e *Exchange) stocks(name string) (interface{}, *httpError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	v, err := e.venue(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Ok      bool    `json:"ok"`
+		Symbols []Stock `json:"symbols"`
+	}{true, append([]Stock{}, v.stocks...)}, nil
+}
+
+func (e *Exchange) orderbook(venueName, symbol string) (interface{}, *httpError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, b, err := e.book(venueName, symbol)
+	if err != nil {
+		return nil, err
+	}
+	return b.orderbook(venueName, symbol, e.Now()), nil
+}
+
+func (e *Exchange) quote(venueName, symbol string) (interface{}, *httpError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, b, err := e.book(venueName, symbol)
+	if err != nil {
+		return nil, err
+	}
+	return b.quote(venueName, symbol, e.Now()), nil
+}
+
+type orderRequest struct {
+	Account   string `json:"account"`
+	Venue     string `json:"venue"`
+	Symbol    string `json:"symbol"`
+	Price     int    `json:"price"`
+	Quantity  int    `json:"qty"`
+	Direction string `json:"direction"`
+	OrderType string `json:"orderType"`
+}
+
+func (req *orderRequest) validate() *httpError {
+	switch {
+	case req.Account == "":
+		return errorf(http.StatusBadRequest, "Missing account")
+	case req.Quantity <= 0:
+		return errorf(http.StatusBadRequest, "Invalid quantity %d", req.Quantity)
+	case req.Price < 0:
+		return errorf(http.StatusBadRequest, "Invalid price %d", req.Price)
+	case req.Direction != buy && req.Direction != sell:
+		return errorf(http.StatusBadRequest, "Invalid direction %q", req.Direction)
+	}
+	switch req.OrderType {
+	case limit, market, fillOrKill, immediateOrCancel:
+		return nil
+	}
+	return errorf(http.StatusBadRequest, "Invalid order type %q", req.OrderType)
+}
+
+func (e *Exchange) placeOrder(key, venueName, symbol string, r *http.Request) (interface{}, *httpError) {
+	var req orderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errorf(http.StatusBadRequest, "Invalid order JSON: %v", err)
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	if (req.Venue != "" && req.Venue != venueName) || (req.Symbol != "" && req.Symbol != symbol) {
+		return nil, errorf(http.StatusBadRequest, "Order for %s on %s posted to %s on %s", req.Symbol, req.Venue, symbol, venueName)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	v, b, err := e.book(venueName, symbol)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.authorize(key, req.Account); err != nil {
+		return nil, err
+	}
+
+	now := e.Now()
+	o := &order{
+		Symbol:           symbol,
+		Venue:            venueName,
+		Direction:        req.Direction,
+		OriginalQuantity: req.Quantity,
+		Quantity:         req.Quantity,
+		Price:            req.Price,
+		OrderType:        req.OrderType,
+		ID:               len(v.orders),
+		Account:          req.Account,
+		TS:               now,
+		Fills:            []fill{},
+		Open:             true,
+	}
+	v.orders = append(v.orders, o)
+
+	for _, m := range b.execute(o, now) {
+		e.publishExecution(m.standing, m)
+		e.publishExecution(m.incoming, m)
+	}
+	e.publishQuote(b.quote(venueName, symbol, now))
+	return o.snapshot(), nil
+}
+
+//lookupOrder finds an order and checks that key may access it. Must be called with e.mu held.
+func (e *Exchange) lookupOrder(key, venueName, symbol, rawID string) (*order, *book, *httpError) {
+	v, b, err := e.book(venueName, symbol)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, convErr := strconv.Atoi(rawID)
+	if convErr != nil || id < 0 || id >= len(v.orders) || v.orders[id].Symbol != symbol {
+		return nil, nil, errorf(http.StatusNotFound, "No order %s for %s on venue %s", rawID, symbol, venueName)
+	}
+	o := v.orders[id]
+	if err := e.authorize(key, o.Account); err != nil {
+		return nil, nil, err
+	}
+	return o, b, nil
+}
+
+func (e *Exchange) orderStatus(key, venueName, symbol, rawID string) (interface{}, *httpError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, _, err := e.lookupOrder(key, venueName, symbol, rawID)
+	if err != nil {
+		return nil, err
+	}
+	return o.snapshot(), nil
+}
+
+func (e *Exchange) cancelOrder(key, venueName, symbol, rawID string) (interface{}, *httpError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, b, err := e.lookupOrder(key, venueName, symbol, rawID)
+	if err != nil {
+		return nil, err
+	}
+	if o.Open {
+		b.cancel(o)
+		e.publishQuote(b.quote(venueName, symbol, e.Now()))
+	}
+	return o.snapshot(), nil
+}
+
+func (e *Exchange) accountOrders(key, venueName, account, symbol string) (interface{}, *httpError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	v, err := e.venue(venueName)
+	if err != nil {
+		return nil, err
+	}
+	if symbol != "" {
+		if _, _, err := e.book(venueName, symbol); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.authorize(key, account); err != nil {
+		return nil, err
+	}
+
+	orders := []order{}
+	for _, o := range v.orders {
+		if o.Account == account && (symbol == "" || o.Symbol == symbol) {
+			orders = append(orders, o.snapshot())
+		}
+	}
+	return struct {
+		Ok     bool    `json:"ok"`
+		Venue  string  `json:"venue"`
+		Orders []order `json:"orders"`
+	}{true, venueName, orders}, nil
+}
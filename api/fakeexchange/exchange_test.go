@@ -0,0 +1,177 @@
+package fakeexchange_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/api/apitest"
+	"github.com/ianberinger/stockfighter/api/fakeexchange"
+)
+
+func TestTradeAPI(t *testing.T) {
+	apitest.Start(t, nil)
+	ctx := context.Background()
+	i := api.NewTestInstance()
+
+	if _, err := i.HeartbeatCtx(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := i.VenueHeartbeatCtx(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stocks, err := i.AvailableStocksCtx(ctx)
+	if err != nil || len(stocks) != 1 || stocks[0].Symbol != "FOOBAR" {
+		t.Fatal(stocks, err)
+	}
+	book, err := i.OrderbookCtx(ctx)
+	if err != nil || len(book.Bids)+len(book.Asks) != 0 {
+		t.Fatal(book, err)
+	}
+
+	ask, err := i.NewOrderCtx(ctx, 5000, 100, api.Sell, api.Limit)
+	if err != nil || !ask.Open || ask.TotalFilled != 0 {
+		t.Fatal(ask, err)
+	}
+	book, err = i.OrderbookCtx(ctx)
+	if err != nil || len(book.Asks) != 1 || book.Asks[0].Price != 5000 || book.Asks[0].Quantity != 100 {
+		t.Fatal(book, err)
+	}
+	q, err := i.QuoteCtx(ctx)
+	if err != nil || q.Ask != 5000 || q.AskSize != 100 || q.Bid != 0 {
+		t.Fatal(q, err)
+	}
+
+	//an immediate-or-cancel order trades at the resting price and never rests
+	ioc, err := i.NewOrderCtx(ctx, 5100, 50, api.Buy, api.ImmediateOrCancel)
+	if err != nil || ioc.Open || ioc.TotalFilled != 50 || len(ioc.Fills) != 1 || ioc.Fills[0].Price != 5000 {
+		t.Fatal(ioc, err)
+	}
+	market, err := i.NewOrderCtx(ctx, 0, 10, api.Buy, api.Market)
+	if err != nil || market.Open || market.TotalFilled != 10 {
+		t.Fatal(market, err)
+	}
+	//a fill-or-kill order larger than the book is killed without trading
+	fok, err := i.NewOrderCtx(ctx, 5000, 1000, api.Buy, api.FillOrKill)
+	if err != nil || fok.Open || fok.TotalFilled != 0 {
+		t.Fatal(fok, err)
+	}
+	q, err = i.QuoteCtx(ctx)
+	if err != nil || q.LastPrice != 5000 || q.LastSize != 10 || q.AskSize != 40 {
+		t.Fatal(q, err)
+	}
+
+	status, err := i.OrderStatusCtx(ctx, ask.ID)
+	if err != nil || !status.Open || status.TotalFilled != 60 || len(status.Fills) != 2 {
+		t.Fatal(status, err)
+	}
+	cancelled, err := i.CancelOrderCtx(ctx, ask.ID)
+	if err != nil || cancelled.Open || cancelled.TotalFilled != 60 {
+		t.Fatal(cancelled, err)
+	}
+	account, err := i.AccountOrderStatusCtx(ctx)
+	if err != nil || len(account) != 4 {
+		t.Fatal(account, err)
+	}
+	stock, err := i.StockOrderStatusCtx(ctx)
+	if err != nil || len(stock) != 4 {
+		t.Fatal(stock, err)
+	}
+	for _, o := range stock {
+		if o.Open {
+			t.Error("open after cancel", o)
+		}
+	}
+}
+
+func TestTradeAPIErrors(t *testing.T) {
+	ex := apitest.Start(t, nil)
+	ctx := context.Background()
+	i := api.NewTestInstance()
+
+	if _, err := i.NewOrderCtx(ctx, 100, 0, api.Buy, api.Limit); !errors.Is(err, api.ErrOrderRejected) {
+		t.Error("zero quantity:", err)
+	}
+	if _, err := i.OrderStatusCtx(ctx, 12345); !errors.Is(err, api.ErrNotFound) {
+		t.Error("unknown order:", err)
+	}
+	i.SetSymbol("NOPE")
+	if _, err := i.QuoteCtx(ctx); !errors.Is(err, api.ErrNotFound) {
+		t.Error("unknown stock:", err)
+	}
+	i.SetVenue("NOPE")
+	if _, err := i.VenueHeartbeatCtx(ctx); !errors.Is(err, api.ErrNotFound) {
+		t.Error("unknown venue:", err)
+	}
+
+	ex.AddAccount("EXB123456", "secret")
+	if _, err := api.NewTestInstance().NewOrderCtx(ctx, 100, 1, api.Buy, api.Limit); !errors.Is(err, api.ErrUnauthorized) {
+		t.Error("wrong key:", err)
+	}
+	i = api.NewTestInstance()
+	i.SetAPIKey("secret")
+	if _, err := i.NewOrderCtx(ctx, 100, 1, api.Buy, api.Limit); err != nil {
+		t.Error("right key:", err)
+	}
+}
+
+func TestWebsockets(t *testing.T) {
+	ex := apitest.Start(t, nil)
+	ex.AddVenue("TESTEX", fakeexchange.Stock{Name: "other", Symbol: "BAZ"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	i := api.NewTestInstance()
+	other := api.NewInstance("", "OTHER", "TESTEX", "FOOBAR")
+	stockQuotes := i.QuotesCtx(ctx, true)
+	venueQuotes := i.QuotesCtx(ctx, false)
+	executions := i.ExecutionsCtx(ctx, true, i.GetAccount())
+	otherExecutions := other.ExecutionsCtx(ctx, false, other.GetAccount())
+	apitest.WaitSubscribers(t, ex, 4)
+
+	ask, err := other.NewOrderCtx(ctx, 5000, 10, api.Sell, api.Limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bid, err := i.NewOrderCtx(ctx, 5000, 4, api.Buy, api.Limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.SetSymbol("BAZ")
+	if _, err := other.NewOrderCtx(ctx, 100, 1, api.Buy, api.Limit); err != nil {
+		t.Fatal(err)
+	}
+
+	//the stock feed sees the two FOOBAR orders, the venue feed also the BAZ order
+	for k := 0; k < 2; k++ {
+		if q := <-stockQuotes.Values; q.Symbol != "FOOBAR" {
+			t.Error("stock feed", q)
+		}
+	}
+	symbols := map[string]int{}
+	for k := 0; k < 3; k++ {
+		symbols[(<-venueQuotes.Values).Symbol]++
+	}
+	if symbols["FOOBAR"] != 2 || symbols["BAZ"] != 1 {
+		t.Error("venue feed", symbols)
+	}
+
+	//both sides of the trade get an execution for their own order
+	e := <-executions.Values
+	if e.Order.ID != bid.ID || e.Price != 5000 || e.Filled != 4 || e.Order.Open || !e.IncomingComplete || e.StandingComplete {
+		t.Errorf("incoming %+v", e)
+	}
+	e = <-otherExecutions.Values
+	if e.Order.ID != ask.ID || e.Filled != 4 || !e.Order.Open || e.StandingID != ask.ID || e.IncomingID != bid.ID {
+		t.Errorf("standing %+v", e)
+	}
+
+	cancel()
+	for range executions.Values {
+	}
+	if err := executions.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,279 @@
+package fakeexchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//Instance states reported by the GameMaster.
+const (
+	stateOpen   = "open"
+	stateClosed = "closed"
+	stateDone   = "completed"
+)
+
+//Level describes a level the GameMaster can start.
+type Level struct {
+	Name         string
+	Instructions string
+	//Venue and Stocks are listed on the exchange when the level starts. Leave them empty for levels without trading.
+	Venue  string
+	Stocks []Stock
+	//SecondsPerTradingDay is the wall clock time of a trading day, 5 seconds if 0.
+	SecondsPerTradingDay int
+	//TradingDays is the trading day on which the level is done, 0 for levels that never end on their own.
+	TradingDays int
+}
+
+func (l Level) secondsPerTradingDay() int {
+	if l.SecondsPerTradingDay <= 0 {
+		return 5
+	}
+	return l.SecondsPerTradingDay
+}
+
+type instance struct {
+	id         int
+	level      Level
+	account    string
+	started    time.Time
+	state      string
+	done       bool
+	flash      map[string]string
+	judgements []map[string]string
+}
+
+//tradingDay returns the trading day of an instance at now.
+func (in *instance) tradingDay(now time.Time) int {
+	return int(now.Sub(in.started) / (time.Duration(in.level.secondsPerTradingDay()) * time.Second))
+}
+
+//update ends an instance once it reached its last trading day.
+func (in *instance) update(now time.Time) {
+	if in.state == stateOpen && in.level.TradingDays > 0 && in.tradingDay(now) >= in.level.TradingDays {
+		in.state, in.done = stateDone, true
+	}
+}
+
+//AddLevel makes a level available to the GameMaster-API.
+func (e *Exchange) AddLevel(l Level) {
+	e.mu.Lock()
+	e.levels[l.Name] = l
+	e.mu.Unlock()
+}
+
+//SetFlash sets the flash message of an instance shown on its status. kind is info, warning or danger; an empty message removes it.
+func (e *Exchange) SetFlash(instanceID int, kind, message string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if in, err := e.instance(strconv.Itoa(instanceID)); err == nil {
+		if message == "" {
+			delete(in.flash, kind)
+		} else {
+			in.flash[kind] = message
+		}
+	}
+}
+
+//EndInstance marks an instance as done, as if it reached its last trading day.
+func (e *Exchange) EndInstance(instanceID int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if in, err := e.instance(strconv.Itoa(instanceID)); err == nil {
+		in.state, in.done = stateDone, true
+	}
+}
+
+//Judgements returns the bodies posted to the judge endpoint of an instance.
+func (e *Exchange) Judgements(instanceID int) []map[string]string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	in, err := e.instance(strconv.Itoa(instanceID))
+	if err != nil {
+		return nil
+	}
+	return append([]map[string]string{}, in.judgements...)
+}
+
+func (e *Exchange) routeGM(r *http.Request, p []string) (interface{}, *httpError) {
+	get, post := r.Method == "GET", r.Method == "POST"
+
+	switch {
+	case len(p) == 1 && p[0] == "levels" && get:
+		return e.listLevels()
+	case len(p) == 2 && p[0] == "levels" && post:
+		return e.startLevel(p[1])
+	case len(p) == 2 && p[0] == "instances" && get:
+		return e.instanceStatus(p[1])
+	case len(p) == 3 && p[0] == "instances" && post:
+		switch p[2] {
+		case "restart", "resume", "stop":
+			return e.controlInstance(p[1], p[2])
+		case "judge":
+			return e.judge(p[1], r)
+		}
+	}
+	return nil, errorf(http.StatusNotFound, "no such endpoint: %s %s", r.Method, r.URL.Path)
+}
+
+//instance looks up an instance. Must be called with e.mu held.
+func (e *Exchange) instance(rawID string) (*instance, *httpError) {
+	id, err := strconv.Atoi(rawID)
+	if err != nil || id < 1 || id > len(e.instances) {
+		return nil, errorf(http.StatusNotFound, "No instance %s", rawID)
+	}
+	return e.instances[id-1], nil
+}
+
+type levelResult struct {
+	Name string `json:"name"`
+}
+
+func (e *Exchange) listLevels() (interface{}, *httpError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	levels := []levelResult{}
+	for name := range e.levels {
+		levels = append(levels, levelResult{name})
+	}
+	sort.Slice(levels, func(a, b int) bool { return levels[a].Name < levels[b].Name })
+	return struct {
+		Ok     bool          `json:"ok"`
+		Levels []levelResult `json:"levels"`
+	}{true, levels}, nil
+}
+
+type levelState struct {
+	Ok                   bool              `json:"ok"`
+	Account              string            `json:"account"`
+	InstanceID           int               `json:"instanceId"`
+	Instructions         map[string]string `json:"instructions"`
+	SecondsPerTradingDay int               `json:"secondsPerTradingDay"`
+	Venues               []string          `json:"venues"`
+	Symbols              []string          `json:"tickers"`
+}
+
+//levelState describes a running instance. Must be called with e.mu held.
+func (e *Exchange) levelState(in *instance) levelState {
+	v := levelState{
+		Ok:                   true,
+		Account:              in.account,
+		InstanceID:           in.id,
+		Instructions:         map[string]string{"Instructions": in.level.Instructions},
+		SecondsPerTradingDay: in.level.secondsPerTradingDay(),
+		Venues:               []string{},
+		Symbols:              []string{},
+	}
+	if in.level.Venue != "" {
+		v.Venues = append(v.Venues, in.level.Venue)
+	}
+	for _, s := range in.level.Stocks {
+		v.Symbols = append(v.Symbols, s.Symbol)
+	}
+	return v
+}
+
+func (e *Exchange) startLevel(name string) (interface{}, *httpError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	l, ok := e.levels[name]
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "No level %s", name)
+	}
+
+	in := &instance{
+		id:      len(e.instances) + 1,
+		level:   l,
+		started: e.Now(),
+		state:   stateOpen,
+		flash:   map[string]string{},
+	}
+	in.account = fmt.Sprintf("GM%07d", in.id)
+	e.instances = append(e.instances, in)
+	if l.Venue != "" {
+		e.addVenue(l.Venue, l.Stocks...)
+	}
+	return e.levelState(in), nil
+}
+
+type instanceDetails struct {
+	EndOfTheWorldDay int `json:"endOfTheWorldDay"`
+	TradingDay       int `json:"tradingDay"`
+}
+
+func (e *Exchange) instanceStatus(rawID string) (interface{}, *httpError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	in, err := e.instance(rawID)
+	if err != nil {
+		return nil, err
+	}
+	now := e.Now()
+	in.update(now)
+
+	flash := map[string]string{}
+	for k, v := range in.flash {
+		flash[k] = v
+	}
+	return struct {
+		Ok      bool              `json:"ok"`
+		Done    bool              `json:"done"`
+		ID      int               `json:"id"`
+		State   string            `json:"state"`
+		Flash   map[string]string `json:"flash,omitempty"`
+		Details instanceDetails   `json:"details"`
+	}{true, in.done, in.id, in.state, flash, instanceDetails{in.level.TradingDays, in.tradingDay(now)}}, nil
+}
+
+func (e *Exchange) controlInstance(rawID, action string) (interface{}, *httpError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	in, err := e.instance(rawID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch action {
+	case "stop":
+		in.state = stateClosed
+		return errorResult{true, ""}, nil
+	case "restart":
+		in.started, in.state, in.done = e.Now(), stateOpen, false
+		in.flash = map[string]string{}
+	case "resume":
+		if in.done {
+			return nil, errorf(http.StatusBadRequest, "Instance %d is done", in.id)
+		}
+		in.state = stateOpen
+	}
+	return e.levelState(in), nil
+}
+
+func (e *Exchange) judge(rawID string, r *http.Request) (interface{}, *httpError) {
+	body, readErr := ioutil.ReadAll(r.Body)
+	if readErr != nil {
+		return nil, errorf(http.StatusBadRequest, "Invalid body: %v", readErr)
+	}
+	var judgement map[string]string
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &judgement); err != nil {
+			return nil, errorf(http.StatusBadRequest, "Invalid judgement JSON: %v", err)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	in, err := e.instance(rawID)
+	if err != nil {
+		return nil, err
+	}
+	if judgement != nil {
+		in.judgements = append(in.judgements, judgement)
+	}
+	return errorResult{true, ""}, nil
+}
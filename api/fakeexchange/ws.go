@@ -0,0 +1,172 @@
+package fakeexchange
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+//subscriberBuffer is the number of messages queued for a websocket client before it is considered too slow and dropped.
+const subscriberBuffer = 1024
+
+const (
+	tickertape = "tickertape"
+	executions = "executions"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+//subscriber is a single websocket client of either the tickertape or the executions feed.
+type subscriber struct {
+	feed    string
+	account string
+	venue   string
+	symbol  string //empty for all stocks on the venue
+	out     chan []byte
+
+	once sync.Once
+	done chan struct{}
+}
+
+func (s *subscriber) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+//send queues a message without blocking. Slow subscribers get disconnected. Must be called with e.mu held.
+func (e *Exchange) send(s *subscriber, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	select {
+	case s.out <- b:
+	default:
+		s.close()
+		delete(e.subs, s)
+	}
+}
+
+type wsQuote struct {
+	Ok    bool  `json:"ok"`
+	Quote quote `json:"quote"`
+}
+
+//publishQuote sends a quote to all matching tickertape subscribers. Must be called with e.mu held.
+func (e *Exchange) publishQuote(q quote) {
+	for s := range e.subs {
+		if s.feed == tickertape && s.venue == q.Venue && (s.symbol == "" || s.symbol == q.Symbol) {
+			e.send(s, wsQuote{true, q})
+		}
+	}
+}
+
+type execution struct {
+	Ok               bool      `json:"ok"`
+	Account          string    `json:"account"`
+	Venue            string    `json:"venue"`
+	Symbol           string    `json:"symbol"`
+	Order            order     `json:"order"`
+	StandingID       int       `json:"standingId"`
+	IncomingID       int       `json:"incomingId"`
+	Price            int       `json:"price"`
+	Filled           int       `json:"filled"`
+	FilledAt         time.Time `json:"filledAt"`
+	StandingComplete bool      `json:"standingComplete"`
+	IncomingComplete bool      `json:"incomingComplete"`
+}
+
+//publishExecution reports a fill to the executions subscribers of the account owning o. Must be called with e.mu held.
+func (e *Exchange) publishExecution(o order, m match) {
+	v := execution{
+		Ok:               true,
+		Account:          o.Account,
+		Venue:            o.Venue,
+		Symbol:           o.Symbol,
+		Order:            o,
+		StandingID:       m.standing.ID,
+		IncomingID:       m.incoming.ID,
+		Price:            m.price,
+		Filled:           m.quantity,
+		FilledAt:         m.ts,
+		StandingComplete: m.standing.Quantity == 0,
+		IncomingComplete: m.incoming.Quantity == 0,
+	}
+	for s := range e.subs {
+		if s.feed == executions && s.account == o.Account && s.venue == o.Venue && (s.symbol == "" || s.symbol == o.Symbol) {
+			e.send(s, v)
+		}
+	}
+}
+
+//serveWS handles ws/:account/venues/:venue/(tickertape|executions)[/stocks/:stock].
+func (e *Exchange) serveWS(w http.ResponseWriter, r *http.Request, p []string) {
+	if !(len(p) == 4 || len(p) == 6 && p[4] == "stocks") || p[1] != "venues" || (p[3] != tickertape && p[3] != executions) {
+		writeJSON(w, http.StatusNotFound, errorResult{false, "no such websocket endpoint: " + r.URL.Path})
+		return
+	}
+	s := &subscriber{
+		feed:    p[3],
+		account: p[0],
+		venue:   p[2],
+		out:     make(chan []byte, subscriberBuffer),
+		done:    make(chan struct{}),
+	}
+	if len(p) == 6 {
+		s.symbol = p[5]
+	}
+
+	e.mu.Lock()
+	var err *httpError
+	if s.symbol != "" {
+		_, _, err = e.book(s.venue, s.symbol)
+	} else {
+		_, err = e.venue(s.venue)
+	}
+	e.mu.Unlock()
+	if err != nil {
+		writeJSON(w, err.status, errorResult{false, err.message})
+		return
+	}
+
+	conn, upgradeErr := upgrader.Upgrade(w, r, nil)
+	if upgradeErr != nil {
+		return
+	}
+
+	e.mu.Lock()
+	e.subs[s] = struct{}{}
+	e.mu.Unlock()
+
+	//the read loop only exists to notice the client going away.
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				s.close()
+				return
+			}
+		}
+	}()
+
+	defer func() {
+		e.mu.Lock()
+		delete(e.subs, s)
+		e.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		select {
+		case b := <-s.out:
+			if conn.WriteMessage(websocket.TextMessage, b) != nil {
+				return
+			}
+		case <-s.done:
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return
+		}
+	}
+}
@@ -1,11 +1,20 @@
 package api
 
-import "fmt"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
 
-const (
+var (
 	gmURL string = "https://www.stockfighter.io/gm/"
 )
 
+//SetGMURL changes the base URL of the GameMaster-API.
+func SetGMURL(URL string) {
+	gmURL = URL
+}
+
 //LevelState contains all data returned by API call to GameMaster-API.
 type LevelState struct {
 	ErrorResult
@@ -23,48 +32,183 @@ type Instructions struct {
 	OrderTypes   string `json:"Order Types"`
 }
 
+//setLevelState sets the instance state from a started level. Venue and symbol are left empty if the level doesn't list any.
+func (i *Instance) setLevelState(v LevelState) {
+	if v.InstanceID == 0 {
+		return
+	}
+	var venue, symbol string
+	if len(v.Venues) > 0 {
+		venue = v.Venues[0]
+	}
+	if len(v.Symbols) > 0 {
+		symbol = v.Symbols[0]
+	}
+	i.setState(v.InstanceID, v.Account, venue, symbol)
+}
+
 //StartLevel starts a level and sets the instance state. It returns the levelstate.
+//The state only holds the first venue and symbol of the level, use LevelListings() to trade all of them.
 func (i *Instance) StartLevel(level string) (v LevelState) {
-	i.doHTTP("POST", fmt.Sprintf("%slevels/%s", gmURL, level), nil, &v)
+	v, err := i.StartLevelCtx(context.Background(), level)
+	i.setErr(err)
+	return
+}
 
-	if v.InstanceID != 0 {
-		i.setState(v.InstanceID, v.Account, v.Venues[0], v.Symbols[0])
-	}
+//StartLevelCtx works like StartLevel() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) StartLevelCtx(ctx context.Context, level string) (v LevelState, err error) {
+	err = i.doHTTP(ctx, request{endpoint: "start level", method: "POST", url: fmt.Sprintf("%slevels/%s", gmURL, level)}, &v)
+
+	i.setLevelState(v)
 	return
 }
 
 //RestartLevel restarts the current level. An instanceID needs to already set.
 func (i *Instance) RestartLevel() (v LevelState) {
-	i.doHTTP("POST", fmt.Sprintf("%sinstances/%d/restart", gmURL, i.instanceID), nil, &v)
+	v, err := i.RestartLevelCtx(context.Background())
+	i.setErr(err)
+	return
+}
 
-	if v.InstanceID != 0 {
-		i.setState(v.InstanceID, v.Account, v.Venues[0], v.Symbols[0])
-	}
+//RestartLevelCtx works like RestartLevel() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) RestartLevelCtx(ctx context.Context) (v LevelState, err error) {
+	err = i.doHTTP(ctx, request{endpoint: "restart level", method: "POST", url: fmt.Sprintf("%sinstances/%d/restart", gmURL, i.GetInstanceID())}, &v)
+
+	i.setLevelState(v)
 	return
 }
 
 //StopLevel stops the current level and clears the instance state. An instanceID needs to already set.
 func (i *Instance) StopLevel() (v ErrorResult) {
-	i.doHTTP("POST", fmt.Sprintf("%sinstances/%d/stop", gmURL, i.instanceID), nil, &v)
+	v, err := i.StopLevelCtx(context.Background())
+	i.setErr(err)
+	return
+}
+
+//StopLevelCtx works like StopLevel() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) StopLevelCtx(ctx context.Context) (v ErrorResult, err error) {
+	instanceID := i.GetInstanceID()
+	err = i.doHTTP(ctx, request{endpoint: "stop level", method: "POST", url: fmt.Sprintf("%sinstances/%d/stop", gmURL, instanceID)}, &v)
 
-	i.setState(i.instanceID, "", "", "")
+	i.setState(instanceID, "", "", "")
 	return
 }
 
 //ResumeLevel resumes the current level (and sets the instance state) and returns the levelstate. An instanceID needs to already set.
 func (i *Instance) ResumeLevel() (v LevelState) {
-	i.doHTTP("POST", fmt.Sprintf("%sinstances/%d/resume", gmURL, i.instanceID), nil, &v)
+	v, err := i.ResumeLevelCtx(context.Background())
+	i.setErr(err)
+	return
+}
 
-	if v.InstanceID != 0 {
-		i.setState(v.InstanceID, v.Account, v.Venues[0], v.Symbols[0])
-	}
+//ResumeLevelCtx works like ResumeLevel() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) ResumeLevelCtx(ctx context.Context) (v LevelState, err error) {
+	err = i.doHTTP(ctx, request{endpoint: "resume level", method: "POST", url: fmt.Sprintf("%sinstances/%d/resume", gmURL, i.GetInstanceID())}, &v)
+
+	i.setLevelState(v)
 	return
 }
 
 //JudgeLevel tells the API to judge the current level and clears the instance state. An instanceID needs to already set.
 func (i *Instance) JudgeLevel() (v ErrorResult) {
-	i.doHTTP("POST", fmt.Sprintf("%sinstances/%d/judge", gmURL, i.instanceID), nil, &v)
+	v, err := i.JudgeLevelCtx(context.Background())
+	i.setErr(err)
+	return
+}
+
+//JudgeLevelCtx works like JudgeLevel() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) JudgeLevelCtx(ctx context.Context) (v ErrorResult, err error) {
+	instanceID := i.GetInstanceID()
+	err = i.doHTTP(ctx, request{endpoint: "judge level", method: "POST", url: fmt.Sprintf("%sinstances/%d/judge", gmURL, instanceID)}, &v)
+
+	i.setState(instanceID, "", "", "")
+	return
+}
+
+//Judgement is the evidence submitted to the judge of a level, e.g. the account found in Making Amends.
+type Judgement struct {
+	Account          string `json:"account"`
+	ExplanationLink  string `json:"explanation_link"`
+	ExecutiveSummary string `json:"executive_summary"`
+}
+
+//SubmitJudgement submits evidence to the judge of the current level. Unlike JudgeLevel it keeps the instance state,
+//because a rejected submission can be corrected and submitted again. An instanceID needs to already set.
+func (i *Instance) SubmitJudgement(j Judgement) (v ErrorResult) {
+	v, err := i.SubmitJudgementCtx(context.Background(), j)
+	i.setErr(err)
+	return
+}
+
+//SubmitJudgementCtx works like SubmitJudgement() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) SubmitJudgementCtx(ctx context.Context, j Judgement) (v ErrorResult, err error) {
+	r := request{endpoint: "submit judgement", method: "POST", url: fmt.Sprintf("%sinstances/%d/judge", gmURL, i.GetInstanceID())}
+	if r.body, err = json.Marshal(j); err == nil {
+		err = i.doHTTP(ctx, r, &v)
+	}
+	return
+}
+
+//Level is a level that can be started with StartLevel.
+type Level struct {
+	Name string `json:"name"`
+}
+
+type levelsResult struct {
+	ErrorResult
+	Levels []Level `json:"levels"`
+}
+
+//Levels returns the list of levels.
+func (i *Instance) Levels() []Level {
+	v, err := i.LevelsCtx(context.Background())
+	i.setErr(err)
+	return v
+}
+
+//LevelsCtx works like Levels() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) LevelsCtx(ctx context.Context) ([]Level, error) {
+	var v levelsResult
+	err := i.doHTTP(ctx, request{endpoint: "levels", method: "GET", idempotent: true, url: gmURL + "levels"}, &v)
+	return v.Levels, err
+}
+
+//Flash contains the messages the GameMaster shows on top of a level, keyed by severity.
+type Flash struct {
+	Info    string `json:"info,omitempty"`
+	Warning string `json:"warning,omitempty"`
+	Danger  string `json:"danger,omitempty"`
+}
+
+//InstanceDetails shows the progress of a level in trading days.
+type InstanceDetails struct {
+	TradingDay       int `json:"tradingDay"`
+	EndOfTheWorldDay int `json:"endOfTheWorldDay"`
+}
+
+//InstanceStatus is the state of a level instance as returned by the GameMaster-API.
+type InstanceStatus struct {
+	ErrorResult
+	ID      int             `json:"id"`
+	Done    bool            `json:"done"`
+	State   string          `json:"state"`
+	Flash   Flash           `json:"flash"`
+	Details InstanceDetails `json:"details"`
+}
+
+//InstanceStatus returns the status of the current level instance. An instanceID needs to already set.
+func (i *Instance) InstanceStatus() (v InstanceStatus) {
+	v, err := i.InstanceStatusCtx(context.Background())
+	i.setErr(err)
+	return
+}
+
+//InstanceStatusCtx works like InstanceStatus() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) InstanceStatusCtx(ctx context.Context) (InstanceStatus, error) {
+	return i.instanceStatus(ctx, i.GetInstanceID())
+}
 
-	i.setState(i.instanceID, "", "", "")
+func (i *Instance) instanceStatus(ctx context.Context, instanceID int) (v InstanceStatus, err error) {
+	err = i.doHTTP(ctx, request{endpoint: "instance status", method: "GET", idempotent: true, url: fmt.Sprintf("%sinstances/%d", gmURL, instanceID)}, &v)
 	return
 }
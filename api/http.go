@@ -1,11 +1,14 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
-	"net/http/httputil"
+	"strconv"
+	"time"
 )
 
 var (
@@ -18,8 +21,8 @@ type orderRequest struct {
 	Symbol    string         `json:"symbol"`
 	Price     int            `json:"price"`
 	Quantity  int            `json:"qty"`
-	Direction orderDirection `json:"direction"`
-	OrderType orderType      `json:"orderType"`
+	Direction OrderDirection `json:"direction"`
+	OrderType OrderType      `json:"orderType"`
 }
 
 type allOrdersStatusResult struct {
@@ -35,7 +38,33 @@ type availableStocksResult struct {
 
 type apiResponse interface {
 	isOk() bool
-	err(status string) error
+	message() string
+}
+
+//request describes a single API call.
+type request struct {
+	endpoint string //name of the call used in errors, e.g. "quote"
+	method   string
+	url      string
+	body     []byte
+	venue    string
+	symbol   string
+	id       uint64 //correlates the log records of all attempts, see logs.nextID
+	attempt  int
+
+	//idempotent calls may be retried freely. Other calls are only retried if reconcile reports that the failed attempt had no effect.
+	idempotent bool
+	reconcile  func(ctx context.Context, p RetryPolicy) (done bool, err error)
+}
+
+//logAttrs returns the attributes identifying r in log records, followed by attrs.
+func (r request) logAttrs(attrs ...slog.Attr) []slog.Attr {
+	return append([]slog.Attr{slog.Uint64("request", r.id), slog.String("endpoint", r.endpoint)}, attrs...)
+}
+
+//apiError creates an *APIError for the request from the server response.
+func (r request) apiError(statusCode int, status string, v apiResponse) *APIError {
+	return &APIError{statusCode, status, r.endpoint, r.venue, r.symbol, v.message()}
 }
 
 //ErrorResult gets returned inside every response of an API method.
@@ -53,34 +82,71 @@ func (e ErrorResult) isOk() bool {
 	return e.Ok
 }
 
-func (e ErrorResult) err(status string) error {
-	str := e.Message
-	if str == "" {
-		str = "no error message"
-	}
-	return fmt.Errorf("API: %s; %s", status, str)
+func (e ErrorResult) message() string {
+	return e.Message
 }
 
-func (i *Instance) doHTTP(httpVerb string, url string, body io.Reader, v apiResponse) {
-	req, err := http.NewRequest(httpVerb, url, body)
-	req.Header = i.h
+//doHTTPOnce performs a single attempt of an API call and decodes the response into v.
+//The request is aborted as soon as ctx is done. The returned error is only about this call, it doesn't touch the instance error.
+//Errors are either an *APIError, a *DecodeError or a *TransportError.
+func (i *Instance) doHTTPOnce(ctx context.Context, r request, v apiResponse) error {
+	if err := i.limiter.wait(ctx, r); err != nil {
+		return &TransportError{r.endpoint, r.url, err}
+	}
 
-	if i.debug && !i.setErr(err) {
-		reqDump, err := httputil.DumpRequestOut(req, true)
-		i.setErr(err)
-		fmt.Printf("request: %s", reqDump)
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req, err := http.NewRequest(r.method, r.url, body)
+	if err != nil {
+		return &TransportError{r.endpoint, r.url, err}
+	}
+	req = req.WithContext(ctx)
+	req.Header = i.header()
+	if span := SpanFromContext(ctx); span != nil {
+		req.Header.Set("traceparent", span.traceparent())
 	}
 
+	attrs := r.logAttrs(slog.Int("attempt", r.attempt))
+	i.log(ctx, SubsystemHTTP, slog.LevelDebug, "http request",
+		append(attrs, slog.String("method", r.method), slog.String("url", r.url))...)
+	trace := i.logger(ctx, SubsystemHTTP, LevelTrace) != nil
+	if trace {
+		i.log(ctx, SubsystemHTTP, LevelTrace, "http request body",
+			append(attrs, slog.Any("header", redact(req.Header)), slog.String("body", string(r.body)))...)
+	}
+
+	start := time.Now()
 	res, err := i.c.Do(req)
-	if i.debug && !i.setErr(err) {
-		resDump, err := httputil.DumpResponse(res, true)
-		i.setErr(err)
-		fmt.Printf("response: %s", resDump)
+	i.metrics.latency.Observe(time.Since(start).Seconds(), r.endpoint)
+	if err != nil {
+		i.metrics.requests.Inc(r.endpoint, "error")
+		return &TransportError{r.endpoint, r.url, err}
 	}
+	defer res.Body.Close()
+	i.metrics.requests.Inc(r.endpoint, strconv.Itoa(res.StatusCode))
+	i.log(ctx, SubsystemHTTP, slog.LevelDebug, "http response",
+		append(attrs, slog.Int("status", res.StatusCode), slog.Duration("duration", time.Since(start)))...)
 
-	i.setErr(json.NewDecoder(res.Body).Decode(v))
+	var resBody io.Reader = res.Body
+	if trace {
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			return &TransportError{r.endpoint, r.url, err}
+		}
+		i.log(ctx, SubsystemHTTP, LevelTrace, "http response body",
+			append(attrs, slog.Any("header", res.Header), slog.String("body", string(b)))...)
+		resBody = bytes.NewReader(b)
+	}
 
-	if !v.isOk() || res.StatusCode != 200 {
-		i.setErr(v.err(res.Status))
+	decodeErr := json.NewDecoder(resBody).Decode(v)
+	if res.StatusCode != http.StatusOK || (decodeErr == nil && !v.isOk()) {
+		return r.apiError(res.StatusCode, res.Status, v)
+	}
+	if decodeErr != nil {
+		return &DecodeError{r.endpoint, res.StatusCode, decodeErr}
 	}
+	i.risk.observe(v)
+	return nil
 }
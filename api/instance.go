@@ -2,28 +2,43 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"sync"
 )
 
 //Instance is the basic unit of operation for all API actions.
 type Instance struct {
-	debug bool
-	//not protected by mutex because they don't get touched by us.
-	c http.Client
-	h http.Header
+	//not protected by mutex because they don't change after New.
+	c       *http.Client
+	logs    *logs
+	metrics *clientMetrics
+	tracer  *Tracer
 
 	//each protected by it's own mutex
-	err err
+	err     err
+	limiter *rateLimiter
+	risk    *riskGate
+	placing *placing
 	state
 }
 
 type state struct {
 	sync.RWMutex
-	instanceID int
-	account    string
-	venue      string
-	symbol     string
+	instanceID   int
+	account      string
+	venue        string
+	symbol       string
+	h            http.Header //copied for every request, see header()
+	retry        RetryPolicy
+	streamConfig StreamConfig
+}
+
+//GetInstanceID gets the current instanceID of an instance, 0 if none is set.
+func (i *Instance) GetInstanceID() int {
+	i.RLock()
+	defer i.RUnlock()
+	return i.instanceID
 }
 
 //GetAccount gets the current account of an instance.
@@ -47,9 +62,11 @@ func (i *Instance) GetSymbol() string {
 	return i.symbol
 }
 
-//SetAPIKey changes the API-Key of an instance.
+//SetAPIKey changes the API-Key of an instance. Requests already under way keep the old one.
 func (i *Instance) SetAPIKey(apiKey string) {
+	i.Lock()
 	i.h.Set("X-Starfighter-Authorization", apiKey)
+	i.Unlock()
 }
 
 //SetInstanceID changes the current instanceID. Waits until all current read operations are completed and blocks while changing.
@@ -90,35 +107,50 @@ func (i *Instance) setState(instanceID int, account, venue, symbol string) {
 	i.Unlock()
 }
 
-//New creates a new API instance without any presets.
-func New(apiKey string) (i *Instance) {
+//New creates a new API instance without any presets. Options configure its HTTP transport, see Option.
+func New(apiKey string, opts ...Option) (i *Instance) {
+	o := options{header: http.Header{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
 	i = &Instance{}
-	i.c = http.Client{}
-	i.h = http.Header{}
+	i.c = o.client()
+	i.logs = newLogs(o)
+	i.metrics = newClientMetrics(o.metrics)
+	i.tracer = o.tracer
+	i.h = o.header
+	i.retry = DefaultRetryPolicy
+	i.streamConfig = DefaultStreamConfig
+	i.limiter = newRateLimiter()
+	i.risk = newRiskGate()
+	i.placing = newPlacing()
 	i.SetAPIKey(apiKey)
 	return
 }
 
 //NewInstance creates a new API instance and sets defaults.
 //Shorcut for New() -> SetAccount() -> SetVenue() -> SetSymbol()
-func NewInstance(apiKey, account, venue, symbol string) (i *Instance) {
-	i = New(apiKey)
+func NewInstance(apiKey, account, venue, symbol string, opts ...Option) (i *Instance) {
+	i = New(apiKey, opts...)
 	i.setState(0, account, venue, symbol)
 	return
 }
 
 //NewTestInstance calls NewInstance with useful presets for package testing.
-func NewTestInstance() *Instance {
-	return NewInstance("", "EXB123456", "TESTEX", "FOOBAR")
+func NewTestInstance(opts ...Option) *Instance {
+	return NewInstance("", "EXB123456", "TESTEX", "FOOBAR", opts...)
 }
 
 //Heartbeat checks if the API is up and returns true if it is.
 //See: https://starfighter.readme.io/docs/heartbeat for further info about API call.
-func (i *Instance) Heartbeat() ErrorResult {
-	return i.heartbeat("heartbeat")
+func (i *Instance) Heartbeat() (v ErrorResult) {
+	v, err := i.HeartbeatCtx(context.Background())
+	i.setErr(err)
+	return
 }
 
-func (i *Instance) heartbeat(urlExtension string) (v ErrorResult) {
-	i.doHTTP("GET", baseURL+urlExtension, nil, &v)
+//HeartbeatCtx works like Heartbeat() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) HeartbeatCtx(ctx context.Context) (v ErrorResult, err error) {
+	err = i.doHTTP(ctx, request{endpoint: "heartbeat", method: "GET", idempotent: true, url: baseURL + "heartbeat"}, &v)
 	return
 }
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+)
+
+//Listing is a handle for trading a single stock on a venue. It offers the Trade API calls of an Instance
+//but takes venue and symbol from the handle instead of the instance state, so goroutines can trade several stocks
+//through one Instance without calling SetVenue and SetSymbol. Account, API key, retry policy, rate limits and
+//risk limits are shared with the instance. A Listing is cheap to create and safe for concurrent use.
+type Listing struct {
+	i      *Instance
+	venue  string
+	symbol string
+}
+
+//Trader places and cancels orders in a single stock. *Listing implements it for live trading; simulated venues
+//implement it as well, so the same strategy code runs against the exchange and in a backtest.
+type Trader interface {
+	Venue() string
+	Symbol() string
+	NewOrderCtx(ctx context.Context, price int, quantity int, direction OrderDirection, orderType OrderType) (Order, error)
+	CancelOrderCtx(ctx context.Context, ID int) (Order, error)
+	OrderStatusCtx(ctx context.Context, ID int) (Order, error)
+}
+
+//Listing returns a handle for trading symbol on venue.
+func (i *Instance) Listing(venue, symbol string) *Listing {
+	return &Listing{i, venue, symbol}
+}
+
+//LevelListings returns a handle for every stock on every venue of a level, in the order the level lists them.
+func (i *Instance) LevelListings(v LevelState) []*Listing {
+	var listings []*Listing
+	for _, venue := range v.Venues {
+		for _, symbol := range v.Symbols {
+			listings = append(listings, i.Listing(venue, symbol))
+		}
+	}
+	return listings
+}
+
+//Venue returns the venue of the listing.
+func (l *Listing) Venue() string {
+	return l.venue
+}
+
+//Symbol returns the stock symbol of the listing.
+func (l *Listing) Symbol() string {
+	return l.symbol
+}
+
+//Instance returns the instance the listing was created from.
+func (l *Listing) Instance() *Instance {
+	return l.i
+}
+
+//VenueHeartbeat works like Instance.VenueHeartbeat() for the venue of the listing.
+func (l *Listing) VenueHeartbeat() (v ErrorResult) {
+	v, err := l.VenueHeartbeatCtx(context.Background())
+	l.i.setErr(err)
+	return
+}
+
+//VenueHeartbeatCtx works like VenueHeartbeat() but honors the cancellation of ctx and returns the error of this call.
+func (l *Listing) VenueHeartbeatCtx(ctx context.Context) (ErrorResult, error) {
+	return l.i.venueHeartbeat(ctx, l.venue)
+}
+
+//AvailableStocks works like Instance.AvailableStocks() for the venue of the listing.
+func (l *Listing) AvailableStocks() []Stock {
+	v, err := l.AvailableStocksCtx(context.Background())
+	l.i.setErr(err)
+	return v
+}
+
+//AvailableStocksCtx works like AvailableStocks() but honors the cancellation of ctx and returns the error of this call.
+func (l *Listing) AvailableStocksCtx(ctx context.Context) ([]Stock, error) {
+	return l.i.availableStocks(ctx, l.venue)
+}
+
+//Quote works like Instance.Quote() for the stock of the listing.
+func (l *Listing) Quote() (v Quote) {
+	v, err := l.QuoteCtx(context.Background())
+	l.i.setErr(err)
+	return
+}
+
+//QuoteCtx works like Quote() but honors the cancellation of ctx and returns the error of this call.
+func (l *Listing) QuoteCtx(ctx context.Context) (Quote, error) {
+	return l.i.quote(ctx, l.venue, l.symbol)
+}
+
+//Orderbook works like Instance.Orderbook() for the stock of the listing.
+func (l *Listing) Orderbook() (v Orderbook) {
+	v, err := l.OrderbookCtx(context.Background())
+	l.i.setErr(err)
+	return
+}
+
+//OrderbookCtx works like Orderbook() but honors the cancellation of ctx and returns the error of this call.
+func (l *Listing) OrderbookCtx(ctx context.Context) (Orderbook, error) {
+	return l.i.orderbook(ctx, l.venue, l.symbol)
+}
+
+//NewOrder works like Instance.NewOrder() for the stock of the listing, using the current account of the instance.
+func (l *Listing) NewOrder(price int, quantity int, direction OrderDirection, orderType OrderType) (v Order) {
+	v, err := l.NewOrderCtx(context.Background(), price, quantity, direction, orderType)
+	l.i.setErr(err)
+	return
+}
+
+//NewOrderCtx works like NewOrder() but honors the cancellation of ctx and returns the error of this call.
+func (l *Listing) NewOrderCtx(ctx context.Context, price int, quantity int, direction OrderDirection, orderType OrderType) (Order, error) {
+	return l.i.newOrder(ctx, orderRequest{l.i.GetAccount(), l.venue, l.symbol, price, quantity, direction, orderType})
+}
+
+//CancelOrder works like Instance.CancelOrder() for an order in the stock of the listing.
+func (l *Listing) CancelOrder(ID int) (v Order) {
+	v, err := l.CancelOrderCtx(context.Background(), ID)
+	l.i.setErr(err)
+	return
+}
+
+//CancelOrderCtx works like CancelOrder() but honors the cancellation of ctx and returns the error of this call.
+func (l *Listing) CancelOrderCtx(ctx context.Context, ID int) (Order, error) {
+	return l.i.cancelOrder(ctx, l.venue, l.symbol, ID)
+}
+
+//OrderStatus works like Instance.OrderStatus() for an order in the stock of the listing.
+func (l *Listing) OrderStatus(ID int) (v Order) {
+	v, err := l.OrderStatusCtx(context.Background(), ID)
+	l.i.setErr(err)
+	return
+}
+
+//OrderStatusCtx works like OrderStatus() but honors the cancellation of ctx and returns the error of this call.
+func (l *Listing) OrderStatusCtx(ctx context.Context, ID int) (Order, error) {
+	return l.i.orderStatus(ctx, l.venue, l.symbol, ID)
+}
+
+//AccountOrderStatus works like Instance.AccountOrderStatus() for the venue of the listing.
+func (l *Listing) AccountOrderStatus() []Order {
+	v, err := l.AccountOrderStatusCtx(context.Background())
+	l.i.setErr(err)
+	return v
+}
+
+//AccountOrderStatusCtx works like AccountOrderStatus() but honors the cancellation of ctx and returns the error of this call.
+func (l *Listing) AccountOrderStatusCtx(ctx context.Context) ([]Order, error) {
+	return l.i.accountOrderStatus(ctx, l.venue, l.i.GetAccount())
+}
+
+//StockOrderStatus works like Instance.StockOrderStatus() for the stock of the listing.
+func (l *Listing) StockOrderStatus() []Order {
+	v, err := l.StockOrderStatusCtx(context.Background())
+	l.i.setErr(err)
+	return v
+}
+
+//StockOrderStatusCtx works like StockOrderStatus() but honors the cancellation of ctx and returns the error of this call.
+func (l *Listing) StockOrderStatusCtx(ctx context.Context) ([]Order, error) {
+	return l.i.stockOrderStatus(ctx, l.venue, l.i.GetAccount(), l.symbol)
+}
+
+//Quotes returns a stream of the quotes of the stock of the listing, see Instance.Quotes().
+func (l *Listing) Quotes() *QuoteStream {
+	return l.QuotesCtx(context.Background())
+}
+
+//QuotesCtx works like Quotes() but the stream also stops when ctx is done.
+func (l *Listing) QuotesCtx(ctx context.Context) *QuoteStream {
+	return l.i.quotes(ctx, l.venue, l.symbol, l.i.GetAccount())
+}
+
+//Executions returns a stream of the executions of the current account in the stock of the listing, see Instance.Executions().
+func (l *Listing) Executions() *ExecutionStream {
+	return l.ExecutionsCtx(context.Background())
+}
+
+//ExecutionsCtx works like Executions() but the stream also stops when ctx is done.
+func (l *Listing) ExecutionsCtx(ctx context.Context) *ExecutionStream {
+	return l.i.executions(ctx, l.venue, l.symbol, l.i.GetAccount())
+}
+
+//TrackOrderBook works like Instance.TrackOrderBook() for the stock of the listing.
+func (l *Listing) TrackOrderBook(ctx context.Context, c TrackerConfig) (*OrderBookTracker, error) {
+	return l.i.trackOrderBook(ctx, l.venue, l.symbol, c)
+}
+
+//NewOrderManager works like Instance.NewOrderManager() for the venue of the listing; Submit places orders in its stock.
+func (l *Listing) NewOrderManager(ctx context.Context, c OrderManagerConfig) *OrderManager {
+	return l.i.newOrderManager(ctx, l.i.GetAccount(), l.venue, l.symbol, c)
+}
+
+//Exposure returns the position and open orders of the current account in the stock of the listing, see Instance.Exposure().
+func (l *Listing) Exposure() Exposure {
+	return l.i.Exposure(l.venue, l.symbol)
+}
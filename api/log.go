@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync/atomic"
+)
+
+//Subsystem names a part of the client that logs on its own level.
+type Subsystem string
+
+//The subsystems of an instance. Every log record carries its subsystem in the "subsystem" attribute.
+const (
+	SubsystemHTTP Subsystem = "http" //API calls: requests, responses, retries
+	SubsystemWS   Subsystem = "ws"   //websocket streams: connections and frames
+	SubsystemAPI  Subsystem = "api"  //errors set on the instance, see GetErr
+)
+
+var subsystems = []Subsystem{SubsystemHTTP, SubsystemWS, SubsystemAPI}
+
+//LevelTrace is the level of wire traces: request and response bodies, headers and websocket frames.
+const LevelTrace = slog.LevelDebug - 4
+
+//redacted replaces the API key in logged headers.
+const redacted = "REDACTED"
+
+//WithLogger makes the instance log to l. Without a logger nothing is logged until Debug is called.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+//WithLogLevel sets the minimum level of a subsystem, slog.LevelInfo by default. The handler of the logger filters too.
+func WithLogLevel(s Subsystem, level slog.Level) Option {
+	return func(o *options) {
+		if o.levels == nil {
+			o.levels = map[Subsystem]slog.Level{}
+		}
+		o.levels[s] = level
+	}
+}
+
+//logs holds the logger of an instance and the levels of its subsystems. Both can change while the instance is in use.
+type logs struct {
+	l      atomic.Pointer[slog.Logger]
+	levels map[Subsystem]*slog.LevelVar //fixed set of keys, see subsystems
+	ids    atomic.Uint64                //last request ID
+}
+
+//nextID returns the ID that correlates the log records of an API call or stream.
+func (g *logs) nextID() uint64 {
+	return g.ids.Add(1)
+}
+
+func newLogs(o options) *logs {
+	g := &logs{levels: map[Subsystem]*slog.LevelVar{}}
+	for _, s := range subsystems {
+		v := &slog.LevelVar{}
+		if level, ok := o.levels[s]; ok {
+			v.Set(level)
+		}
+		g.levels[s] = v
+	}
+	if o.logger != nil {
+		g.l.Store(o.logger)
+	}
+	return g
+}
+
+//SetLogLevel changes the minimum level of a subsystem.
+func (i *Instance) SetLogLevel(s Subsystem, level slog.Level) {
+	if v, ok := i.logs.levels[s]; ok {
+		v.Set(level)
+	}
+}
+
+//Debug enables comprehensive logging for the instance: all subsystems log at LevelTrace and, if the instance has no
+//logger, a text logger writes to stdout. The API key is redacted.
+func (i *Instance) Debug() {
+	for _, v := range i.logs.levels {
+		v.Set(LevelTrace)
+	}
+	if i.logs.l.Load() == nil {
+		i.logs.l.CompareAndSwap(nil, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: LevelTrace})))
+	}
+}
+
+//logger returns the logger for a record of subsystem s at level, nil if it would be dropped.
+func (i *Instance) logger(ctx context.Context, s Subsystem, level slog.Level) *slog.Logger {
+	if level < i.logs.levels[s].Level() {
+		return nil
+	}
+	l := i.logs.l.Load()
+	if l == nil || !l.Enabled(ctx, level) {
+		return nil
+	}
+	return l
+}
+
+//log writes a record of subsystem s. Callers that compute expensive attributes check logger() first.
+func (i *Instance) log(ctx context.Context, s Subsystem, level slog.Level, msg string, attrs ...slog.Attr) {
+	if l := i.logger(ctx, s, level); l != nil {
+		l.LogAttrs(ctx, level, msg, append(attrs, slog.String("subsystem", string(s)))...)
+	}
+}
+
+//redact returns a copy of h without the API key.
+func redact(h http.Header) http.Header {
+	h = h.Clone()
+	if h.Get("X-Starfighter-Authorization") != "" {
+		h.Set("X-Starfighter-Authorization", redacted)
+	}
+	return h
+}
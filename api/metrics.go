@@ -0,0 +1,367 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//DefaultBuckets are the buckets of HTTP latency histograms in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+//Metrics is a registry of counters, gauges and histograms that is exposed in the Prometheus text format.
+//Every instance collects its client metrics in one (see Instance.Metrics), strategies can add their own.
+//Metrics is an http.Handler serving the metrics, e.g. with http.ListenAndServe("localhost:9100", i.Metrics()).
+type Metrics struct {
+	mu       sync.Mutex
+	families map[string]*family
+	streams  map[streamer]string //open streams by kind, for the backlog gauge
+}
+
+//NewMetrics returns an empty registry, see WithMetrics.
+func NewMetrics() *Metrics {
+	return &Metrics{families: map[string]*family{}, streams: map[streamer]string{}}
+}
+
+//WithMetrics makes the instance collect its metrics in m, so several instances can share one registry.
+func WithMetrics(m *Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+//Metrics returns the registry of the instance.
+func (i *Instance) Metrics() *Metrics {
+	return i.metrics.m
+}
+
+//family is a metric with all its series.
+type family struct {
+	name    string
+	help    string
+	kind    string //counter, gauge or histogram
+	labels  []string
+	buckets []float64
+	series  map[string]*series //by label values joined with \xff
+}
+
+type series struct {
+	values []string
+	value  float64  //counter or gauge value, sum of a histogram
+	counts []uint64 //histogram observations per bucket, the last one is +Inf
+	count  uint64
+}
+
+//family returns the family called name, registering it if it's new. It panics if name is registered differently.
+func (m *Metrics) family(name, help, kind string, buckets []float64, labels []string) *family {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.families[name]; ok {
+		if f.kind != kind || len(f.labels) != len(labels) {
+			panic(fmt.Sprintf("api: metric %s registered as %s with %d labels", name, f.kind, len(f.labels)))
+		}
+		return f
+	}
+	f := &family{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: map[string]*series{}}
+	m.families[name] = f
+	return f
+}
+
+//get returns the series of f with the label values, creating it if it's new. m.mu must be held.
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("api: metric %s has %d labels, got %d values", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if f.kind == "histogram" {
+			s.counts = make([]uint64, len(f.buckets)+1)
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+//Counter is a metric that only goes up.
+type Counter struct {
+	m *Metrics
+	f *family
+}
+
+//Counter returns the counter called name with the given label names, registering it if it's new.
+func (m *Metrics) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{m, m.family(name, help, "counter", nil, labels)}
+}
+
+//Add adds v to the series with the label values. Negative values are ignored.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		return
+	}
+	c.m.mu.Lock()
+	c.f.get(values).value += v
+	c.m.mu.Unlock()
+}
+
+//Inc adds 1 to the series with the label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+//Gauge is a metric that can go up and down.
+type Gauge struct {
+	m *Metrics
+	f *family
+}
+
+//Gauge returns the gauge called name with the given label names, registering it if it's new.
+func (m *Metrics) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{m, m.family(name, help, "gauge", nil, labels)}
+}
+
+//Set sets the series with the label values to v.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.m.mu.Lock()
+	g.f.get(values).value = v
+	g.m.mu.Unlock()
+}
+
+//Add adds v to the series with the label values.
+func (g *Gauge) Add(v float64, values ...string) {
+	g.m.mu.Lock()
+	g.f.get(values).value += v
+	g.m.mu.Unlock()
+}
+
+//Histogram counts observations in buckets.
+type Histogram struct {
+	m *Metrics
+	f *family
+}
+
+//Histogram returns the histogram called name with the given buckets (upper bounds in increasing order, DefaultBuckets
+//if nil) and label names, registering it if it's new.
+func (m *Metrics) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &Histogram{m, m.family(name, help, "histogram", buckets, labels)}
+}
+
+//Observe adds an observation of v to the series with the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	k := sort.SearchFloat64s(h.f.buckets, v)
+	h.m.mu.Lock()
+	s := h.f.get(values)
+	s.counts[k]++
+	s.count++
+	s.value += v
+	h.m.mu.Unlock()
+}
+
+//ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+//WriteTo writes the metrics in the Prometheus text format to w, sorted by name and label values.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.collect()
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	m.mu.Lock()
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m.families[name].write(bw)
+	}
+	m.mu.Unlock()
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (f *family) write(w *bufio.Writer) {
+	if len(f.series) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escape(f.help, false), f.name, f.kind)
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelString(s.values, ""), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for k, le := range f.buckets {
+			cumulative += s.counts[k]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s.values, formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s.values, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labelString(s.values, ""), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labelString(s.values, ""), s.count)
+	}
+}
+
+//labelString formats the labels of a series, with an le label for histogram buckets if le isn't empty.
+func (f *family) labelString(values []string, le string) string {
+	if len(values) == 0 && le == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for k, v := range values {
+		if k > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", f.labels[k], escape(v, true))
+	}
+	if le != "" {
+		if len(values) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "le=\"%s\"", le)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+//escape escapes backslashes and newlines, and double quotes in label values.
+func escape(s string, quotes bool) string {
+	s = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+	if quotes {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+//clientMetrics are the metrics an instance collects about itself.
+type clientMetrics struct {
+	m          *Metrics
+	requests   *Counter
+	latency    *Histogram
+	errors     *Counter
+	orders     *Counter
+	fills      *Counter
+	shares     *Counter
+	reconnects *Counter
+	messages   *Counter
+	dropped    *Counter
+	backlog    *Gauge
+}
+
+func newClientMetrics(m *Metrics) *clientMetrics {
+	if m == nil {
+		m = NewMetrics()
+	}
+	return &clientMetrics{
+		m:          m,
+		requests:   m.Counter("stockfighter_http_requests_total", "HTTP requests by endpoint and status code, \"error\" if there was no response.", "endpoint", "code"),
+		latency:    m.Histogram("stockfighter_http_request_duration_seconds", "Latency of HTTP requests by endpoint.", nil, "endpoint"),
+		errors:     m.Counter("stockfighter_errors_total", "Failed requests and stream connections by endpoint and error type (api, transport, decode, risk).", "endpoint", "type"),
+		orders:     m.Counter("stockfighter_orders_total", "Orders by event: placed, rejected, cancelled, filled (as seen on execution streams).", "event"),
+		fills:      m.Counter("stockfighter_fills_total", "Fills seen on execution streams.", "venue", "symbol"),
+		shares:     m.Counter("stockfighter_filled_shares_total", "Shares filled as seen on execution streams.", "venue", "symbol"),
+		reconnects: m.Counter("stockfighter_ws_reconnects_total", "Websocket reconnects by stream.", "stream"),
+		messages:   m.Counter("stockfighter_ws_messages_total", "Websocket messages received by stream.", "stream"),
+		dropped:    m.Counter("stockfighter_ws_dropped_total", "Stream values discarded by the overflow policy.", "stream"),
+		backlog:    m.Gauge("stockfighter_stream_backlog", "Values buffered in the open streams, waiting to be received.", "stream"),
+	}
+}
+
+//execution counts the fill of an execution and the order if it is filled completely.
+func (c *clientMetrics) execution(e Execution) {
+	c.fills.Inc(e.Order.Venue, e.Order.Symbol)
+	c.shares.Add(float64(e.Filled), e.Order.Venue, e.Order.Symbol)
+	if !e.Order.Open && e.Order.TotalFilled == e.Order.OriginalQuantity {
+		c.orders.Inc("filled")
+	}
+}
+
+//errorType classifies err for the errors counter.
+func errorType(err error) string {
+	var apiErr *APIError
+	var transportErr *TransportError
+	var decodeErr *DecodeError
+	var riskErr *RiskError
+	switch {
+	case errors.As(err, &riskErr):
+		return "risk"
+	case errors.As(err, &apiErr):
+		return "api"
+	case errors.As(err, &decodeErr):
+		return "decode"
+	case errors.As(err, &transportErr):
+		return "transport"
+	}
+	return "other"
+}
+
+//open registers a stream for the backlog gauge until it is closed.
+func (m *Metrics) open(s streamer, kind string) {
+	m.mu.Lock()
+	m.streams[s] = kind
+	m.mu.Unlock()
+}
+
+func (m *Metrics) closed(s streamer) {
+	m.mu.Lock()
+	delete(m.streams, s)
+	m.mu.Unlock()
+}
+
+//collect updates the metrics that are sampled at scrape time.
+func (m *Metrics) collect() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.families["stockfighter_stream_backlog"]
+	if !ok {
+		return
+	}
+	for _, s := range f.series {
+		s.value = 0
+	}
+	for s, kind := range m.streams {
+		f.get([]string{kind}).value += float64(s.backlog())
+	}
+}
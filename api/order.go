@@ -1,25 +1,30 @@
 package api
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 )
 
-type orderType string
-type orderDirection string
+//OrderType is the type of an order: Limit, Market, FillOrKill or ImmediateOrCancel.
+type OrderType string
+
+//OrderDirection is the side of an order: Buy or Sell.
+type OrderDirection string
 
 //Constants used for order creation.
 const (
-	Limit             orderType = "limit"
-	Market            orderType = "market"
-	FillOrKill        orderType = "fill-or-kill"
-	ImmediateOrCancel orderType = "immediate-or-cancel"
+	Limit             OrderType = "limit"
+	Market            OrderType = "market"
+	FillOrKill        OrderType = "fill-or-kill"
+	ImmediateOrCancel OrderType = "immediate-or-cancel"
 
-	Buy  orderDirection = "buy"
-	Sell orderDirection = "sell"
+	Buy  OrderDirection = "buy"
+	Sell OrderDirection = "sell"
 )
 
 //The Fill struct represents a (partial) fulfillment of an order.
@@ -36,10 +41,10 @@ type Order struct {
 	Venue            string         `json:"venue"`
 	Symbol           string         `json:"symbol"`
 	Price            int            `json:"price"`
-	OriginalQuantity int            `json:"orignialQty"`
+	OriginalQuantity int            `json:"originalQty"`
 	Quantity         int            `json:"qty"`
-	Direction        orderDirection `json:"direction"`
-	OrderType        orderType      `json:"orderType"`
+	Direction        OrderDirection `json:"direction"`
+	OrderType        OrderType      `json:"orderType"`
 	ID               int            `json:"id"`
 	TS               time.Time      `json:"ts"`
 	Fills            []Fill         `json:"fills"`
@@ -47,64 +52,272 @@ type Order struct {
 	Open             bool           `json:"open"`
 }
 
-//NewOrder makes a new order and submits it to the API. See the package constants for available orderDirection and orderType types.
+//NewOrder makes a new order and submits it to the API. See the package constants for available OrderDirection and OrderType values.
 //NewOrder returns a Order struct of the created order.
 //See https://starfighter.readme.io/docs/place-new-order for further info about the actual API call.
-func (i *Instance) NewOrder(price int, quantity int, direction orderDirection, orderType orderType) (v Order) {
+func (i *Instance) NewOrder(price int, quantity int, direction OrderDirection, orderType OrderType) (v Order) {
+	v, err := i.NewOrderCtx(context.Background(), price, quantity, direction, orderType)
+	i.setErr(err)
+	return
+}
+
+//NewOrderCtx works like NewOrder() but honors the cancellation of ctx and returns the error of this call.
+//A failed NewOrderCtx is never retried unless the retry policy has RetryNewOrder set.
+//Orders violating the risk limits (see SetRiskLimits) are rejected with a *RiskError without calling the API.
+func (i *Instance) NewOrderCtx(ctx context.Context, price int, quantity int, direction OrderDirection, orderType OrderType) (v Order, err error) {
 	i.RLock()
-	b, jsonErr := json.Marshal(orderRequest{i.account, i.venue, i.symbol, price, quantity, direction, orderType})
-	url := fmt.Sprintf("%svenues/%s/stocks/%s/orders", baseURL, i.venue, i.symbol)
+	o := orderRequest{i.account, i.venue, i.symbol, price, quantity, direction, orderType}
 	i.RUnlock()
 
-	if !i.setErr(jsonErr) {
-		i.doHTTP("POST", url, bytes.NewBuffer(b), &v)
+	return i.newOrder(ctx, o)
+}
+
+func (i *Instance) newOrder(ctx context.Context, o orderRequest) (v Order, err error) {
+	ctx, span := i.tracer.Start(ctx, "new order", SpanKindInternal)
+	if span != nil {
+		span.SetAttr("venue", o.Venue)
+		span.SetAttr("symbol", o.Symbol)
+		span.SetAttr("order.price", o.Price)
+		span.SetAttr("order.qty", o.Quantity)
+		span.SetAttr("order.direction", string(o.Direction))
+		span.SetAttr("order.type", string(o.OrderType))
+		defer func() {
+			if err == nil {
+				span.SetAttr("order.id", v.ID)
+				i.tracer.order(v, span)
+			}
+			span.End(err)
+		}()
+	}
+	r := request{endpoint: "new order", method: "POST", url: fmt.Sprintf("%svenues/%s/stocks/%s/orders", baseURL, o.Venue, o.Symbol), venue: o.Venue, symbol: o.Symbol}
+
+	if err = i.risk.check(&o); err != nil {
+		i.metrics.errors.Inc(r.endpoint, errorType(err))
+		i.metrics.orders.Inc("rejected")
+		return
 	}
+	defer i.risk.release(&o)
 
+	if r.body, err = json.Marshal(o); err == nil {
+		start := time.Now()
+		keep := i.getRetryPolicy().ClockSkew
+		c := i.placing.start(o, keep)
+		r.reconcile = func(ctx context.Context, p RetryPolicy) (bool, error) {
+			return i.reconcileOrder(ctx, c, start.Add(-p.ClockSkew), &v)
+		}
+		err = i.doHTTP(ctx, r, &v)
+		i.placing.done(c, v.ID, err == nil, keep)
+	}
+	if err != nil {
+		i.metrics.orders.Inc("rejected")
+	} else {
+		i.metrics.orders.Inc("placed")
+	}
 	return
 }
 
+//reconcileOrder looks for an order matching the request of c that was placed after since. If there is one it gets
+//stored in v and true is returned. Orders already returned to another NewOrder call are skipped. If another identical
+//order was placed while c was in flight, or failed shortly before, a match can't be attributed to c and reconcileOrder
+//fails instead of guessing.
+func (i *Instance) reconcileOrder(ctx context.Context, c *placeCall, since time.Time, v *Order) (bool, error) {
+	if i.placing.ambiguous(c) {
+		return false, errAmbiguousOrder
+	}
+	o := c.o
+	orders, err := i.stockOrderStatus(ctx, o.Venue, o.Account, o.Symbol)
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+	for _, x := range orders {
+		if x.Account == o.Account && x.Price == o.Price && x.OriginalQuantity == o.Quantity &&
+			x.Direction == o.Direction && x.OrderType == o.OrderType && !x.TS.Before(since) && (!found || x.ID > v.ID) &&
+			!i.placing.claimed(o, x.ID) {
+			*v = x
+			found = true
+		}
+	}
+	return found, nil
+}
+
+var errAmbiguousOrder = errors.New("identical order placed concurrently, can't reconcile")
+
+//placing tracks the NewOrder calls in flight and the outcome of recent ones per order request, so that reconcileOrder
+//never hands an order to a call that didn't place it.
+type placing struct {
+	sync.Mutex
+	orders map[orderRequest]*placed
+}
+
+type placed struct {
+	calls   map[*placeCall]struct{} //calls in flight
+	claimed map[int]time.Time       //IDs returned by recent calls and when
+	failed  time.Time               //end of the last failed call, whose order may exist nonetheless
+}
+
+type placeCall struct {
+	o         orderRequest
+	ambiguous bool //protected by placing
+}
+
+func newPlacing() *placing {
+	return &placing{orders: map[orderRequest]*placed{}}
+}
+
+//start registers a call placing o. keep is the window in which reconcileOrder may match earlier orders.
+func (p *placing) start(o orderRequest, keep time.Duration) *placeCall {
+	p.Lock()
+	defer p.Unlock()
+	x := p.orders[o]
+	if x == nil {
+		x = &placed{calls: map[*placeCall]struct{}{}, claimed: map[int]time.Time{}}
+		p.orders[o] = x
+	}
+	c := &placeCall{o: o, ambiguous: time.Since(x.failed) <= keep}
+	for other := range x.calls {
+		other.ambiguous = true
+		c.ambiguous = true
+	}
+	x.calls[c] = struct{}{}
+	return c
+}
+
+//done ends c. On success the order ID is claimed for c.
+func (p *placing) done(c *placeCall, id int, ok bool, keep time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+	now := time.Now()
+	x := p.orders[c.o]
+	delete(x.calls, c)
+	if ok {
+		x.claimed[id] = now
+	} else {
+		x.failed = now
+	}
+	for o, x := range p.orders {
+		for id, t := range x.claimed {
+			if now.Sub(t) > keep {
+				delete(x.claimed, id)
+			}
+		}
+		if len(x.calls) == 0 && len(x.claimed) == 0 && now.Sub(x.failed) > keep {
+			delete(p.orders, o)
+		}
+	}
+}
+
+func (p *placing) ambiguous(c *placeCall) bool {
+	p.Lock()
+	defer p.Unlock()
+	return c.ambiguous
+}
+
+func (p *placing) claimed(o orderRequest, id int) bool {
+	p.Lock()
+	defer p.Unlock()
+	_, ok := p.orders[o].claimed[id]
+	return ok
+}
+
 //CancelOrder cancels an order given it's id.
 //See https://starfighter.readme.io/docs/cancel-an-order for further info about the actual API call.
 func (i *Instance) CancelOrder(ID int) (v Order) {
+	v, err := i.CancelOrderCtx(context.Background(), ID)
+	i.setErr(err)
+	return
+}
+
+//CancelOrderCtx works like CancelOrder() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) CancelOrderCtx(ctx context.Context, ID int) (v Order, err error) {
 	i.RLock()
-	url := fmt.Sprintf("%svenues/%s/stocks/%s/orders/%s", baseURL, i.venue, i.symbol, strconv.Itoa(ID))
+	venue, symbol := i.venue, i.symbol
 	i.RUnlock()
 
-	i.doHTTP("DELETE", url, nil, &v)
+	return i.cancelOrder(ctx, venue, symbol, ID)
+}
+
+func (i *Instance) cancelOrder(ctx context.Context, venue, symbol string, ID int) (v Order, err error) {
+	r := request{endpoint: "cancel order", method: "DELETE", idempotent: true, url: fmt.Sprintf("%svenues/%s/stocks/%s/orders/%s", baseURL, venue, symbol, strconv.Itoa(ID)), venue: venue, symbol: symbol}
+
+	if err = i.doHTTP(ctx, r, &v); err == nil {
+		i.metrics.orders.Inc("cancelled")
+		i.tracer.forget(v)
+	}
 	return
 }
 
 //OrderStatus returns the current order status for the given order id.
 //See https://starfighter.readme.io/docs/status-for-an-existing-order for further info about the actual API call.
 func (i *Instance) OrderStatus(ID int) (v Order) {
+	v, err := i.OrderStatusCtx(context.Background(), ID)
+	i.setErr(err)
+	return
+}
+
+//OrderStatusCtx works like OrderStatus() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) OrderStatusCtx(ctx context.Context, ID int) (v Order, err error) {
 	i.RLock()
-	url := fmt.Sprintf("%svenues/%s/stocks/%s/orders/%s", baseURL, i.venue, i.symbol, strconv.Itoa(ID))
+	venue, symbol := i.venue, i.symbol
 	i.RUnlock()
 
-	i.doHTTP("GET", url, nil, &v)
+	return i.orderStatus(ctx, venue, symbol, ID)
+}
+
+func (i *Instance) orderStatus(ctx context.Context, venue, symbol string, ID int) (v Order, err error) {
+	r := request{endpoint: "order status", method: "GET", idempotent: true, url: fmt.Sprintf("%svenues/%s/stocks/%s/orders/%s", baseURL, venue, symbol, strconv.Itoa(ID)), venue: venue, symbol: symbol}
+
+	err = i.doHTTP(ctx, r, &v)
 	return
 }
 
 //AccountOrderStatus returns the current status for all orders of the current account on the current venue.
 //See https://starfighter.readme.io/docs/status-for-all-orders for further info about the actual API call.
 func (i *Instance) AccountOrderStatus() []Order {
+	v, err := i.AccountOrderStatusCtx(context.Background())
+	i.setErr(err)
+	return v
+}
+
+//AccountOrderStatusCtx works like AccountOrderStatus() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) AccountOrderStatusCtx(ctx context.Context) ([]Order, error) {
 	i.RLock()
-	url := fmt.Sprintf("%svenues/%s/accounts/%s/orders", baseURL, i.venue, i.account)
+	venue, account := i.venue, i.account
 	i.RUnlock()
 
+	return i.accountOrderStatus(ctx, venue, account)
+}
+
+func (i *Instance) accountOrderStatus(ctx context.Context, venue, account string) ([]Order, error) {
+	r := request{endpoint: "account orders", method: "GET", idempotent: true, url: fmt.Sprintf("%svenues/%s/accounts/%s/orders", baseURL, venue, account), venue: venue}
+
 	var v allOrdersStatusResult
-	i.doHTTP("GET", url, nil, &v)
-	return v.Orders
+	err := i.doHTTP(ctx, r, &v)
+	return v.Orders, err
 }
 
 //StockOrderStatus returns the current status for all orders of the current stock on the current venue and account.
 //See https://starfighter.readme.io/docs/status-for-all-orders-in-a-stock for further info about the actual API call.
 func (i *Instance) StockOrderStatus() []Order {
+	v, err := i.StockOrderStatusCtx(context.Background())
+	i.setErr(err)
+	return v
+}
+
+//StockOrderStatusCtx works like StockOrderStatus() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) StockOrderStatusCtx(ctx context.Context) ([]Order, error) {
 	i.RLock()
-	url := fmt.Sprintf("%svenues/%s/accounts/%s/stocks/%s/orders", baseURL, i.venue, i.account, i.symbol)
+	venue, account, symbol := i.venue, i.account, i.symbol
 	i.RUnlock()
 
+	return i.stockOrderStatus(ctx, venue, account, symbol)
+}
+
+func (i *Instance) stockOrderStatus(ctx context.Context, venue, account, symbol string) ([]Order, error) {
+	r := request{endpoint: "stock orders", method: "GET", idempotent: true, url: fmt.Sprintf("%svenues/%s/accounts/%s/stocks/%s/orders", baseURL, venue, account, symbol), venue: venue, symbol: symbol}
+
 	var v allOrdersStatusResult
-	i.doHTTP("GET", url, nil, &v)
-	return v.Orders
+	err := i.doHTTP(ctx, r, &v)
+	return v.Orders, err
 }
@@ -0,0 +1,109 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/api/apitest"
+)
+
+//loseResponses lets the exchange process new orders but replaces the responses for which lose returns true with a 503.
+//hold is called before the response is returned.
+func loseResponses(lose func(n int) bool, hold func(n int)) api.Option {
+	var mu sync.Mutex
+	n := 0
+	return api.WithMiddleware(func(next http.RoundTripper) http.RoundTripper {
+		return api.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method != "POST" {
+				return next.RoundTrip(req)
+			}
+			mu.Lock()
+			k := n
+			n++
+			mu.Unlock()
+			res, err := next.RoundTrip(req)
+			hold(k)
+			if err != nil || !lose(k) {
+				return res, err
+			}
+			res.Body.Close()
+			rec := httptest.NewRecorder()
+			rec.WriteHeader(http.StatusServiceUnavailable)
+			rec.WriteString(`{"ok":false,"error":"busy"}`)
+			return rec.Result(), nil
+		})
+	})
+}
+
+func retryNewOrder(i *api.Instance) {
+	p := api.DefaultRetryPolicy
+	p.RetryNewOrder = true
+	p.MinBackoff, p.MaxBackoff = time.Millisecond, time.Millisecond
+	i.SetRetryPolicy(p)
+}
+
+func TestNewOrderReconcile(t *testing.T) {
+	apitest.Start(t, nil)
+	i := api.NewTestInstance(loseResponses(func(int) bool { return true }, func(int) {}))
+	retryNewOrder(i)
+
+	o, err := i.NewOrderCtx(context.Background(), 100, 10, api.Buy, api.Limit)
+	if err != nil || o.ID != 0 || o.OriginalQuantity != 10 {
+		t.Fatal(o, err)
+	}
+	if n := len(i.StockOrderStatus()); n != 1 {
+		t.Fatal("order submitted", n, "times")
+	}
+}
+
+func TestNewOrderReconcileConcurrent(t *testing.T) {
+	apitest.Start(t, nil)
+	ctx := context.Background()
+
+	//the first order's response is lost and held until the identical second order went through, so the second order
+	//has the higher ID and is the newest match when the first one reconciles
+	second := make(chan struct{})
+	i := api.NewTestInstance(loseResponses(func(n int) bool { return n == 0 }, func(n int) {
+		if n == 0 {
+			<-second
+		}
+	}))
+	retryNewOrder(i)
+	var first api.Order
+	var firstErr error
+	done := make(chan struct{})
+	go func() {
+		first, firstErr = i.NewOrderCtx(ctx, 100, 10, api.Buy, api.Limit)
+		close(done)
+	}()
+	for len(i.StockOrderStatus()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	o, err := i.NewOrderCtx(ctx, 100, 10, api.Buy, api.Limit)
+	close(second)
+	<-done
+	if err != nil || o.ID != 1 {
+		t.Fatal(o, err)
+	}
+	//both calls were in flight at the same time: the first can't tell its order from the second one
+	if firstErr == nil {
+		t.Error("first order reconciled to", first.ID)
+	}
+
+	//identical orders placed one after the other are told apart
+	i = api.NewTestInstance(loseResponses(func(n int) bool { return n == 1 }, func(int) {}))
+	retryNewOrder(i)
+	a, err := i.NewOrderCtx(ctx, 200, 10, api.Buy, api.Limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := i.NewOrderCtx(ctx, 200, 10, api.Buy, api.Limit)
+	if err != nil || b.ID == a.ID || b.ID != 3 {
+		t.Fatal(a.ID, b.ID, err)
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
@@ -26,10 +27,23 @@ type Orderbook struct {
 //See: https://starfighter.readme.io/docs/get-orderbook-for-stock for further info about the actual API call.
 //Returns an empty Oderbook struct if there was an error.
 func (i *Instance) Orderbook() (v Orderbook) {
+	v, err := i.OrderbookCtx(context.Background())
+	i.setErr(err)
+	return
+}
+
+//OrderbookCtx works like Orderbook() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) OrderbookCtx(ctx context.Context) (Orderbook, error) {
 	i.RLock()
-	url := fmt.Sprintf("%svenues/%s/stocks/%s", baseURL, i.venue, i.symbol)
+	venue, symbol := i.venue, i.symbol
 	i.RUnlock()
 
-	i.doHTTP("GET", url, nil, &v)
+	return i.orderbook(ctx, venue, symbol)
+}
+
+func (i *Instance) orderbook(ctx context.Context, venue, symbol string) (v Orderbook, err error) {
+	r := request{endpoint: "orderbook", method: "GET", idempotent: true, url: fmt.Sprintf("%svenues/%s/stocks/%s", baseURL, venue, symbol), venue: venue, symbol: symbol}
+
+	err = i.doHTTP(ctx, r, &v)
 	return
 }
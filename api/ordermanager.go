@@ -0,0 +1,502 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+//OrderState is the lifecycle state of an order placed through an OrderManager.
+type OrderState int
+
+//Order states. Filled, Cancelled and Rejected are final.
+const (
+	OrderPending         OrderState = iota //submitted, no answer from the API yet
+	OrderOpen                              //resting in the book without fills
+	OrderPartiallyFilled                   //open with some fills
+	OrderFilled                            //completely filled
+	OrderCancelled                         //closed before it was completely filled, including unfilled IOC and FOK orders
+	OrderRejected                          //refused by the risk gate or the API
+)
+
+func (s OrderState) String() string {
+	switch s {
+	case OrderPending:
+		return "pending"
+	case OrderOpen:
+		return "open"
+	case OrderPartiallyFilled:
+		return "partially filled"
+	case OrderFilled:
+		return "filled"
+	case OrderCancelled:
+		return "cancelled"
+	case OrderRejected:
+		return "rejected"
+	}
+	return "unknown"
+}
+
+//Final reports whether the order can't change anymore.
+func (s OrderState) Final() bool {
+	return s == OrderFilled || s == OrderCancelled || s == OrderRejected
+}
+
+//stateOf derives the state of an order from its status.
+func stateOf(o Order) OrderState {
+	switch {
+	case o.Open && o.TotalFilled > 0:
+		return OrderPartiallyFilled
+	case o.Open:
+		return OrderOpen
+	case o.TotalFilled > 0 && o.TotalFilled >= o.OriginalQuantity:
+		return OrderFilled
+	}
+	return OrderCancelled
+}
+
+//Errors returned by OrderManager.Cancel.
+var (
+	ErrUnknownOrder = errors.New("unknown order")
+	ErrOrderPending = errors.New("order not acknowledged yet")
+)
+
+//ManagedOrder is an order placed through an OrderManager.
+type ManagedOrder struct {
+	Order                //latest status reported by the API; ID is only set once the order isn't pending anymore
+	Ref       int        //local reference assigned on submission, valid before the order has an ID
+	State     OrderState //current state
+	Err       error      //why the order got rejected
+	Submitted time.Time
+	Updated   time.Time
+}
+
+//OrderUpdate is passed to the callbacks of an OrderManager.
+type OrderUpdate struct {
+	Order ManagedOrder //order after the update
+	From  OrderState   //state before the update, equal to Order.State if the update only added fills
+	Fills []Fill       //fills since the previous update
+}
+
+//OrderManagerConfig configures an OrderManager.
+type OrderManagerConfig struct {
+	//Poll is the interval in which StockOrderStatus gets polled while the executions stream is down. 0 disables polling.
+	Poll time.Duration
+	//Reconcile is the interval in which StockOrderStatus gets polled even while the executions stream is up. 0 disables it.
+	Reconcile time.Duration
+}
+
+//DefaultOrderManagerConfig polls once per second while the executions stream is down.
+var DefaultOrderManagerConfig = OrderManagerConfig{
+	Poll: time.Second,
+}
+
+type exposureKey struct {
+	symbol string
+	price  int
+	isBuy  bool
+}
+
+//OrderManager places orders for the current account on the current venue and follows each of them until it is final.
+//Orders are updated from the executions stream of the venue; while the stream is down StockOrderStatus gets polled instead.
+//All methods are safe for concurrent use.
+type OrderManager struct {
+	i       *Instance
+	account string
+	venue   string
+	symbol  string //stock Submit places orders in, the current stock of the instance if empty
+	c       OrderManagerConfig
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu        sync.RWMutex
+	ref       int
+	orders    map[int]*ManagedOrder //by Ref
+	ids       map[int]int           //order ID to Ref
+	pending   int
+	early     map[int]Order //status of orders seen while a submission was in flight, by order ID
+	exposure  map[exposureKey]int
+	callbacks []func(OrderUpdate)
+	down      bool
+	err       error
+}
+
+//NewOrderManager creates an OrderManager for the current account and venue.
+//It keeps following its orders until ctx is done or Stop() is called.
+func (i *Instance) NewOrderManager(ctx context.Context, c OrderManagerConfig) *OrderManager {
+	i.RLock()
+	account, venue := i.account, i.venue
+	i.RUnlock()
+
+	return i.newOrderManager(ctx, account, venue, "", c)
+}
+
+func (i *Instance) newOrderManager(ctx context.Context, account, venue, symbol string, c OrderManagerConfig) *OrderManager {
+	ctx, cancel := context.WithCancel(ctx)
+	m := &OrderManager{
+		i:        i,
+		account:  account,
+		venue:    venue,
+		symbol:   symbol,
+		c:        c,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		orders:   map[int]*ManagedOrder{},
+		ids:      map[int]int{},
+		early:    map[int]Order{},
+		exposure: map[exposureKey]int{},
+	}
+	go m.run(ctx, i.executions(ctx, venue, "", account))
+	return m
+}
+
+//Stop stops following the orders. The manager keeps answering queries with the last known state.
+func (m *OrderManager) Stop() {
+	m.cancel()
+	<-m.done
+}
+
+//Err returns the last error that occurred while following the orders.
+func (m *OrderManager) Err() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.err
+}
+
+func (m *OrderManager) setErr(err error) {
+	if err != nil {
+		m.mu.Lock()
+		m.err = err
+		m.mu.Unlock()
+	}
+}
+
+//OnUpdate registers f to be called whenever an order changes its state or gets filled.
+//Callbacks run synchronously, either in the goroutine calling Submit or Cancel or in the one following the executions stream.
+func (m *OrderManager) OnUpdate(f func(OrderUpdate)) {
+	m.mu.Lock()
+	m.callbacks = append(m.callbacks, f)
+	m.mu.Unlock()
+}
+
+//notify runs the callbacks for all updates. Must be called without m.mu held.
+func (m *OrderManager) notify(updates []OrderUpdate) {
+	if len(updates) == 0 {
+		return
+	}
+	m.mu.RLock()
+	callbacks := m.callbacks
+	m.mu.RUnlock()
+	for _, u := range updates {
+		for _, f := range callbacks {
+			f(u)
+		}
+	}
+}
+
+func (m *OrderManager) run(ctx context.Context, executions *ExecutionStream) {
+	defer close(m.done)
+
+	var poll, reconcile <-chan time.Time
+	if m.c.Poll > 0 {
+		t := time.NewTicker(m.c.Poll)
+		defer t.Stop()
+		poll = t.C
+	}
+	if m.c.Reconcile > 0 {
+		t := time.NewTicker(m.c.Reconcile)
+		defer t.Stop()
+		reconcile = t.C
+	}
+
+	execs, events := executions.Values, executions.Events
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-execs:
+			if !ok {
+				//the stream gave up for good, from now on polling is all there is.
+				execs = nil
+				m.setErr(executions.Err())
+				m.setDown(true)
+				continue
+			}
+			m.notify(m.apply([]Order{e.Order}))
+		case e, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			switch e.Type {
+			case Disconnected, GaveUp:
+				m.setDown(true)
+			case Reconnected:
+				m.setDown(false)
+				if e.BackfillErr != nil {
+					m.setErr(e.BackfillErr)
+					m.poll(ctx)
+				} else {
+					m.notify(m.apply(e.Orders))
+				}
+			}
+		case <-poll:
+			m.mu.RLock()
+			down := m.down
+			m.mu.RUnlock()
+			if down {
+				m.poll(ctx)
+			}
+		case <-reconcile:
+			m.poll(ctx)
+		}
+	}
+}
+
+func (m *OrderManager) setDown(down bool) {
+	m.mu.Lock()
+	m.down = down
+	m.mu.Unlock()
+}
+
+//poll fetches the status of all orders in every stock with orders that aren't final yet.
+func (m *OrderManager) poll(ctx context.Context) {
+	m.mu.RLock()
+	symbols := map[string]bool{}
+	for _, mo := range m.orders {
+		if !mo.State.Final() && mo.State != OrderPending {
+			symbols[mo.Symbol] = true
+		}
+	}
+	m.mu.RUnlock()
+
+	for symbol := range symbols {
+		orders, err := m.i.stockOrderStatus(ctx, m.venue, m.account, symbol)
+		if err != nil {
+			m.setErr(err)
+			continue
+		}
+		m.notify(m.apply(orders))
+	}
+}
+
+//apply updates the managed orders from order status and returns the resulting updates.
+func (m *OrderManager) apply(orders []Order) (updates []OrderUpdate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range orders {
+		if ref, ok := m.ids[o.ID]; ok {
+			if u, ok := m.update(m.orders[ref], o); ok {
+				updates = append(updates, u)
+			}
+		} else if m.pending > 0 && o.Account == m.account {
+			//executions can arrive before the answer to the submission, keep them until then.
+			if old, ok := m.early[o.ID]; !ok || newer(o, old) {
+				m.early[o.ID] = o
+			}
+		}
+	}
+	return
+}
+
+//newer reports whether status o is more recent than status old of the same order.
+//Responses may arrive out of order; fills only grow and closed orders stay closed.
+func newer(o, old Order) bool {
+	return o.TotalFilled > old.TotalFilled || (o.TotalFilled == old.TotalFilled && old.Open && !o.Open)
+}
+
+//update applies the status o to mo. Must be called with m.mu held.
+func (m *OrderManager) update(mo *ManagedOrder, o Order) (OrderUpdate, bool) {
+	if mo.State != OrderPending && !newer(o, mo.Order) {
+		return OrderUpdate{}, false
+	}
+	u := OrderUpdate{From: mo.State}
+	if len(o.Fills) > len(mo.Fills) {
+		u.Fills = o.Fills[len(mo.Fills):]
+	}
+
+	m.expose(mo, -1)
+	mo.Order = o
+	mo.State = stateOf(o)
+	mo.Updated = time.Now()
+	m.expose(mo, 1)
+
+	u.Order = *mo
+	return u, true
+}
+
+//expose adds (sign 1) or removes (sign -1) the open quantity of an order to the exposure. Must be called with m.mu held.
+func (m *OrderManager) expose(mo *ManagedOrder, sign int) {
+	if mo.State.Final() {
+		return
+	}
+	k := exposureKey{mo.Symbol, mo.Price, mo.Direction != Sell}
+	m.exposure[k] += sign * mo.Quantity
+	if m.exposure[k] == 0 {
+		delete(m.exposure, k)
+	}
+}
+
+//Submit places an order like NewOrder, in the stock of the Listing the manager was created from or else the current stock of the instance.
+//The order is known to the manager as pending before the API gets called. The returned error is the one of NewOrder;
+//in that case the order is rejected, even though it may have reached the exchange when the call failed on the way back.
+func (m *OrderManager) Submit(ctx context.Context, price, quantity int, direction OrderDirection, orderType OrderType) (ManagedOrder, error) {
+	symbol := m.symbol
+	if symbol == "" {
+		symbol = m.i.GetSymbol()
+	}
+	return m.submit(ctx, symbol, price, quantity, direction, orderType)
+}
+
+func (m *OrderManager) submit(ctx context.Context, symbol string, price, quantity int, direction OrderDirection, orderType OrderType) (ManagedOrder, error) {
+	o := orderRequest{m.account, m.venue, symbol, price, quantity, direction, orderType}
+
+	m.mu.Lock()
+	m.ref++
+	now := time.Now()
+	mo := &ManagedOrder{
+		Order:     Order{Account: o.Account, Venue: o.Venue, Symbol: o.Symbol, Price: price, OriginalQuantity: quantity, Quantity: quantity, Direction: direction, OrderType: orderType, Open: true},
+		Ref:       m.ref,
+		Submitted: now,
+		Updated:   now,
+	}
+	m.orders[mo.Ref] = mo
+	m.pending++
+	m.expose(mo, 1)
+	u := OrderUpdate{Order: *mo, From: OrderPending}
+	m.mu.Unlock()
+	m.notify([]OrderUpdate{u})
+
+	v, err := m.i.newOrder(ctx, o)
+
+	m.mu.Lock()
+	m.pending--
+	if err != nil {
+		m.expose(mo, -1)
+		mo.State, mo.Err, mo.Open = OrderRejected, err, false
+		mo.Updated = time.Now()
+		u = OrderUpdate{Order: *mo, From: OrderPending}
+	} else {
+		if early, ok := m.early[v.ID]; ok && newer(early, v) {
+			v = early
+		}
+		m.ids[v.ID] = mo.Ref
+		u, _ = m.update(mo, v)
+	}
+	if m.pending == 0 {
+		m.early = map[int]Order{}
+	}
+	result := *mo
+	m.mu.Unlock()
+
+	m.notify([]OrderUpdate{u})
+	return result, err
+}
+
+//Cancel cancels the order with the given reference.
+func (m *OrderManager) Cancel(ctx context.Context, ref int) (ManagedOrder, error) {
+	mo, ok := m.Order(ref)
+	if !ok {
+		return ManagedOrder{}, ErrUnknownOrder
+	}
+	if mo.State == OrderPending {
+		return mo, ErrOrderPending
+	}
+
+	v, err := m.i.cancelOrder(ctx, mo.Venue, mo.Symbol, mo.ID)
+	if err != nil {
+		return m.get(ref), err
+	}
+	m.notify(m.apply([]Order{v}))
+	return m.get(ref), nil
+}
+
+//CancelAll cancels all orders that aren't final. All orders are attempted; the first error is returned.
+func (m *OrderManager) CancelAll(ctx context.Context) error {
+	var firstErr error
+	for _, mo := range m.Open() {
+		if _, err := m.Cancel(ctx, mo.Ref); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m *OrderManager) get(ref int) ManagedOrder {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return *m.orders[ref]
+}
+
+//Order returns the order with the given reference.
+func (m *OrderManager) Order(ref int) (ManagedOrder, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if mo, ok := m.orders[ref]; ok {
+		return *mo, true
+	}
+	return ManagedOrder{}, false
+}
+
+//OrderByID returns the order with the given order ID.
+func (m *OrderManager) OrderByID(ID int) (ManagedOrder, bool) {
+	m.mu.RLock()
+	ref, ok := m.ids[ID]
+	m.mu.RUnlock()
+	if !ok {
+		return ManagedOrder{}, false
+	}
+	return m.Order(ref)
+}
+
+//Orders returns all orders in the order they were submitted.
+func (m *OrderManager) Orders() []ManagedOrder {
+	return m.filter(func(*ManagedOrder) bool { return true })
+}
+
+//Open returns all orders that aren't final (pending, open or partially filled) in the order they were submitted.
+func (m *OrderManager) Open() []ManagedOrder {
+	return m.filter(func(mo *ManagedOrder) bool { return !mo.State.Final() })
+}
+
+func (m *OrderManager) filter(keep func(*ManagedOrder) bool) []ManagedOrder {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var v []ManagedOrder
+	for _, mo := range m.orders {
+		if keep(mo) {
+			v = append(v, *mo)
+		}
+	}
+	sort.Slice(v, func(a, b int) bool { return v[a].Ref < v[b].Ref })
+	return v
+}
+
+//Exposure returns the unfilled quantity of all orders in a stock that aren't final, aggregated per price level.
+//Bids and asks are sorted best price first, like in an Orderbook.
+func (m *OrderManager) Exposure(symbol string) (bids, asks []MarketRequest) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for k, qty := range m.exposure {
+		if k.symbol != symbol {
+			continue
+		}
+		if k.isBuy {
+			bids = append(bids, MarketRequest{k.price, qty, true})
+		} else {
+			asks = append(asks, MarketRequest{k.price, qty, false})
+		}
+	}
+	sort.Slice(bids, func(a, b int) bool { return better(bids[a].Price, bids[b].Price, true) })
+	sort.Slice(asks, func(a, b int) bool { return better(asks[a].Price, asks[b].Price, false) })
+	return
+}
+
+//ExposureAt returns the unfilled quantity of our orders at a price level of a stock.
+func (m *OrderManager) ExposureAt(symbol string, price int, isBuy bool) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.exposure[exposureKey{symbol, price, isBuy}]
+}
@@ -0,0 +1,87 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/api/apitest"
+)
+
+//waitState waits until the order with ref is in state s.
+func waitState(t *testing.T, m *api.OrderManager, ref int, s api.OrderState) api.ManagedOrder {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mo, _ := m.Order(ref)
+		if mo.State == s {
+			return mo
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("order %d is %v, not %v: %+v", ref, mo.State, s, mo)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestOrderManager(t *testing.T) {
+	ex := apitest.Start(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	i := api.NewTestInstance()
+	other := api.NewInstance("", "OTHER", "TESTEX", "FOOBAR")
+	m := i.NewOrderManager(ctx, api.DefaultOrderManagerConfig)
+	defer m.Stop()
+	updates := make(chan api.OrderUpdate, 100)
+	m.OnUpdate(func(u api.OrderUpdate) { updates <- u })
+	apitest.WaitSubscribers(t, ex, 1)
+
+	//the first order of the exchange has ID 0
+	bid, err := m.Submit(ctx, 5000, 10, api.Buy, api.Limit)
+	if err != nil || bid.ID != 0 || bid.State != api.OrderOpen {
+		t.Fatal(bid, err)
+	}
+	if u := <-updates; u.From != api.OrderPending || u.Order.State != api.OrderPending {
+		t.Errorf("submitted %+v", u)
+	}
+	if u := <-updates; u.From != api.OrderPending || u.Order.State != api.OrderOpen {
+		t.Errorf("acknowledged %+v", u)
+	}
+
+	if _, err := other.NewOrderCtx(ctx, 5000, 4, api.Sell, api.Limit); err != nil {
+		t.Fatal(err)
+	}
+	mo := waitState(t, m, bid.Ref, api.OrderPartiallyFilled)
+	if mo.TotalFilled != 4 || len(m.Open()) != 1 {
+		t.Errorf("partially filled %+v", mo)
+	}
+	if u := <-updates; u.From != api.OrderOpen || len(u.Fills) != 1 || u.Fills[0].Quantity != 4 {
+		t.Errorf("fill %+v", u)
+	}
+
+	mo, err = m.Cancel(ctx, bid.Ref)
+	if err != nil || mo.State != api.OrderCancelled || mo.TotalFilled != 4 {
+		t.Fatal(mo, err)
+	}
+	if _, err := m.Cancel(ctx, 12345); err != api.ErrUnknownOrder {
+		t.Error("unknown order:", err)
+	}
+
+	//a sell that is filled completely by the resting order of the other account
+	if _, err := other.NewOrderCtx(ctx, 4900, 3, api.Buy, api.Limit); err != nil {
+		t.Fatal(err)
+	}
+	ask, err := m.Submit(ctx, 4900, 3, api.Sell, api.Limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mo = waitState(t, m, ask.Ref, api.OrderFilled)
+	if mo.TotalFilled != 3 || len(m.Open()) != 0 {
+		t.Errorf("filled %+v", mo)
+	}
+	if err := m.CancelAll(ctx); err != nil {
+		t.Error(err)
+	}
+}
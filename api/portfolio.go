@@ -0,0 +1,385 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+//Position is the holding in a single stock. All amounts are in cents.
+type Position struct {
+	Venue    string
+	Symbol   string
+	Quantity int     //number of shares, negative when short
+	AvgCost  float64 //average price paid (or received when short) per share of the open position
+	Realized float64 //P&L of the closed part of the position
+	Mark     int     //price the open position is valued at, taken from the last quote
+	MarkTime time.Time
+	Bought   int //total shares bought
+	Sold     int //total shares sold
+}
+
+//Unrealized returns the P&L of the open position against the mark price.
+func (p Position) Unrealized() float64 {
+	if p.Quantity == 0 || p.Mark == 0 {
+		return 0
+	}
+	return float64(p.Quantity) * (float64(p.Mark) - p.AvgCost)
+}
+
+//Value returns the market value of the position at the mark price.
+func (p Position) Value() int {
+	return p.Quantity * p.Mark
+}
+
+//PortfolioUpdate gets published to subscribers whenever a fill or a quote changes the portfolio.
+type PortfolioUpdate struct {
+	Position  Position   //the position that changed
+	Cash      int        //cash after the change
+	NAV       float64    //net asset value after the change
+	Execution *Execution //the fill causing the update, nil for updates of the mark price
+}
+
+type positionKey struct {
+	venue  string
+	symbol string
+}
+
+//bookedFills are the fills booked for an order, so fills seen on the executions stream and in order status don't get
+//booked twice. A fill is identified by the shares of the order filled before it: fills of a sweep can share price,
+//quantity and time. Once the order is closed and all its fills are booked, the fills are dropped and done marks the
+//order, so a portfolio only keeps the fills of open orders.
+type bookedFills struct {
+	fills map[int]bool
+	qty   int
+	done  bool
+}
+
+//Portfolio tracks positions, cash and P&L from fills. It starts out flat with no cash.
+//All methods are safe for concurrent use.
+type Portfolio struct {
+	i *Instance
+
+	mu        sync.RWMutex
+	cash      int
+	positions map[positionKey]*Position
+	booked    map[orderKey]*bookedFills
+	subs      map[chan PortfolioUpdate]struct{}
+}
+
+//NewPortfolio creates an empty portfolio. The instance is used to rebuild it from the order status of its account.
+func (i *Instance) NewPortfolio() *Portfolio {
+	return &Portfolio{
+		i:         i,
+		positions: map[positionKey]*Position{},
+		booked:    map[orderKey]*bookedFills{},
+		subs:      map[chan PortfolioUpdate]struct{}{},
+	}
+}
+
+//Subscribe returns a chan receiving every change of the portfolio and a func to cancel the subscription.
+//Updates are dropped when the chan is full; each update carries the complete state of the changed position.
+func (p *Portfolio) Subscribe(buffer int) (<-chan PortfolioUpdate, func()) {
+	c := make(chan PortfolioUpdate, buffer)
+	p.mu.Lock()
+	p.subs[c] = struct{}{}
+	p.mu.Unlock()
+
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			p.mu.Lock()
+			delete(p.subs, c)
+			p.mu.Unlock()
+			close(c)
+		})
+	}
+}
+
+//publish sends an update to all subscribers. Must be called with p.mu held.
+func (p *Portfolio) publish(pos *Position, e *Execution) {
+	u := PortfolioUpdate{*pos, p.cash, p.nav(), e}
+	for c := range p.subs {
+		select {
+		case c <- u:
+		default:
+		}
+	}
+}
+
+//position returns the position of a stock, creating it if necessary. Must be called with p.mu held.
+func (p *Portfolio) position(venue, symbol string) *Position {
+	k := positionKey{venue, symbol}
+	pos, ok := p.positions[k]
+	if !ok {
+		pos = &Position{Venue: venue, Symbol: symbol}
+		p.positions[k] = pos
+	}
+	return pos
+}
+
+//book applies a single fill of one of our orders, made after offset shares of the order were filled. Must be called
+//with p.mu held. Returns false if the fill was booked before.
+func (p *Portfolio) book(o Order, offset, price, qty int, ts time.Time) (*Position, bool) {
+	b := p.booked[orderKey{o.Venue, o.ID}]
+	if b == nil {
+		b = &bookedFills{fills: map[int]bool{}}
+		p.booked[orderKey{o.Venue, o.ID}] = b
+	}
+	if b.done || b.fills[offset] {
+		return nil, false
+	}
+	b.fills[offset] = true
+	b.qty += qty
+	p.settle(o)
+
+	pos := p.position(o.Venue, o.Symbol)
+	signed := qty
+	if o.Direction == Sell {
+		signed = -qty
+		pos.Sold += qty
+	} else {
+		pos.Bought += qty
+	}
+	p.cash -= signed * price
+
+	//the part of the fill going against the position closes it, the rest opens (or extends) it.
+	if pos.Quantity != 0 && (pos.Quantity > 0) != (signed > 0) {
+		closing := qty
+		if open := abs(pos.Quantity); open < closing {
+			closing = open
+		}
+		if pos.Quantity > 0 {
+			pos.Realized += float64(closing) * (float64(price) - pos.AvgCost)
+			pos.Quantity -= closing
+			signed += closing
+		} else {
+			pos.Realized += float64(closing) * (pos.AvgCost - float64(price))
+			pos.Quantity += closing
+			signed -= closing
+		}
+		if pos.Quantity == 0 {
+			pos.AvgCost = 0
+		}
+	}
+	if signed != 0 {
+		pos.AvgCost = (pos.AvgCost*float64(abs(pos.Quantity)) + float64(price*abs(signed))) / float64(abs(pos.Quantity+signed))
+		pos.Quantity += signed
+	}
+	if pos.Mark == 0 {
+		pos.Mark, pos.MarkTime = price, ts
+	}
+	return pos, true
+}
+
+//settle drops the fills booked for o if it is closed and all of them are booked. Must be called with p.mu held.
+func (p *Portfolio) settle(o Order) {
+	b := p.booked[orderKey{o.Venue, o.ID}]
+	if b != nil && !o.Open && b.qty >= o.TotalFilled {
+		b.fills, b.done = nil, true
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+//ApplyExecution books the fill reported by an execution of one of our orders. Returns false if it was booked before.
+func (p *Portfolio) ApplyExecution(e Execution) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pos, ok := p.book(e.Order, e.Order.TotalFilled-e.Filled, e.Price, e.Filled, e.FilledAt)
+	if ok {
+		p.publish(pos, &e)
+	}
+	return ok
+}
+
+//ApplyOrders books all fills of the given orders that weren't booked yet, oldest fill first.
+func (p *Portfolio) ApplyOrders(orders []Order) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.applyOrders(orders)
+}
+
+//applyOrders must be called with p.mu held.
+func (p *Portfolio) applyOrders(orders []Order) {
+	type orderFill struct {
+		o      Order
+		offset int
+		f      Fill
+	}
+	var fills []orderFill
+	for _, o := range orders {
+		offset := 0
+		for _, f := range o.Fills {
+			fills = append(fills, orderFill{o, offset, f})
+			offset += f.Quantity
+		}
+	}
+	sort.SliceStable(fills, func(a, b int) bool { return fills[a].f.TS.Before(fills[b].f.TS) })
+
+	for _, x := range fills {
+		if pos, ok := p.book(x.o, x.offset, x.f.Price, x.f.Quantity, x.f.TS); ok {
+			p.publish(pos, nil)
+		}
+	}
+	//orders closed after their last fill was booked
+	for _, o := range orders {
+		p.settle(o)
+	}
+}
+
+//Mark values the position in the quoted stock at the midpoint of the quote, or at the last trade price if a side is empty.
+func (p *Portfolio) Mark(q Quote) {
+	price := q.LastPrice
+	if q.Bid > 0 && q.Ask > 0 {
+		price = (q.Bid + q.Ask) / 2
+	}
+	if price == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pos := p.position(q.Venue, q.Symbol)
+	if q.QuoteTime.Before(pos.MarkTime) {
+		return
+	}
+	changed := pos.Mark != price
+	pos.Mark, pos.MarkTime = price, q.QuoteTime
+	if changed && pos.Quantity != 0 {
+		p.publish(pos, nil)
+	}
+}
+
+//Rebuild resets the portfolio and books all fills of the current account from AccountOrderStatus on the given venues
+//(the current venue if none are given). Mark prices are kept. On error the portfolio is left unchanged.
+func (p *Portfolio) Rebuild(ctx context.Context, venues ...string) error {
+	if len(venues) == 0 {
+		venues = []string{p.i.GetVenue()}
+	}
+	var orders []Order
+	for _, venue := range venues {
+		v, err := p.i.accountOrderStatus(ctx, venue, p.i.GetAccount())
+		if err != nil {
+			return err
+		}
+		orders = append(orders, v...)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cash = 0
+	p.booked = map[orderKey]*bookedFills{}
+	for k, pos := range p.positions {
+		p.positions[k] = &Position{Venue: pos.Venue, Symbol: pos.Symbol, Mark: pos.Mark, MarkTime: pos.MarkTime}
+	}
+	p.applyOrders(orders)
+	return nil
+}
+
+//Consume books every execution and marks every quote from the given streams (either may be nil) until both are closed.
+//Orders backfilled by a reconnecting executions stream are booked as well, which recovers fills missed while disconnected.
+func (p *Portfolio) Consume(executions *ExecutionStream, quotes *QuoteStream) {
+	var (
+		execs <-chan Execution
+		qs    <-chan Quote
+		evts  <-chan StreamEvent
+	)
+	if executions != nil {
+		execs, evts = executions.Values, executions.Events
+	}
+	if quotes != nil {
+		qs = quotes.Values
+	}
+
+	for execs != nil || qs != nil {
+		select {
+		case e, ok := <-execs:
+			if !ok {
+				execs, evts = nil, nil
+				continue
+			}
+			p.ApplyExecution(e)
+		case e, ok := <-evts:
+			if !ok {
+				evts = nil
+				continue
+			}
+			if e.Type == Reconnected && e.BackfillErr == nil {
+				p.ApplyOrders(e.Orders)
+			}
+		case q, ok := <-qs:
+			if !ok {
+				qs = nil
+				continue
+			}
+			p.Mark(q)
+		}
+	}
+}
+
+//Cash returns the cash balance in cents.
+func (p *Portfolio) Cash() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cash
+}
+
+//Position returns the position in a stock.
+func (p *Portfolio) Position(venue, symbol string) Position {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if pos, ok := p.positions[positionKey{venue, symbol}]; ok {
+		return *pos
+	}
+	return Position{Venue: venue, Symbol: symbol}
+}
+
+//Positions returns all positions, sorted by venue and symbol.
+func (p *Portfolio) Positions() []Position {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	v := make([]Position, 0, len(p.positions))
+	for _, pos := range p.positions {
+		v = append(v, *pos)
+	}
+	sort.Slice(v, func(a, b int) bool {
+		if v[a].Venue != v[b].Venue {
+			return v[a].Venue < v[b].Venue
+		}
+		return v[a].Symbol < v[b].Symbol
+	})
+	return v
+}
+
+//NAV returns the net asset value: cash plus the value of all positions at their mark prices.
+func (p *Portfolio) NAV() float64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.nav()
+}
+
+func (p *Portfolio) nav() float64 {
+	v := float64(p.cash)
+	for _, pos := range p.positions {
+		v += float64(pos.Value())
+	}
+	return v
+}
+
+//PnL returns the realized and unrealized P&L over all positions.
+func (p *Portfolio) PnL() (realized, unrealized float64) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, pos := range p.positions {
+		realized += pos.Realized
+		unrealized += pos.Unrealized()
+	}
+	return
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPortfolioForgetsFillsOfClosedOrders(t *testing.T) {
+	p := (&Instance{}).NewPortfolio()
+	ts := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	fill := func(price, qty int) Fill { ts = ts.Add(time.Second); return Fill{price, qty, ts} }
+
+	o := Order{Venue: "TESTEX", Symbol: "FOOBAR", ID: 1, Direction: Buy, OriginalQuantity: 10, Open: true}
+	f1, f2 := fill(100, 4), fill(101, 6)
+	o.Fills, o.TotalFilled = []Fill{f1}, 4
+	if !p.ApplyExecution(Execution{Order: o, Price: f1.Price, Filled: f1.Quantity, FilledAt: f1.TS}) {
+		t.Fatal("first fill not booked")
+	}
+	if n := len(p.booked[orderKey{"TESTEX", 1}].fills); n != 1 {
+		t.Fatal(n, "fills kept for an open order")
+	}
+
+	//the order closes with the second fill, seen in order status only
+	o.Fills, o.TotalFilled, o.Open = []Fill{f1, f2}, 10, false
+	p.ApplyOrders([]Order{o})
+	b := p.booked[orderKey{"TESTEX", 1}]
+	if !b.done || b.fills != nil {
+		t.Fatalf("closed order still keeps its fills: %+v", b)
+	}
+
+	//neither a late execution nor a backfill books the fills again
+	if p.ApplyExecution(Execution{Order: o, Price: f2.Price, Filled: f2.Quantity, FilledAt: f2.TS}) {
+		t.Error("fill booked twice")
+	}
+	p.ApplyOrders([]Order{o})
+	if pos := p.Position("TESTEX", "FOOBAR"); pos.Quantity != 10 || p.Cash() != -1006 {
+		t.Errorf("%+v cash %d", pos, p.Cash())
+	}
+}
+
+//TestPortfolioSweep books an order that takes two identical asks at once. Its fills share price, quantity and time.
+func TestPortfolioSweep(t *testing.T) {
+	ts := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := Fill{100, 5, ts}
+	o := Order{Venue: "TESTEX", Symbol: "FOOBAR", ID: 0, Direction: Buy, OriginalQuantity: 10}
+	first, last := o, o
+	first.Fills, first.TotalFilled, first.Open = []Fill{f}, 5, true
+	last.Fills, last.TotalFilled = []Fill{f, f}, 10
+
+	executions := (&Instance{}).NewPortfolio()
+	for _, x := range []Order{first, last} {
+		if !executions.ApplyExecution(Execution{Order: x, Price: f.Price, Filled: f.Quantity, FilledAt: f.TS}) {
+			t.Error("fill of the sweep not booked", x.TotalFilled)
+		}
+	}
+	status := (&Instance{}).NewPortfolio()
+	status.ApplyOrders([]Order{last})
+
+	for name, p := range map[string]*Portfolio{"executions": executions, "order status": status} {
+		if pos := p.Position("TESTEX", "FOOBAR"); pos.Quantity != 10 || p.Cash() != -1000 {
+			t.Errorf("%s: %+v cash %d", name, pos, p.Cash())
+		}
+		if b := p.booked[orderKey{"TESTEX", 0}]; !b.done || b.fills != nil {
+			t.Errorf("%s: closed order still keeps its fills: %+v", name, b)
+		}
+	}
+	//the order status after the executions books nothing again
+	executions.ApplyOrders([]Order{last})
+	if executions.Cash() != -1000 {
+		t.Error("fills booked twice", executions.Cash())
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
@@ -26,10 +27,23 @@ type Quote struct {
 //See https://starfighter.readme.io/docs/a-quote-for-a-stock for further info about the actual API call.
 //Returns an empty Oderbook struct if there was an error.
 func (i *Instance) Quote() (v Quote) {
+	v, err := i.QuoteCtx(context.Background())
+	i.setErr(err)
+	return
+}
+
+//QuoteCtx works like Quote() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) QuoteCtx(ctx context.Context) (Quote, error) {
 	i.RLock()
-	url := fmt.Sprintf("%svenues/%s/stocks/%s/quote", baseURL, i.venue, i.symbol)
+	venue, symbol := i.venue, i.symbol
 	i.RUnlock()
 
-	i.doHTTP("GET", url, nil, &v)
+	return i.quote(ctx, venue, symbol)
+}
+
+func (i *Instance) quote(ctx context.Context, venue, symbol string) (v Quote, err error) {
+	r := request{endpoint: "quote", method: "GET", idempotent: true, url: fmt.Sprintf("%svenues/%s/stocks/%s/quote", baseURL, venue, symbol), venue: venue, symbol: symbol}
+
+	err = i.doHTTP(ctx, r, &v)
 	return
 }
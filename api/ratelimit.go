@@ -0,0 +1,261 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//EndpointClass groups API calls for rate limiting.
+type EndpointClass int
+
+//Endpoint classes. AllClasses is the budget shared by every call on top of the per-class budgets.
+const (
+	MarketData EndpointClass = iota //heartbeats, stocks, quotes and orderbooks
+	OrderEntry                      //placing, cancelling and querying orders
+	GameMaster                      //GameMaster-API calls
+	AllClasses
+)
+
+func (c EndpointClass) String() string {
+	switch c {
+	case MarketData:
+		return "market data"
+	case OrderEntry:
+		return "order entry"
+	case GameMaster:
+		return "game master"
+	case AllClasses:
+		return "all"
+	}
+	return "unknown"
+}
+
+//Priorities of calls waiting for the shared budget. Higher goes first.
+const (
+	priorityMarketData = iota
+	priorityGameMaster
+	priorityOrderStatus
+	priorityNewOrder
+	priorityCancelOrder
+)
+
+//class returns the endpoint class of a request.
+func (r request) class() EndpointClass {
+	switch r.endpoint {
+	case "new order", "cancel order", "order status", "account orders", "stock orders":
+		return OrderEntry
+	case "start level", "restart level", "stop level", "resume level", "judge level", "submit judgement", "levels", "instance status":
+		return GameMaster
+	}
+	return MarketData
+}
+
+//priority returns the scheduling priority of a request. Cancels and new orders jump ahead of market data polling.
+func (r request) priority() int {
+	switch r.endpoint {
+	case "cancel order":
+		return priorityCancelOrder
+	case "new order":
+		return priorityNewOrder
+	}
+	switch r.class() {
+	case OrderEntry:
+		return priorityOrderStatus
+	case GameMaster:
+		return priorityGameMaster
+	}
+	return priorityMarketData
+}
+
+//RateLimit configures a token bucket: Rate requests per second on average with bursts of up to Burst requests.
+//A Rate <= 0 means unlimited.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+//RateLimitStats shows how much a class of calls got slowed down by the rate limiter.
+type RateLimitStats struct {
+	Requests  int64         //number of calls that passed the limiter
+	Delayed   int64         //number of calls that had to wait
+	TotalWait time.Duration //accumulated waiting time
+	MaxWait   time.Duration //longest single wait
+}
+
+type bucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+//refill adds the tokens accumulated since the last refill.
+func (b *bucket) refill(now time.Time) {
+	if b.limit.Rate <= 0 {
+		return
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if max := float64(b.limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+}
+
+//ready returns 0 if a token is available, otherwise how long it takes until one is.
+func (b *bucket) ready() time.Duration {
+	if b == nil || b.limit.Rate <= 0 || b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+func (b *bucket) take() {
+	if b != nil && b.limit.Rate > 0 {
+		b.tokens--
+	}
+}
+
+type waiter struct {
+	class    EndpointClass
+	priority int
+	seq      uint64
+}
+
+//before reports whether w has to be served before x.
+func (w *waiter) before(x *waiter) bool {
+	if w.priority != x.priority {
+		return w.priority > x.priority
+	}
+	return w.seq < x.seq
+}
+
+//rateLimiter schedules calls through per-class token buckets and a shared bucket.
+//When the shared bucket runs dry, waiting calls are served by priority and then in arrival order.
+type rateLimiter struct {
+	sync.Mutex
+	buckets map[EndpointClass]*bucket
+	waiters map[*waiter]struct{}
+	seq     uint64
+	wake    chan struct{} //closed and replaced whenever a waiter might be able to proceed
+	stats   map[EndpointClass]RateLimitStats
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets: map[EndpointClass]*bucket{},
+		waiters: map[*waiter]struct{}{},
+		wake:    make(chan struct{}),
+		stats:   map[EndpointClass]RateLimitStats{},
+	}
+}
+
+//SetRateLimit limits the calls of a class. Use AllClasses to set the budget shared by all calls.
+func (i *Instance) SetRateLimit(class EndpointClass, limit RateLimit) {
+	l := i.limiter
+	l.Lock()
+	defer l.Unlock()
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	l.buckets[class] = &bucket{limit, float64(limit.Burst), time.Now()}
+	l.broadcast()
+}
+
+//RateLimitStats returns the waiting statistics of all endpoint classes.
+func (i *Instance) RateLimitStats() map[EndpointClass]RateLimitStats {
+	l := i.limiter
+	l.Lock()
+	defer l.Unlock()
+	v := make(map[EndpointClass]RateLimitStats, len(l.stats))
+	for class, s := range l.stats {
+		v[class] = s
+	}
+	return v
+}
+
+//broadcast wakes all waiters. Must be called with l locked.
+func (l *rateLimiter) broadcast() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+//blocked returns how long w has to wait at least; 0 means it may proceed now. Must be called with l locked.
+func (l *rateLimiter) blocked(w *waiter) time.Duration {
+	if d := l.buckets[w.class].ready(); d > 0 {
+		return d
+	}
+	shared := l.buckets[AllClasses]
+	if d := shared.ready(); d > 0 {
+		return d
+	}
+	if shared == nil || shared.limit.Rate <= 0 {
+		return 0
+	}
+	//the shared token goes to the most urgent waiter that isn't held back by its own class budget.
+	for x := range l.waiters {
+		if x != w && x.before(w) && l.buckets[x.class].ready() == 0 {
+			return shared.ready() + time.Millisecond
+		}
+	}
+	return 0
+}
+
+//wait blocks until r may be sent or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, r request) error {
+	if l == nil {
+		return nil
+	}
+	start := time.Now()
+	w := &waiter{class: r.class(), priority: r.priority()}
+
+	l.Lock()
+	l.seq++
+	w.seq = l.seq
+	l.waiters[w] = struct{}{}
+	defer func() {
+		delete(l.waiters, w)
+		l.broadcast()
+		l.Unlock()
+	}()
+
+	for {
+		now := time.Now()
+		for _, b := range l.buckets {
+			b.refill(now)
+		}
+		d := l.blocked(w)
+		if d == 0 {
+			break
+		}
+
+		wake := l.wake
+		l.Unlock()
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-wake:
+		case <-ctx.Done():
+		}
+		t.Stop()
+		l.Lock()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	l.buckets[w.class].take()
+	l.buckets[AllClasses].take()
+
+	waited := time.Since(start)
+	s := l.stats[w.class]
+	s.Requests++
+	if waited > time.Millisecond {
+		s.Delayed++
+		s.TotalWait += waited
+		if waited > s.MaxWait {
+			s.MaxWait = waited
+		}
+	}
+	l.stats[w.class] = s
+	return nil
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+//RetryPolicy controls how often and when failed API calls are retried.
+//Only calls that are safe to repeat (quotes, orderbooks, order status, cancels, ...) are retried automatically.
+type RetryPolicy struct {
+	//MaxAttempts is the maximum number of attempts per call, including the first one. Values < 2 disable retries.
+	MaxAttempts int
+	//MinBackoff and MaxBackoff bound the exponential backoff between attempts. The actual wait is jittered.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	//RetryableStatus lists the HTTP status codes that are worth another attempt. Transport errors are always retryable.
+	RetryableStatus []int
+
+	//RetryNewOrder allows retrying a failed NewOrder. Before each new attempt the open orders are reconciled with
+	//StockOrderStatus and if an order matching the request (placed no earlier than ClockSkew before the first attempt)
+	//shows up, it is returned instead of submitting the order a second time. A call isn't retried if an identical
+	//order was placed concurrently, as the orders can't be told apart.
+	RetryNewOrder bool
+	ClockSkew     time.Duration
+}
+
+//DefaultRetryPolicy is the retry policy of new instances.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:     3,
+	MinBackoff:      100 * time.Millisecond,
+	MaxBackoff:      2 * time.Second,
+	RetryableStatus: []int{429, 500, 502, 503, 504},
+	ClockSkew:       5 * time.Second,
+}
+
+//NoRetry disables retries: every call is attempted exactly once.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+//SetRetryPolicy changes the retry policy of an instance.
+func (i *Instance) SetRetryPolicy(p RetryPolicy) {
+	i.Lock()
+	i.retry = p
+	i.Unlock()
+}
+
+func (i *Instance) getRetryPolicy() RetryPolicy {
+	i.RLock()
+	defer i.RUnlock()
+	return i.retry
+}
+
+//retryable reports whether err is a failure another attempt could fix.
+func (p RetryPolicy) retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		for _, status := range p.RetryableStatus {
+			if apiErr.StatusCode == status {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//backoff returns the jittered wait before the attempt following attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.MinBackoff
+	for k := 1; k < attempt && d < p.MaxBackoff; k++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	//"equal jitter": wait at least half of the backoff so retries don't bunch up at zero.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+//sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//reset zeroes the value v points to, so a retry doesn't inherit fields decoded from a failed attempt.
+func reset(v apiResponse) {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+	}
+}
+
+//statusCode returns the HTTP status of a call that returned err, 0 if there was no response.
+func statusCode(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+//doHTTP performs an API call, retrying it according to the retry policy of the instance.
+//Calls that aren't idempotent are only retried if they can be reconciled (see RetryPolicy.RetryNewOrder).
+func (i *Instance) doHTTP(ctx context.Context, r request, v apiResponse) (err error) {
+	p := i.getRetryPolicy()
+	r.id = i.logs.nextID()
+	ctx, span := i.tracer.Start(ctx, r.method+" "+r.endpoint, SpanKindClient)
+	if span != nil {
+		span.SetAttr("http.request.method", r.method)
+		span.SetAttr("url.full", r.url)
+		span.SetAttr("request", int64(r.id))
+		defer func() {
+			span.SetAttr("attempts", r.attempt)
+			span.SetAttr("http.response.status_code", statusCode(err))
+			span.End(err)
+		}()
+	}
+
+	for attempt := 1; ; attempt++ {
+		r.attempt = attempt
+		err := i.doHTTPOnce(ctx, r, v)
+		if err == nil {
+			return nil
+		}
+		i.metrics.errors.Inc(r.endpoint, errorType(err))
+		if attempt >= p.MaxAttempts || !p.retryable(ctx, err) || !r.idempotent && (r.reconcile == nil || !p.RetryNewOrder) {
+			i.log(ctx, SubsystemHTTP, slog.LevelInfo, "http failed", r.logAttrs(slog.Int("attempt", attempt), slog.Any("err", err))...)
+			return err
+		}
+
+		backoff := p.backoff(attempt)
+		i.log(ctx, SubsystemHTTP, slog.LevelInfo, "http retry",
+			r.logAttrs(slog.Int("attempt", attempt), slog.Duration("backoff", backoff), slog.Any("err", err))...)
+		span.AddEvent("retry", time.Now(), Attr{"attempt", attempt}, Attr{"backoff_ms", backoff.Milliseconds()}, Attr{"error", err.Error()})
+		if sleep(ctx, backoff) != nil {
+			return err
+		}
+		reset(v)
+
+		if !r.idempotent {
+			done, reconcileErr := r.reconcile(ctx, p)
+			if reconcileErr != nil {
+				return err
+			}
+			if done {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+//RiskLimits configures the pre-trade checks NewOrder runs before an order is sent. A zero value disables a check.
+type RiskLimits struct {
+	MaxPosition   int           //max absolute position per stock, counting all open orders as if they were filled
+	MaxOrderSize  int           //max quantity of a single order
+	MaxNotional   int           //max value (price * quantity) of a single order in cents
+	MaxOpenOrders int           //max number of open orders of the account
+	PriceCollar   float64       //max deviation of a limit price from the last quote, e.g. 0.05 for 5%
+	MaxQuoteAge   time.Duration //quotes received longer ago than this don't count as last quote
+}
+
+//RiskRule names the check that rejected an order.
+type RiskRule string
+
+//Risk rules.
+const (
+	RuleKillSwitch    RiskRule = "kill switch"
+	RuleMaxPosition   RiskRule = "max position"
+	RuleMaxOrderSize  RiskRule = "max order size"
+	RuleMaxNotional   RiskRule = "max notional"
+	RuleMaxOpenOrders RiskRule = "max open orders"
+	RulePriceCollar   RiskRule = "price collar"
+)
+
+//Sentinel errors for orders rejected before they were sent. A *RiskError also matches ErrOrderRejected.
+var (
+	ErrRiskRejected = errors.New("rejected by risk limits")
+	ErrKillSwitch   = errors.New("kill switch engaged")
+)
+
+//RiskError is returned by NewOrder when an order violates the risk limits. The order never reaches the API.
+type RiskError struct {
+	Rule   RiskRule
+	Venue  string
+	Symbol string
+	Limit  int //configured limit, for the price collar the highest or lowest allowed price
+	Value  int //value the order would have reached, 0 for a market order that couldn't be valued
+}
+
+func (e *RiskError) Error() string {
+	if e.Rule == RuleKillSwitch {
+		return fmt.Sprintf("risk: %s/%s: %s", e.Venue, e.Symbol, ErrKillSwitch)
+	}
+	if e.Rule == RulePriceCollar && e.Limit == 0 || e.Rule == RuleMaxNotional && e.Value == 0 {
+		return fmt.Sprintf("risk: %s/%s: %s: no recent quote", e.Venue, e.Symbol, e.Rule)
+	}
+	return fmt.Sprintf("risk: %s/%s: %s exceeded: %d (limit %d)", e.Venue, e.Symbol, e.Rule, e.Value, e.Limit)
+}
+
+//Is allows matching a RiskError against ErrRiskRejected, ErrKillSwitch and ErrOrderRejected.
+func (e *RiskError) Is(target error) bool {
+	switch target {
+	case ErrRiskRejected, ErrOrderRejected:
+		return true
+	case ErrKillSwitch:
+		return e.Rule == RuleKillSwitch
+	}
+	return false
+}
+
+//Exposure is the risk gate's view of a stock.
+type Exposure struct {
+	Position   int //shares held, negative when short
+	OpenBuy    int //shares still to be bought by open orders
+	OpenSell   int //shares still to be sold by open orders
+	OpenOrders int //number of open orders in the stock
+}
+
+type riskOrderKey struct {
+	venue string
+	id    int
+}
+
+type riskStockKey struct {
+	account string
+	venue   string
+	symbol  string
+}
+
+type riskQuote struct {
+	q        Quote
+	received time.Time
+}
+
+//riskGate tracks orders and quotes seen by an instance and checks new orders against the limits.
+type riskGate struct {
+	sync.Mutex
+	limits  RiskLimits
+	killed  bool
+	orders  map[riskOrderKey]Order
+	pending map[*orderRequest]struct{} //orders that passed the checks and wait for the API response
+	quotes  map[positionKey]riskQuote
+	venues  map[string]bool //venues orders were seen on, searched by the kill switch
+}
+
+func newRiskGate() *riskGate {
+	return &riskGate{
+		orders:  map[riskOrderKey]Order{},
+		pending: map[*orderRequest]struct{}{},
+		quotes:  map[positionKey]riskQuote{},
+		venues:  map[string]bool{},
+	}
+}
+
+//SetRiskLimits changes the limits NewOrder checks orders against.
+func (i *Instance) SetRiskLimits(l RiskLimits) {
+	i.risk.Lock()
+	i.risk.limits = l
+	i.risk.Unlock()
+}
+
+//GetRiskLimits returns the current risk limits.
+func (i *Instance) GetRiskLimits() RiskLimits {
+	i.risk.Lock()
+	defer i.risk.Unlock()
+	return i.risk.limits
+}
+
+//Exposure returns the position and open orders of the current account in a stock, as far as the risk gate knows them.
+//Orders placed by other programs are only known after RefreshRisk.
+func (i *Instance) Exposure(venue, symbol string) Exposure {
+	account := i.GetAccount()
+	i.risk.Lock()
+	defer i.risk.Unlock()
+	return i.risk.exposure(account, venue, symbol)
+}
+
+//RefreshRisk loads all orders of the current account on the given venues (the current venue if none are given),
+//so that positions and open orders from before this instance existed count against the limits.
+func (i *Instance) RefreshRisk(ctx context.Context, venues ...string) error {
+	if len(venues) == 0 {
+		venues = []string{i.GetVenue()}
+	}
+	account := i.GetAccount()
+	for _, venue := range venues {
+		//the result gets picked up by the risk gate like every other response.
+		if _, err := i.accountOrderStatus(ctx, venue, account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//KillSwitch rejects every new order until ResetKillSwitch is called and cancels all open orders of the current account.
+//Open orders are looked up on every venue the instance has seen orders on, plus the current one.
+//All orders are attempted even if some cancellations fail; the first error is returned.
+func (i *Instance) KillSwitch(ctx context.Context) error {
+	i.RLock()
+	account, current := i.account, i.venue
+	i.RUnlock()
+
+	i.risk.Lock()
+	i.risk.killed = true
+	venues := []string{current}
+	for venue := range i.risk.venues {
+		if venue != current {
+			venues = append(venues, venue)
+		}
+	}
+	i.risk.Unlock()
+
+	var firstErr error
+	for _, venue := range venues {
+		if _, err := i.accountOrderStatus(ctx, venue, account); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	i.risk.Lock()
+	var open []Order
+	for _, o := range i.risk.orders {
+		if o.Open && o.Account == account {
+			open = append(open, o)
+		}
+	}
+	i.risk.Unlock()
+
+	for _, o := range open {
+		if _, err := i.cancelOrder(ctx, o.Venue, o.Symbol, o.ID); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+//ResetKillSwitch allows new orders again after KillSwitch.
+func (i *Instance) ResetKillSwitch() {
+	i.risk.Lock()
+	i.risk.killed = false
+	i.risk.Unlock()
+}
+
+//Killed reports whether the kill switch is engaged.
+func (i *Instance) Killed() bool {
+	i.risk.Lock()
+	defer i.risk.Unlock()
+	return i.risk.killed
+}
+
+//observe records orders and quotes from API responses and websocket messages.
+func (g *riskGate) observe(v apiResponse) {
+	if g == nil {
+		return
+	}
+	g.Lock()
+	defer g.Unlock()
+	switch v := v.(type) {
+	case *Order:
+		g.observeOrder(*v)
+	case *allOrdersStatusResult:
+		for _, o := range v.Orders {
+			g.observeOrder(o)
+		}
+	case *Execution:
+		g.observeOrder(v.Order)
+	case *Quote:
+		g.observeQuote(*v)
+	case *wsQuote:
+		g.observeQuote(v.Quote)
+	}
+}
+
+//observeOrder stores the most recent state of an order. Must be called with g locked.
+func (g *riskGate) observeOrder(o Order) {
+	if o.ID == 0 && o.Venue == "" {
+		return
+	}
+	k := riskOrderKey{o.Venue, o.ID}
+	if old, ok := g.orders[k]; ok {
+		//responses may arrive out of order; fills only grow and closed orders stay closed.
+		if o.TotalFilled < old.TotalFilled || (!old.Open && o.Open) {
+			return
+		}
+	}
+	g.orders[k] = o
+	g.venues[o.Venue] = true
+}
+
+//observeQuote stores the newest quote of a stock. Must be called with g locked.
+func (g *riskGate) observeQuote(q Quote) {
+	k := positionKey{q.Venue, q.Symbol}
+	if old, ok := g.quotes[k]; ok && q.QuoteTime.Before(old.q.QuoteTime) {
+		return
+	}
+	g.quotes[k] = riskQuote{q, time.Now()}
+}
+
+//exposure sums up the known orders of an account in a stock. Must be called with g locked.
+func (g *riskGate) exposure(account, venue, symbol string) (e Exposure) {
+	add := func(d OrderDirection, filled, remaining int, open bool) {
+		if d == Sell {
+			e.Position -= filled
+		} else {
+			e.Position += filled
+		}
+		if !open {
+			return
+		}
+		e.OpenOrders++
+		if d == Sell {
+			e.OpenSell += remaining
+		} else {
+			e.OpenBuy += remaining
+		}
+	}
+	for _, o := range g.orders {
+		if o.Account == account && o.Venue == venue && o.Symbol == symbol {
+			add(o.Direction, o.TotalFilled, o.Quantity, o.Open)
+		}
+	}
+	for o := range g.pending {
+		if o.Account == account && o.Venue == venue && o.Symbol == symbol {
+			add(o.Direction, 0, o.Quantity, true)
+		}
+	}
+	return
+}
+
+//openOrders counts the open and pending orders of an account. Must be called with g locked.
+func (g *riskGate) openOrders(account string) (n int) {
+	for o := range g.pending {
+		if o.Account == account {
+			n++
+		}
+	}
+	for _, o := range g.orders {
+		if o.Open && o.Account == account {
+			n++
+		}
+	}
+	return
+}
+
+//reference returns the price of the last quote an order in the stock gets compared to, or 0 if there is no recent quote.
+//Must be called with g locked.
+func (g *riskGate) reference(venue, symbol string) (ref, bid, ask int) {
+	rq, ok := g.quotes[positionKey{venue, symbol}]
+	if !ok || (g.limits.MaxQuoteAge > 0 && time.Since(rq.received) > g.limits.MaxQuoteAge) {
+		return 0, 0, 0
+	}
+	q := rq.q
+	ref = q.LastPrice
+	if q.Bid > 0 && q.Ask > 0 {
+		ref = (q.Bid + q.Ask) / 2
+	}
+	return ref, q.Bid, q.Ask
+}
+
+//check runs all pre-trade checks on o. If it passes, o is reserved as pending until release is called.
+func (g *riskGate) check(o *orderRequest) error {
+	if g == nil {
+		return nil
+	}
+	g.Lock()
+	defer g.Unlock()
+	l := g.limits
+	reject := func(rule RiskRule, limit, value int) error {
+		return &RiskError{rule, o.Venue, o.Symbol, limit, value}
+	}
+
+	if g.killed {
+		return reject(RuleKillSwitch, 0, 0)
+	}
+	if l.MaxOrderSize > 0 && o.Quantity > l.MaxOrderSize {
+		return reject(RuleMaxOrderSize, l.MaxOrderSize, o.Quantity)
+	}
+
+	ref, bid, ask := g.reference(o.Venue, o.Symbol)
+	if l.PriceCollar > 0 && o.OrderType != Market {
+		if ref == 0 {
+			return reject(RulePriceCollar, 0, o.Price)
+		}
+		band := int(math.Round(float64(ref) * l.PriceCollar))
+		if o.Price > ref+band {
+			return reject(RulePriceCollar, ref+band, o.Price)
+		}
+		if o.Price < ref-band {
+			return reject(RulePriceCollar, ref-band, o.Price)
+		}
+	}
+
+	if l.MaxNotional > 0 {
+		//market orders fill at whatever the book offers, so they're valued at the far side of the last quote.
+		//Without a recent quote they can't be valued at all.
+		price := o.Price
+		if o.OrderType == Market {
+			switch {
+			case o.Direction == Buy && ask > 0:
+				price = ask
+			case o.Direction == Sell && bid > 0:
+				price = bid
+			case ref > 0:
+				price = ref
+			default:
+				return reject(RuleMaxNotional, l.MaxNotional, 0)
+			}
+		}
+		if notional := price * o.Quantity; notional > l.MaxNotional {
+			return reject(RuleMaxNotional, l.MaxNotional, notional)
+		}
+	}
+
+	if l.MaxOpenOrders > 0 {
+		if n := g.openOrders(o.Account) + 1; n > l.MaxOpenOrders {
+			return reject(RuleMaxOpenOrders, l.MaxOpenOrders, n)
+		}
+	}
+
+	if l.MaxPosition > 0 {
+		e := g.exposure(o.Account, o.Venue, o.Symbol)
+		if o.Direction == Sell {
+			if worst := e.Position - e.OpenSell - o.Quantity; -worst > l.MaxPosition {
+				return reject(RuleMaxPosition, l.MaxPosition, -worst)
+			}
+		} else if worst := e.Position + e.OpenBuy + o.Quantity; worst > l.MaxPosition {
+			return reject(RuleMaxPosition, l.MaxPosition, worst)
+		}
+	}
+
+	g.pending[o] = struct{}{}
+	return nil
+}
+
+//release removes the reservation of an order once the API answered. The answer itself gets recorded by observe.
+func (g *riskGate) release(o *orderRequest) {
+	if g == nil {
+		return
+	}
+	g.Lock()
+	delete(g.pending, o)
+	g.Unlock()
+}
@@ -0,0 +1,78 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/api/apitest"
+)
+
+func TestRiskMarketOrderWithoutQuote(t *testing.T) {
+	apitest.Start(t, nil)
+	ctx := context.Background()
+	other := api.NewInstance("", "OTHER", "TESTEX", "FOOBAR")
+	if _, err := other.NewOrderCtx(ctx, 1000, 5, api.Sell, api.Limit); err != nil {
+		t.Fatal(err)
+	}
+
+	i := api.NewTestInstance()
+	i.SetRiskLimits(api.RiskLimits{MaxNotional: 10000})
+	_, err := i.NewOrderCtx(ctx, 0, 5, api.Buy, api.Market)
+	var re *api.RiskError
+	if !errors.As(err, &re) || re.Rule != api.RuleMaxNotional || !strings.Contains(err.Error(), "no recent quote") {
+		t.Fatal("market order without quote:", err)
+	}
+
+	if _, err := i.QuoteCtx(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := i.NewOrderCtx(ctx, 0, 11, api.Buy, api.Market); !errors.As(err, &re) || re.Value != 11000 {
+		t.Fatal("market order valued at the ask:", err)
+	}
+	if _, err := i.NewOrderCtx(ctx, 0, 5, api.Buy, api.Market); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRiskOpenOrdersPerAccount(t *testing.T) {
+	apitest.Start(t, nil)
+	ctx := context.Background()
+
+	//the first order is held in flight while the instance trades for another account
+	arrived, release := make(chan struct{}), make(chan struct{})
+	i := api.NewTestInstance(api.WithMiddleware(func(next http.RoundTripper) http.RoundTripper {
+		return api.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == "POST" && strings.Contains(req.URL.Path, "/orders") {
+				select {
+				case arrived <- struct{}{}:
+					<-release
+				default:
+				}
+			}
+			return next.RoundTrip(req)
+		})
+	}))
+	i.SetRiskLimits(api.RiskLimits{MaxOpenOrders: 1})
+	done := make(chan error)
+	go func() {
+		_, err := i.NewOrderCtx(ctx, 100, 1, api.Buy, api.Limit)
+		done <- err
+	}()
+	<-arrived
+
+	i.SetAccount("OTHER")
+	if _, err := i.NewOrderCtx(ctx, 100, 1, api.Buy, api.Limit); err != nil {
+		t.Error("pending order of another account counted:", err)
+	}
+	if _, err := i.NewOrderCtx(ctx, 100, 1, api.Buy, api.Limit); !errors.Is(err, api.ErrRiskRejected) {
+		t.Error("second open order of the account:", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
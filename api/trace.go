@@ -0,0 +1,363 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+//TraceFlushInterval is the interval in which a Tracer exports the spans that ended.
+var TraceFlushInterval = time.Second
+
+//maxTracedOrders bounds the orders a Tracer remembers to link executions to, the oldest are forgotten first.
+//It bounds the executions waiting for their order as well.
+const maxTracedOrders = 10000
+
+//earlyExecutionWait is how long an execution of an unknown order is kept, so it can be traced if the response to its
+//NewOrder arrives after it. Marketable orders are often filled before their response is read.
+const earlyExecutionWait = 5 * time.Second
+
+//WithTracer makes the instance trace its API calls with t. Without a tracer nothing is traced.
+func WithTracer(t *Tracer) Option {
+	return func(o *options) {
+		o.tracer = t
+	}
+}
+
+//Tracer records spans and exports them with a SpanExporter. The spans follow the OpenTelemetry model, so the
+//exporters of this package write OTLP that any OpenTelemetry tool reads.
+//
+//An instance with a tracer opens a span for every API call (with an event for every retry) and one for every
+//NewOrder. Each Execution of a traced order gets a span in the trace of its NewOrder that starts when the order was
+//sent and ends when the execution arrived, so its duration is the order-to-fill latency.
+//
+//A nil *Tracer is valid and records nothing.
+type Tracer struct {
+	exp     SpanExporter
+	service string
+
+	mu      sync.Mutex
+	pending []SpanData
+	orders  map[orderKey]orderSpan
+	queue   []orderKey       //order of insertion into orders, for eviction
+	early   []earlyExecution //executions of unknown orders in order of arrival
+	err     error
+
+	kick      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type orderKey struct {
+	venue string
+	id    int
+}
+
+//orderSpan is what executions need to know about the NewOrder span of their order.
+type orderSpan struct {
+	traceID, spanID string
+	start           time.Time
+}
+
+//earlyExecution is an execution that arrived before its order was known.
+type earlyExecution struct {
+	e        Execution
+	received time.Time
+}
+
+//NewTracer returns a Tracer exporting the spans of service with exp every TraceFlushInterval.
+//Close it to export the remaining spans.
+func NewTracer(service string, exp SpanExporter) *Tracer {
+	t := &Tracer{
+		exp:     exp,
+		service: service,
+		orders:  map[orderKey]orderSpan{},
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go t.flusher()
+	return t
+}
+
+func (t *Tracer) flusher() {
+	defer close(t.done)
+	ticker := time.NewTicker(TraceFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.kick:
+		case <-t.stop:
+			return
+		}
+		t.Flush()
+	}
+}
+
+//Flush exports the spans that ended so far. It returns the error of the exporter.
+func (t *Tracer) Flush() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+	err := t.exp.ExportSpans(t.service, spans)
+	if err != nil {
+		t.mu.Lock()
+		t.err = err
+		t.mu.Unlock()
+	}
+	return err
+}
+
+//Err returns the last error of the exporter.
+func (t *Tracer) Err() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+//Close stops the background export and exports the remaining spans. Calling it again only exports the spans that
+//ended since.
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.closeOnce.Do(func() { close(t.stop) })
+	<-t.done
+	return t.Flush()
+}
+
+//end queues an ended span for export.
+func (t *Tracer) end(d SpanData) {
+	t.mu.Lock()
+	t.pending = append(t.pending, d)
+	full := len(t.pending) >= 512
+	t.mu.Unlock()
+	if full {
+		select {
+		case t.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+//SpanKind tells what a span describes, as in OpenTelemetry.
+type SpanKind int
+
+//Span kinds, numbered like in OTLP.
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindClient   SpanKind = 3
+)
+
+//Span is an operation in a trace. Its methods may be called from several goroutines; a nil *Span ignores all calls.
+type Span struct {
+	t     *Tracer
+	mu    sync.Mutex
+	d     SpanData
+	ended bool
+}
+
+type spanKey struct{}
+
+//SpanFromContext returns the span stored in ctx, nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+//Start opens a span called name. It is a child of the span in ctx if there is one, otherwise it starts a new trace.
+//The returned context carries the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{t: t, d: SpanData{SpanID: newID(8), Name: name, Kind: kind, Start: time.Now()}}
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.d.TraceID, s.d.ParentID = parent.d.TraceID, parent.d.SpanID
+	} else {
+		s.d.TraceID = newID(16)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+//newID returns a random ID of n bytes in hex, as trace and span IDs are written in OTLP.
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+//SetAttr sets an attribute of the span. Values are strings, ints, floats or bools, anything else is formatted.
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.d.Attributes = append(s.d.Attributes, Attr{key, value})
+	s.mu.Unlock()
+}
+
+//AddEvent records that something happened at time t during the span.
+func (s *Span) AddEvent(name string, t time.Time, attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.d.Events = append(s.d.Events, SpanEvent{name, t, attrs})
+	s.mu.Unlock()
+}
+
+//End ends the span, with an error status if err isn't nil. Only the first call counts.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.d.End = time.Now()
+	if err != nil {
+		s.d.Err = err.Error()
+	}
+	d := s.d
+	s.mu.Unlock()
+	s.t.end(d)
+}
+
+//traceparent returns the W3C trace context header of the span.
+func (s *Span) traceparent() string {
+	return "00-" + s.d.TraceID + "-" + s.d.SpanID + "-01"
+}
+
+//order remembers the NewOrder span of o, so its executions can be traced. Executions of o that arrived before are
+//traced now. An order that is closed and has no executions to come is not remembered.
+func (t *Tracer) order(o Order, s *Span) {
+	if t == nil || s == nil {
+		return
+	}
+	k := orderKey{o.Venue, o.ID}
+	span := orderSpan{s.d.TraceID, s.d.SpanID, s.d.Start}
+	t.mu.Lock()
+	var early []earlyExecution
+	filled := 0
+	t.pruneEarly(time.Now())
+	kept := t.early[:0]
+	for _, x := range t.early {
+		if (orderKey{x.e.Order.Venue, x.e.Order.ID}) != k {
+			kept = append(kept, x)
+			continue
+		}
+		early = append(early, x)
+		if x.e.Order.TotalFilled > filled {
+			filled = x.e.Order.TotalFilled
+		}
+	}
+	for n := len(kept); n < len(t.early); n++ {
+		t.early[n] = earlyExecution{}
+	}
+	t.early = kept
+	if o.Open || o.TotalFilled > filled {
+		if _, ok := t.orders[k]; !ok {
+			t.queue = append(t.queue, k)
+		}
+		t.orders[k] = span
+		for len(t.queue) > maxTracedOrders {
+			delete(t.orders, t.queue[0])
+			t.queue = t.queue[1:]
+		}
+	}
+	t.mu.Unlock()
+
+	for _, x := range early {
+		t.end(executionSpan(span, x.e, x.received))
+	}
+}
+
+//pruneEarly drops the executions that waited too long for their order. t.mu must be held.
+func (t *Tracer) pruneEarly(now time.Time) {
+	n := 0
+	for n < len(t.early) && (len(t.early)-n > maxTracedOrders || now.Sub(t.early[n].received) > earlyExecutionWait) {
+		t.early[n] = earlyExecution{}
+		n++
+	}
+	t.early = t.early[n:]
+}
+
+//forget drops an order that won't be filled anymore.
+func (t *Tracer) forget(o Order) {
+	if t == nil || o.Open {
+		return
+	}
+	t.mu.Lock()
+	delete(t.orders, orderKey{o.Venue, o.ID})
+	t.mu.Unlock()
+}
+
+//execution records a span for an execution of a traced order, from sending the order to receiving the execution.
+//Executions of unknown orders are kept for a while in case their NewOrder is still waiting for its response.
+func (t *Tracer) execution(e Execution) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	o, ok := t.orders[orderKey{e.Order.Venue, e.Order.ID}]
+	if !ok {
+		t.early = append(t.early, earlyExecution{e, now})
+		t.pruneEarly(now)
+	}
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+	t.end(executionSpan(o, e, now))
+	t.forget(e.Order)
+}
+
+//executionSpan returns the span of an execution of the order of o that was received at now.
+func executionSpan(o orderSpan, e Execution, now time.Time) SpanData {
+	d := SpanData{
+		TraceID:  o.traceID,
+		SpanID:   newID(8),
+		ParentID: o.spanID,
+		Name:     "execution",
+		Kind:     SpanKindInternal,
+		Start:    o.start,
+		End:      now,
+		Attributes: []Attr{
+			{"order.id", e.Order.ID},
+			{"venue", e.Order.Venue},
+			{"symbol", e.Order.Symbol},
+			{"fill.price", e.Price},
+			{"fill.qty", e.Filled},
+			{"order.filled", e.Order.TotalFilled},
+			{"order.open", e.Order.Open},
+			{"latency.order_to_fill_ms", float64(now.Sub(o.start)) / float64(time.Millisecond)},
+		},
+		Events: []SpanEvent{{Name: "received", Time: now}},
+		Links:  []SpanLink{{TraceID: o.traceID, SpanID: o.spanID}},
+	}
+	//the exchange clock may be off, so this is only comparable between fills
+	if !e.FilledAt.IsZero() {
+		d.Events = append([]SpanEvent{{Name: "filled at exchange", Time: e.FilledAt}}, d.Events...)
+		d.Attributes = append(d.Attributes, Attr{"latency.exchange_to_client_ms", float64(now.Sub(e.FilledAt)) / float64(time.Millisecond)})
+	}
+	return d
+}
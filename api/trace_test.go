@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+//collector keeps the exported spans.
+type collector struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (c *collector) ExportSpans(service string, spans []SpanData) error {
+	c.mu.Lock()
+	c.spans = append(c.spans, spans...)
+	c.mu.Unlock()
+	return nil
+}
+
+//executions returns the execution spans exported so far.
+func (c *collector) executions() (v []SpanData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, d := range c.spans {
+		if d.Name == "execution" {
+			v = append(v, d)
+		}
+	}
+	return
+}
+
+func TestTracerEarlyExecution(t *testing.T) {
+	c := &collector{}
+	tr := NewTracer("test", c)
+	defer tr.Close()
+	_, span := tr.Start(context.Background(), "new order", SpanKindInternal)
+
+	//the execution of a marketable order arrives before the response of its NewOrder
+	o := Order{Venue: "TESTEX", ID: 1, OriginalQuantity: 10, Quantity: 6, TotalFilled: 4, Open: true}
+	tr.execution(Execution{Order: o, Filled: 4})
+	tr.Flush()
+	if len(c.executions()) != 0 {
+		t.Fatal("traced without order", c.executions())
+	}
+	tr.order(o, span)
+	tr.Flush()
+	if v := c.executions(); len(v) != 1 || v[0].ParentID != span.d.SpanID || v[0].TraceID != span.d.TraceID {
+		t.Fatalf("early execution %+v", v)
+	}
+
+	//the order stays known until it is closed
+	o.Quantity, o.TotalFilled, o.Open = 0, 10, false
+	tr.execution(Execution{Order: o, Filled: 6})
+	tr.Flush()
+	if v := c.executions(); len(v) != 2 || v[1].ParentID != span.d.SpanID {
+		t.Fatalf("late execution %+v", v)
+	}
+	if len(tr.orders) != 0 || len(tr.early) != 0 {
+		t.Error("not forgotten", tr.orders, tr.early)
+	}
+}
+
+func TestTracerClosedOrder(t *testing.T) {
+	tr := NewTracer("test", &collector{})
+	defer tr.Close()
+	_, span := tr.Start(context.Background(), "new order", SpanKindInternal)
+
+	//killed without a fill, no execution will come
+	tr.order(Order{Venue: "TESTEX", ID: 1}, span)
+	//filled completely, the executions came first
+	o := Order{Venue: "TESTEX", ID: 2, OriginalQuantity: 10, TotalFilled: 10}
+	tr.execution(Execution{Order: o, Filled: 10})
+	tr.order(o, span)
+	if len(tr.orders) != 0 || len(tr.early) != 0 {
+		t.Error("closed orders remembered", tr.orders, tr.early)
+	}
+
+	//filled completely, the executions are still to come
+	o.ID = 3
+	tr.order(o, span)
+	if _, ok := tr.orders[orderKey{"TESTEX", 3}]; !ok {
+		t.Error("filled order forgotten before its executions")
+	}
+	tr.execution(Execution{Order: o, Filled: 10})
+	if len(tr.orders) != 0 {
+		t.Error("not forgotten after the last execution", tr.orders)
+	}
+}
+
+func TestTracerCloseTwice(t *testing.T) {
+	tr := NewTracer("test", &collector{})
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//SpanData is an ended span as it gets exported. IDs are in hex.
+type SpanData struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string //empty for the root of a trace
+	Name       string
+	Kind       SpanKind
+	Start      time.Time
+	End        time.Time
+	Attributes []Attr
+	Events     []SpanEvent
+	Links      []SpanLink
+	Err        string //error of the operation, empty if it succeeded
+}
+
+//Attr is an attribute of a span or event.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+//SpanEvent is something that happened during a span.
+type SpanEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes []Attr
+}
+
+//SpanLink relates a span to a span of another operation, e.g. an execution to its NewOrder.
+type SpanLink struct {
+	TraceID    string
+	SpanID     string
+	Attributes []Attr
+}
+
+//SpanExporter exports spans of a service, see NewFileExporter and NewOTLPExporter.
+type SpanExporter interface {
+	ExportSpans(service string, spans []SpanData) error
+}
+
+//fileExporter writes OTLP/JSON lines.
+type fileExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+//NewFileExporter returns an exporter writing every batch of spans to w as one line of OTLP/JSON, the format of the
+//file exporter of the OpenTelemetry collector.
+func NewFileExporter(w io.Writer) SpanExporter {
+	return &fileExporter{w: w}
+}
+
+func (e *fileExporter) ExportSpans(service string, spans []SpanData) error {
+	b, err := json.Marshal(otlpRequest(service, spans))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(b, '\n'))
+	return err
+}
+
+//otlpExporter posts OTLP/JSON to a collector.
+type otlpExporter struct {
+	url string
+	c   *http.Client
+}
+
+//NewOTLPExporter returns an exporter posting spans as OTLP/JSON over HTTP to url, e.g.
+//http://localhost:4318/v1/traces for a local collector.
+func NewOTLPExporter(url string) SpanExporter {
+	return &otlpExporter{url: url, c: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (e *otlpExporter) ExportSpans(service string, spans []SpanData) error {
+	b, err := json.Marshal(otlpRequest(service, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), "POST", e.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := e.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export: %s", res.Status)
+	}
+	return nil
+}
+
+//The OTLP/JSON encoding, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID      string         `json:"traceId"`
+		SpanID       string         `json:"spanId"`
+		ParentSpanID string         `json:"parentSpanId,omitempty"`
+		Name         string         `json:"name"`
+		Kind         SpanKind       `json:"kind"`
+		Start        string         `json:"startTimeUnixNano"`
+		End          string         `json:"endTimeUnixNano"`
+		Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+		Events       []otlpEvent    `json:"events,omitempty"`
+		Links        []otlpLink     `json:"links,omitempty"`
+		Status       otlpStatus     `json:"status"`
+	}
+	otlpEvent struct {
+		Time       string         `json:"timeUnixNano"`
+		Name       string         `json:"name"`
+		Attributes []otlpKeyValue `json:"attributes,omitempty"`
+	}
+	otlpLink struct {
+		TraceID    string         `json:"traceId"`
+		SpanID     string         `json:"spanId"`
+		Attributes []otlpKeyValue `json:"attributes,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		String *string  `json:"stringValue,omitempty"`
+		Int    *string  `json:"intValue,omitempty"` //int64 is a string in OTLP/JSON
+		Double *float64 `json:"doubleValue,omitempty"`
+		Bool   *bool    `json:"boolValue,omitempty"`
+	}
+)
+
+func otlpRequest(service string, spans []SpanData) otlpTraces {
+	v := make([]otlpSpan, len(spans))
+	for k, s := range spans {
+		v[k] = otlpSpan{
+			TraceID:      s.TraceID,
+			SpanID:       s.SpanID,
+			ParentSpanID: s.ParentID,
+			Name:         s.Name,
+			Kind:         s.Kind,
+			Start:        unixNano(s.Start),
+			End:          unixNano(s.End),
+			Attributes:   otlpAttrs(s.Attributes),
+			Status:       otlpStatus{Code: 1},
+		}
+		if s.Err != "" {
+			v[k].Status = otlpStatus{Code: 2, Message: s.Err}
+		}
+		for _, e := range s.Events {
+			v[k].Events = append(v[k].Events, otlpEvent{unixNano(e.Time), e.Name, otlpAttrs(e.Attributes)})
+		}
+		for _, l := range s.Links {
+			v[k].Links = append(v[k].Links, otlpLink{l.TraceID, l.SpanID, otlpAttrs(l.Attributes)})
+		}
+	}
+	return otlpTraces{[]otlpResourceSpans{{
+		Resource:   otlpResource{otlpAttrs([]Attr{{"service.name", service}})},
+		ScopeSpans: []otlpScopeSpans{{otlpScope{"github.com/ianberinger/stockfighter/api"}, v}},
+	}}}
+}
+
+func unixNano(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpAttrs(attrs []Attr) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	v := make([]otlpKeyValue, len(attrs))
+	for k, a := range attrs {
+		v[k].Key = a.Key
+		switch x := a.Value.(type) {
+		case string:
+			v[k].Value.String = &x
+		case int:
+			s := strconv.Itoa(x)
+			v[k].Value.Int = &s
+		case int64:
+			s := strconv.FormatInt(x, 10)
+			v[k].Value.Int = &s
+		case float64:
+			v[k].Value.Double = &x
+		case bool:
+			v[k].Value.Bool = &x
+		default:
+			s := fmt.Sprint(x)
+			v[k].Value.String = &s
+		}
+	}
+	return v
+}
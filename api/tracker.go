@@ -0,0 +1,416 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+//TrackerConfig configures an OrderBookTracker.
+type TrackerConfig struct {
+	//Account whose executions are applied to the book. Leave empty to only follow the tickertape.
+	Account string
+	//Resnapshot is the interval in which the book gets replaced by a fresh Orderbook() to correct drift. 0 disables it.
+	Resnapshot time.Duration
+	//MinResnapshot is the minimum time between two snapshots. The tracker resnapshots early (but not more often than this)
+	//when the depth reported by the tickertape doesn't match the local book.
+	MinResnapshot time.Duration
+}
+
+//DefaultTrackerConfig is a reasonable TrackerConfig without an account.
+var DefaultTrackerConfig = TrackerConfig{
+	Resnapshot:    5 * time.Second,
+	MinResnapshot: 500 * time.Millisecond,
+}
+
+//OrderBookTracker maintains a local copy of the orderbook of a stock.
+//It gets seeded from Orderbook(), kept current from the tickertape (and optionally the executions of an account)
+//and periodically replaced by a new snapshot. All methods are safe for concurrent use.
+type OrderBookTracker struct {
+	i      *Instance
+	venue  string
+	symbol string
+	c      TrackerConfig
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.RWMutex
+	bids     []MarketRequest //best (highest) price first
+	asks     []MarketRequest //best (lowest) price first
+	last     Quote
+	updated  time.Time
+	snapshot time.Time //when the last snapshot was applied
+	drift    bool
+	err      error
+}
+
+//TrackOrderBook starts tracking the orderbook of the current stock on the current venue.
+//It returns once the first snapshot arrived. Tracking stops when ctx is done or Stop() is called.
+func (i *Instance) TrackOrderBook(ctx context.Context, c TrackerConfig) (*OrderBookTracker, error) {
+	i.RLock()
+	venue, symbol := i.venue, i.symbol
+	i.RUnlock()
+
+	return i.trackOrderBook(ctx, venue, symbol, c)
+}
+
+func (i *Instance) trackOrderBook(ctx context.Context, venue, symbol string, c TrackerConfig) (*OrderBookTracker, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	t := &OrderBookTracker{i: i, venue: venue, symbol: symbol, c: c, cancel: cancel, done: make(chan struct{})}
+
+	quotes := i.quotes(ctx, venue, symbol, i.GetAccount())
+	if err := t.resnapshot(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	var executions *ExecutionStream
+	if c.Account != "" {
+		executions = i.executions(ctx, venue, symbol, c.Account)
+	}
+	go t.run(ctx, quotes, executions)
+	return t, nil
+}
+
+//Stop stops tracking. The tracker keeps answering queries with the last known state.
+func (t *OrderBookTracker) Stop() {
+	t.cancel()
+	<-t.done
+}
+
+//Err returns the last error that occurred while tracking.
+func (t *OrderBookTracker) Err() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.err
+}
+
+func (t *OrderBookTracker) setErr(err error) {
+	if err != nil {
+		t.mu.Lock()
+		t.err = err
+		t.mu.Unlock()
+	}
+}
+
+func (t *OrderBookTracker) run(ctx context.Context, quotes *QuoteStream, executions *ExecutionStream) {
+	defer close(t.done)
+
+	var (
+		tick  <-chan time.Time
+		execs <-chan Execution
+		evts  <-chan StreamEvent
+	)
+	if t.c.Resnapshot > 0 {
+		ticker := time.NewTicker(t.c.Resnapshot)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	if executions != nil {
+		execs = executions.Values
+		evts = executions.Events
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case q, ok := <-quotes.Values:
+			if !ok {
+				t.setErr(quotes.Err())
+				return
+			}
+			t.applyQuote(q)
+		case e, ok := <-execs:
+			if !ok {
+				t.setErr(executions.Err())
+				execs, evts = nil, nil
+				continue
+			}
+			t.applyExecution(e)
+		case e := <-quotes.Events:
+			if e.Type == Reconnected {
+				t.setErr(t.resnapshot(ctx))
+			}
+		case e := <-evts:
+			if e.Type == Reconnected {
+				t.setErr(t.resnapshot(ctx))
+			}
+		case <-tick:
+			t.setErr(t.resnapshot(ctx))
+		}
+
+		if t.needsResnapshot() {
+			t.setErr(t.resnapshot(ctx))
+		}
+	}
+}
+
+//needsResnapshot reports whether the book drifted and the last snapshot is old enough to take another one.
+func (t *OrderBookTracker) needsResnapshot() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.drift && time.Since(t.snapshot) >= t.c.MinResnapshot
+}
+
+//resnapshot replaces the local book with a fresh orderbook from the API.
+func (t *OrderBookTracker) resnapshot(ctx context.Context) error {
+	v, err := t.i.orderbook(ctx, t.venue, t.symbol)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bids = aggregate(v.Bids, true)
+	t.asks = aggregate(v.Asks, false)
+	t.updated = v.TS
+	t.snapshot = time.Now()
+	t.drift = false
+	return nil
+}
+
+//aggregate sums up the orders of one side of an orderbook by price, best price first.
+func aggregate(orders []MarketRequest, isBuy bool) []MarketRequest {
+	byPrice := map[int]int{}
+	for _, o := range orders {
+		byPrice[o.Price] += o.Quantity
+	}
+	side := make([]MarketRequest, 0, len(byPrice))
+	for price, qty := range byPrice {
+		side = append(side, MarketRequest{price, qty, isBuy})
+	}
+	sort.Slice(side, func(a, b int) bool { return better(side[a].Price, side[b].Price, isBuy) })
+	return side
+}
+
+//better reports whether price a is better than price b for the given side.
+func better(a, b int, isBuy bool) bool {
+	if isBuy {
+		return a > b
+	}
+	return a < b
+}
+
+func (t *OrderBookTracker) side(isBuy bool) *[]MarketRequest {
+	if isBuy {
+		return &t.bids
+	}
+	return &t.asks
+}
+
+//setLevel sets the quantity at a price, removing the level if qty <= 0. Must be called with t.mu held.
+func (t *OrderBookTracker) setLevel(isBuy bool, price, qty int) {
+	side := t.side(isBuy)
+	n := sort.Search(len(*side), func(k int) bool { return !better((*side)[k].Price, price, isBuy) })
+	exists := n < len(*side) && (*side)[n].Price == price
+	switch {
+	case exists && qty > 0:
+		(*side)[n].Quantity = qty
+	case exists:
+		*side = append((*side)[:n], (*side)[n+1:]...)
+	case qty > 0:
+		*side = append(*side, MarketRequest{})
+		copy((*side)[n+1:], (*side)[n:])
+		(*side)[n] = MarketRequest{price, qty, isBuy}
+	}
+}
+
+//applyTop updates one side of the book from the top of book of a quote. Must be called with t.mu held.
+func (t *OrderBookTracker) applyTop(isBuy bool, price, size, depth int) {
+	side := t.side(isBuy)
+	if price == 0 || depth == 0 {
+		*side = (*side)[:0]
+		t.drift = t.drift || depth > 0
+		return
+	}
+
+	//everything better than the quoted best price is gone.
+	n := 0
+	for n < len(*side) && better((*side)[n].Price, price, isBuy) {
+		n++
+	}
+	*side = (*side)[n:]
+	t.setLevel(isBuy, price, size)
+
+	known := 0
+	for _, l := range *side {
+		known += l.Quantity
+	}
+	if known != depth {
+		t.drift = true
+	}
+}
+
+func (t *OrderBookTracker) applyQuote(q Quote) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if q.QuoteTime.Before(t.updated) {
+		return
+	}
+	t.applyTop(true, q.Bid, q.BidSize, q.BidDepth)
+	t.applyTop(false, q.Ask, q.AskSize, q.AskDepth)
+	t.last = q
+	t.updated = q.QuoteTime
+}
+
+//applyExecution removes the filled quantity of one of our orders from the book, unless a later quote already covered it.
+func (t *OrderBookTracker) applyExecution(e Execution) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e.Order.Venue != t.venue || e.Order.Symbol != t.symbol || !e.FilledAt.After(t.updated) {
+		return
+	}
+
+	//the liquidity that got taken always belonged to the standing order.
+	isBuy := e.Order.Direction == Buy
+	if e.Order.ID != e.StandingID {
+		isBuy = !isBuy
+	}
+	t.setLevel(isBuy, e.Price, t.depthAt(isBuy, e.Price)-e.Filled)
+	t.updated = e.FilledAt
+}
+
+//Snapshot returns a copy of the tracked orderbook.
+func (t *OrderBookTracker) Snapshot() Orderbook {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return Orderbook{
+		ErrorResult: ErrorResult{Ok: true},
+		Venue:       t.venue,
+		Symbol:      t.symbol,
+		Bids:        append([]MarketRequest{}, t.bids...),
+		Asks:        append([]MarketRequest{}, t.asks...),
+		TS:          t.updated,
+	}
+}
+
+//LastQuote returns the last quote applied to the book.
+func (t *OrderBookTracker) LastQuote() Quote {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.last
+}
+
+//Updated returns the time of the last change of the book.
+func (t *OrderBookTracker) Updated() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.updated
+}
+
+//Levels returns up to n price levels of a side, best price first. n <= 0 returns all levels.
+func (t *OrderBookTracker) Levels(isBuy bool, n int) []MarketRequest {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	side := *t.side(isBuy)
+	if n > 0 && n < len(side) {
+		side = side[:n]
+	}
+	return append([]MarketRequest{}, side...)
+}
+
+//DepthAt returns the quantity resting at exactly price on a side.
+func (t *OrderBookTracker) DepthAt(isBuy bool, price int) int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.depthAt(isBuy, price)
+}
+
+func (t *OrderBookTracker) depthAt(isBuy bool, price int) int {
+	for _, l := range *t.side(isBuy) {
+		if l.Price == price {
+			return l.Quantity
+		}
+	}
+	return 0
+}
+
+//CumulativeDepth returns the quantity resting on a side at limit or better,
+//which is what an order crossing the book up to limit could fill.
+func (t *OrderBookTracker) CumulativeDepth(isBuy bool, limit int) (qty int) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, l := range *t.side(isBuy) {
+		if better(limit, l.Price, isBuy) {
+			break
+		}
+		qty += l.Quantity
+	}
+	return
+}
+
+//BestBid returns the best bid price and its quantity. ok is false if there are no bids.
+func (t *OrderBookTracker) BestBid() (price, qty int, ok bool) {
+	return t.best(true)
+}
+
+//BestAsk returns the best ask price and its quantity. ok is false if there are no asks.
+func (t *OrderBookTracker) BestAsk() (price, qty int, ok bool) {
+	return t.best(false)
+}
+
+func (t *OrderBookTracker) best(isBuy bool) (price, qty int, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	side := *t.side(isBuy)
+	if len(side) == 0 {
+		return 0, 0, false
+	}
+	return side[0].Price, side[0].Quantity, true
+}
+
+//top returns the best bid and ask, read under one lock so that they belong to the same state of the book.
+//ok is false if one side is empty.
+func (t *OrderBookTracker) top() (bid, ask MarketRequest, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(t.bids) == 0 || len(t.asks) == 0 {
+		return bid, ask, false
+	}
+	return t.bids[0], t.asks[0], true
+}
+
+//Spread returns the difference between best ask and best bid. ok is false if one side is empty.
+func (t *OrderBookTracker) Spread() (spread int, ok bool) {
+	bid, ask, ok := t.top()
+	return ask.Price - bid.Price, ok
+}
+
+//Mid returns the midpoint between best bid and best ask. ok is false if one side is empty.
+func (t *OrderBookTracker) Mid() (mid float64, ok bool) {
+	bid, ask, ok := t.top()
+	return float64(bid.Price+ask.Price) / 2, ok
+}
+
+//Microprice returns the size weighted midpoint of the top of book, which leans towards the side with less quantity
+//because that side is more likely to be taken out next. ok is false if one side is empty.
+func (t *OrderBookTracker) Microprice() (price float64, ok bool) {
+	bid, ask, ok := t.top()
+	if !ok {
+		return 0, false
+	}
+	return float64(bid.Price*ask.Quantity+ask.Price*bid.Quantity) / float64(bid.Quantity+ask.Quantity), true
+}
+
+//Imbalance returns (bidQty - askQty) / (bidQty + askQty) over the best n levels of each side (all levels for n <= 0).
+//The result lies between -1 (only asks) and 1 (only bids). ok is false if the book is empty.
+func (t *OrderBookTracker) Imbalance(n int) (imbalance float64, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	sum := func(side []MarketRequest) (qty int) {
+		for k, l := range side {
+			if n > 0 && k >= n {
+				break
+			}
+			qty += l.Quantity
+		}
+		return
+	}
+	bids, asks := sum(t.bids), sum(t.asks)
+	if bids+asks == 0 {
+		return 0, false
+	}
+	return float64(bids-asks) / float64(bids+asks), true
+}
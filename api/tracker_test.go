@@ -0,0 +1,46 @@
+package api
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestTrackerTopOfBookConsistent(t *testing.T) {
+	tr := &OrderBookTracker{}
+	//the writer moves the whole book, keeping a spread of 2 and equal sizes
+	set := func(p int) {
+		tr.mu.Lock()
+		tr.bids = []MarketRequest{{Price: p, Quantity: 5, IsBuy: true}}
+		tr.asks = []MarketRequest{{Price: p + 2, Quantity: 5}}
+		tr.mu.Unlock()
+	}
+	set(100)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for p := 100; ; p += 10 {
+			select {
+			case <-stop:
+				return
+			default:
+				set(p % 10000)
+			}
+		}
+	}()
+
+	for k := 0; k < 20000; k++ {
+		if spread, ok := tr.Spread(); !ok || spread != 2 {
+			t.Fatal("spread", spread, ok)
+		}
+		mid, ok := tr.Mid()
+		micro, _ := tr.Microprice()
+		if !ok || int(mid)%10 != 1 || micro != float64(int(micro)) || int(micro)%10 != 1 {
+			t.Fatal("mid", mid, "microprice", micro, ok)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
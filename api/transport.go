@@ -0,0 +1,113 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+//Option configures an instance at construction, see New.
+type Option func(*options)
+
+//options collects the options of New.
+type options struct {
+	transport         http.RoundTripper
+	timeout           time.Duration
+	maxIdleConns      int
+	idleConnTimeout   time.Duration
+	disableKeepAlives bool
+	middleware        []Middleware
+	header            http.Header
+	logger            *slog.Logger
+	levels            map[Subsystem]slog.Level
+	metrics           *Metrics
+	tracer            *Tracer
+}
+
+//Middleware wraps the transport of an instance. It sees every HTTP request of the API calls, including every retry
+//attempt, with a header of its own that it may modify. Websocket streams don't go through it.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+//RoundTripperFunc adapts a function to an http.RoundTripper, which is handy for middleware.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+//RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+//WithTransport replaces the transport of the instance, http.DefaultTransport by default.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = rt
+	}
+}
+
+//WithTimeout limits every HTTP request including reading the response to d. 0 means no limit, which is the default:
+//calls are bounded by their context.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+//WithKeepAlive tunes the connection reuse of the transport: at most maxIdle idle connections are kept per host, each
+//for at most idleTimeout. A negative maxIdle disables keep-alives. It only applies to an *http.Transport, which is
+//copied and not modified.
+func WithKeepAlive(maxIdle int, idleTimeout time.Duration) Option {
+	return func(o *options) {
+		o.maxIdleConns, o.idleConnTimeout = maxIdle, idleTimeout
+		o.disableKeepAlives = maxIdle < 0
+	}
+}
+
+//WithMiddleware adds middleware to the transport. The first middleware sees a request first, the transport last.
+//Can be given several times, later middleware is added inside the earlier one.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, mw...)
+	}
+}
+
+//WithHeader adds a header that is sent with every HTTP request.
+func WithHeader(key, value string) Option {
+	return func(o *options) {
+		o.header.Add(key, value)
+	}
+}
+
+//client builds the HTTP client of the options.
+func (o *options) client() *http.Client {
+	rt := o.transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	if t, ok := rt.(*http.Transport); ok && (o.maxIdleConns != 0 || o.idleConnTimeout != 0) {
+		t = t.Clone()
+		if o.disableKeepAlives {
+			t.DisableKeepAlives = true
+		} else {
+			if o.maxIdleConns > 0 {
+				t.MaxIdleConnsPerHost = o.maxIdleConns
+				if t.MaxIdleConns > 0 && t.MaxIdleConns < o.maxIdleConns {
+					t.MaxIdleConns = o.maxIdleConns
+				}
+			}
+			if o.idleConnTimeout > 0 {
+				t.IdleConnTimeout = o.idleConnTimeout
+			}
+		}
+		rt = t
+	}
+	for k := len(o.middleware) - 1; k >= 0; k-- {
+		rt = o.middleware[k](rt)
+	}
+	return &http.Client{Transport: rt, Timeout: o.timeout}
+}
+
+//header returns a copy of the headers of the instance for a single request.
+func (i *Instance) header() http.Header {
+	i.RLock()
+	defer i.RUnlock()
+	return i.h.Clone()
+}
@@ -1,6 +1,9 @@
 package api
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 //The Stock struct contains the name and the ticker symbol of a stock.
 type Stock struct {
@@ -11,22 +14,41 @@ type Stock struct {
 //AvailableStocks returns the available stock on a venue.
 //See https://starfighter.readme.io/docs/list-stocks-on-venue for further info about the actual API call.
 func (i *Instance) AvailableStocks() []Stock {
-	i.RLock()
-	url := fmt.Sprintf("%svenues/%s/stocks", baseURL, i.venue)
-	i.RUnlock()
+	v, err := i.AvailableStocksCtx(context.Background())
+	i.setErr(err)
+	return v
+}
+
+//AvailableStocksCtx works like AvailableStocks() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) AvailableStocksCtx(ctx context.Context) ([]Stock, error) {
+	return i.availableStocks(ctx, i.GetVenue())
+}
+
+func (i *Instance) availableStocks(ctx context.Context, venue string) ([]Stock, error) {
+	r := request{endpoint: "stocks", method: "GET", idempotent: true, url: fmt.Sprintf("%svenues/%s/stocks", baseURL, venue), venue: venue}
 
 	var v availableStocksResult
-	i.doHTTP("GET", url, nil, &v)
+	err := i.doHTTP(ctx, r, &v)
 
-	return v.Symbols
+	return v.Symbols, err
 }
 
 //VenueHeartbeat works like Heartbeat() but for the current venue.
 //See https://starfighter.readme.io/docs/venue-healthcheck for further info about the actual API call.
-func (i *Instance) VenueHeartbeat() ErrorResult {
-	i.RLock()
-	urlExtension := fmt.Sprintf("venues/%s/heartbeat", i.venue)
-	i.RUnlock()
+func (i *Instance) VenueHeartbeat() (v ErrorResult) {
+	v, err := i.VenueHeartbeatCtx(context.Background())
+	i.setErr(err)
+	return
+}
+
+//VenueHeartbeatCtx works like VenueHeartbeat() but honors the cancellation of ctx and returns the error of this call.
+func (i *Instance) VenueHeartbeatCtx(ctx context.Context) (v ErrorResult, err error) {
+	return i.venueHeartbeat(ctx, i.GetVenue())
+}
+
+func (i *Instance) venueHeartbeat(ctx context.Context, venue string) (v ErrorResult, err error) {
+	r := request{endpoint: "venue heartbeat", method: "GET", idempotent: true, url: fmt.Sprintf("%svenues/%s/heartbeat", baseURL, venue), venue: venue}
 
-	return i.heartbeat(urlExtension)
+	err = i.doHTTP(ctx, r, &v)
+	return
 }
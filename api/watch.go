@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//InstanceEventType tells what happened to a watched level instance.
+type InstanceEventType int
+
+//Instance event types.
+const (
+	FlashMessage  InstanceEventType = iota //a new flash message appeared
+	NewTradingDay                          //a trading day ended and the next one began
+	InstanceDone                           //the level is over; it is the last event before Events is closed
+)
+
+func (t InstanceEventType) String() string {
+	switch t {
+	case FlashMessage:
+		return "flash message"
+	case NewTradingDay:
+		return "new trading day"
+	case InstanceDone:
+		return "instance done"
+	}
+	return "unknown"
+}
+
+//Severities of flash messages.
+const (
+	FlashInfo    = "info"
+	FlashWarning = "warning"
+	FlashDanger  = "danger"
+)
+
+//InstanceEvent gets sent on InstanceWatcher.Events.
+type InstanceEvent struct {
+	Type     InstanceEventType
+	Time     time.Time
+	Status   InstanceStatus //status the event was derived from
+	Severity string         //FlashMessage: one of FlashInfo, FlashWarning or FlashDanger
+	Message  string         //FlashMessage: the text of the message
+	Day      int            //NewTradingDay: the day that just began
+}
+
+//InstanceWatcher polls the status of a level instance and reports changes on Events.
+type InstanceWatcher struct {
+	Events chan InstanceEvent
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	status InstanceStatus
+	err    error
+}
+
+//WatchInstance polls the status of the current level instance every interval until the level is done, ctx is done
+//or Stop() is called; Events is closed then. Failed polls are retried on the next tick, the error is available from Err().
+//Polling gives up if the GameMaster rejects the request, e.g. because the instance doesn't exist.
+//An interval <= 0 polls every second.
+func (i *Instance) WatchInstance(ctx context.Context, interval time.Duration) *InstanceWatcher {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	w := &InstanceWatcher{Events: make(chan InstanceEvent, 16), cancel: cancel, done: make(chan struct{})}
+	go w.run(ctx, i, i.GetInstanceID(), interval)
+	return w
+}
+
+//Stop stops watching and waits until Events is closed.
+func (w *InstanceWatcher) Stop() {
+	w.cancel()
+	<-w.done
+}
+
+//Err returns the error of the last failed poll.
+func (w *InstanceWatcher) Err() error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.err
+}
+
+//Status returns the last status received.
+func (w *InstanceWatcher) Status() InstanceStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.status
+}
+
+func (w *InstanceWatcher) run(ctx context.Context, i *Instance, instanceID int, interval time.Duration) {
+	defer close(w.done)
+	defer close(w.Events)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	first := true
+	for {
+		status, err := i.instanceStatus(ctx, instanceID)
+		if ctx.Err() != nil {
+			return
+		}
+		w.mu.Lock()
+		w.err = err
+		prev := w.status
+		if err == nil {
+			w.status = status
+		}
+		w.mu.Unlock()
+
+		if err != nil && terminal(err) {
+			return
+		}
+		if err == nil {
+			for _, e := range changes(prev, status, first) {
+				select {
+				case w.Events <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if status.Done {
+				return
+			}
+			first = false
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+//changes returns the events between two consecutive statuses. The trading day of the first status isn't reported as new.
+func changes(prev, cur InstanceStatus, first bool) (v []InstanceEvent) {
+	now := time.Now()
+	flashes := []struct {
+		severity  string
+		prev, cur string
+	}{
+		{FlashInfo, prev.Flash.Info, cur.Flash.Info},
+		{FlashWarning, prev.Flash.Warning, cur.Flash.Warning},
+		{FlashDanger, prev.Flash.Danger, cur.Flash.Danger},
+	}
+	for _, f := range flashes {
+		if f.cur != "" && f.cur != f.prev {
+			v = append(v, InstanceEvent{Type: FlashMessage, Time: now, Status: cur, Severity: f.severity, Message: f.cur})
+		}
+	}
+	if !first && cur.Details.TradingDay > prev.Details.TradingDay {
+		v = append(v, InstanceEvent{Type: NewTradingDay, Time: now, Status: cur, Day: cur.Details.TradingDay})
+	}
+	if cur.Done {
+		v = append(v, InstanceEvent{Type: InstanceDone, Time: now, Status: cur})
+	}
+	return
+}
@@ -0,0 +1,43 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/api/apitest"
+	"github.com/ianberinger/stockfighter/api/fakeexchange"
+)
+
+func TestWatchInstance(t *testing.T) {
+	ex := apitest.Start(t, fakeexchange.New())
+	ex.AddLevel(fakeexchange.Level{Name: "first_steps", Venue: "ABCEX", Stocks: []fakeexchange.Stock{{Name: "x", Symbol: "ABC"}}, TradingDays: 3})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	i := api.New("")
+	v, err := i.StartLevelCtx(ctx, "first_steps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//a zero interval polls at the default rate instead of panicking
+	w := i.WatchInstance(ctx, 0)
+	defer w.Stop()
+	for !w.Status().Ok {
+		if ctx.Err() != nil {
+			t.Fatal("no status", w.Err())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	ex.SetFlash(v.InstanceID, api.FlashWarning, "careful")
+	ex.EndInstance(v.InstanceID)
+
+	var got []api.InstanceEventType
+	for e := range w.Events {
+		got = append(got, e.Type)
+	}
+	if len(got) != 2 || got[0] != api.FlashMessage || got[1] != api.InstanceDone {
+		t.Fatal(got, w.Err())
+	}
+}
@@ -1,8 +1,13 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
 	// use gorilla/websocket instead of x/net/websocket: https://github.com/gorilla/websocket#gorilla-websocket-compared-with-other-packages
@@ -13,6 +18,102 @@ var (
 	baseWSURL string = "wss://api.stockfighter.io/ob/api/ws/"
 )
 
+func SetBaseWSURL(URL string) {
+	baseWSURL = URL
+}
+
+//StreamConfig controls how streams deal with dropped websocket connections.
+type StreamConfig struct {
+	//Reconnect enables reconnecting after the connection dropped. Streams without it close on the first error.
+	Reconnect bool
+	//MinBackoff and MaxBackoff bound the exponential backoff between reconnect attempts.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	//MaxAttempts is the number of consecutive failed reconnects after which the stream gives up. 0 means never give up.
+	//A connection that drops before delivering a value or staying up for 10s counts as failed.
+	MaxAttempts int
+	//Backfill fetches the state that may have been missed while disconnected once the stream is back:
+	//a Quote for every symbol of a QuoteStream (which also gets sent on Values) or the orders of an ExecutionStream.
+	Backfill bool
+
+	//Buffer is the capacity of the Values chan.
+	Buffer int
+	//Overflow decides what happens when Values is full because the consumer doesn't keep up.
+	Overflow OverflowPolicy
+}
+
+//OverflowPolicy decides what a stream does with a new value when its Values chan is full.
+type OverflowPolicy int
+
+//Overflow policies.
+const (
+	//Block waits until the consumer makes room (or the stream is stopped). Nothing gets lost, but the socket isn't read meanwhile.
+	Block OverflowPolicy = iota
+	//DropOldest discards the oldest buffered value to make room for the new one.
+	DropOldest
+	//Conflate discards all buffered values before sending a new one, so only the newest is left. This suits quotes where only the latest state matters.
+	Conflate
+)
+
+//DefaultStreamConfig is the stream config of new instances.
+var DefaultStreamConfig = StreamConfig{
+	Reconnect:  true,
+	MinBackoff: 100 * time.Millisecond,
+	MaxBackoff: 10 * time.Second,
+	Backfill:   true,
+	Buffer:     64,
+	Overflow:   Block,
+}
+
+//SetStreamConfig changes the config used by streams created afterwards.
+func (i *Instance) SetStreamConfig(c StreamConfig) {
+	i.Lock()
+	i.streamConfig = c
+	i.Unlock()
+}
+
+func (i *Instance) getStreamConfig() StreamConfig {
+	i.RLock()
+	defer i.RUnlock()
+	return i.streamConfig
+}
+
+//StreamEventType is the kind of a StreamEvent.
+type StreamEventType int
+
+//Types of stream events. The zero value is no event, e.g. what a receive from a closed Events chan yields.
+const (
+	Disconnected StreamEventType = iota + 1 //the connection dropped (or the first dial failed)
+	Reconnected                             //the connection is back
+	GaveUp                                  //the stream won't reconnect anymore and is about to close
+)
+
+func (t StreamEventType) String() string {
+	switch t {
+	case Disconnected:
+		return "disconnected"
+	case Reconnected:
+		return "reconnected"
+	case GaveUp:
+		return "gave up"
+	}
+	return "unknown"
+}
+
+//StreamEvent reports a change of the connection of a stream.
+type StreamEvent struct {
+	Type     StreamEventType
+	Time     time.Time
+	Err      error         //why the connection dropped (Disconnected, GaveUp)
+	Attempt  int           //number of reconnect attempts in the current outage
+	Downtime time.Duration //how long the stream was down (Reconnected)
+
+	//Backfilled state, only set on Reconnected with StreamConfig.Backfill.
+	Quotes      []Quote //fresh quotes for every symbol of a QuoteStream
+	Orders      []Order //current orders of an ExecutionStream, reconcile them to find missed fills
+	BackfillErr error   //why backfilling failed
+}
+
 type wsQuote struct {
 	ErrorResult
 	Quote Quote `json:"quote"`
@@ -21,60 +122,245 @@ type wsQuote struct {
 type streamer interface {
 	Stop()
 	Stopped() bool
-	add(interface{})
-	close()
+	context() context.Context
+	newValue() apiResponse
+	add(apiResponse)
+	event(StreamEvent)
+	backfill(i *Instance, r request, e *StreamEvent)
+	close(err error)
+	backlog() int
+}
+
+//stream contains what QuoteStream and ExecutionStream have in common.
+type stream struct {
+	//Events receives a StreamEvent whenever the connection drops or recovers.
+	//It is buffered and events get dropped when nobody reads them.
+	Events chan StreamEvent
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	overflow OverflowPolicy
+
+	mu      sync.Mutex
+	err     error
+	dropped int64
+	onDrop  func() //counts drops in the metrics of the instance
+}
+
+func newStream(ctx context.Context, c StreamConfig) stream {
+	ctx, cancel := context.WithCancel(ctx)
+	return stream{Events: make(chan StreamEvent, 16), ctx: ctx, cancel: cancel, overflow: c.Overflow}
+}
+
+//Stop stops the Stream. It closes the connection right away, so a pending read returns immediately.
+func (s *stream) Stop() {
+	s.cancel()
+}
+
+//Stopped returns true if the stream was stopped or its context is done.
+func (s *stream) Stopped() bool {
+	return s.ctx.Err() != nil
+}
+
+//Err returns why the stream ended: the context error if it was stopped, the last connection error if it gave up.
+//It returns nil while the stream is running.
+func (s *stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+//Dropped returns the number of values discarded by the overflow policy.
+func (s *stream) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+func (s *stream) drop() {
+	s.mu.Lock()
+	s.dropped++
+	s.mu.Unlock()
+	if s.onDrop != nil {
+		s.onDrop()
+	}
+}
+
+func (s *stream) context() context.Context {
+	return s.ctx
+}
+
+//finish records the terminal error and releases the context.
+func (s *stream) finish(err error) {
+	if ctxErr := s.ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+	s.cancel()
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+func (s *stream) event(e StreamEvent) {
+	select {
+	case s.Events <- e:
+	default:
+	}
+}
+
+//evict discards up to n buffered values using drain, which receives one value from Values without blocking.
+func (s *stream) evict(n int, drain func() bool) {
+	for ; n > 0 && drain(); n-- {
+		s.drop()
+	}
+}
+
+//full handles a full Values chan of capacity c for the non-blocking policies.
+//It returns false if the new value has to be dropped because an unbuffered chan has no room to make.
+func (s *stream) full(c int, drain func() bool) bool {
+	if c == 0 {
+		s.drop()
+		return false
+	}
+	s.evict(1, drain)
+	return true
 }
 
 //QuoteStream contains a Values chan which streams Quotes. Implements streamer interface.
 type QuoteStream struct {
 	Values chan Quote
-	stop   bool
+	stream
+	symbols map[string]bool //symbols seen so far, used for backfilling venue wide streams
 }
 
-func SetBaseWSURL(URL string) {
-	baseWSURL = URL
+func (s *QuoteStream) backlog() int {
+	return len(s.Values)
 }
 
-//Stop stops the Stream.
-func (s *QuoteStream) Stop() {
-	s.stop = true
+func (s *QuoteStream) newValue() apiResponse {
+	return &wsQuote{}
 }
 
-//Stopped returns true if the stream was stopped.
-func (s *QuoteStream) Stopped() bool {
-	return s.stop
+func (s *QuoteStream) add(v apiResponse) {
+	q := v.(*wsQuote).Quote
+	s.symbols[q.Symbol] = true
+	drain := func() bool {
+		select {
+		case <-s.Values:
+			return true
+		default:
+			return false
+		}
+	}
+	if s.overflow == Conflate {
+		s.evict(len(s.Values), drain)
+	}
+	for {
+		select {
+		case s.Values <- q:
+			return
+		case <-s.ctx.Done():
+			return
+		default:
+		}
+		if s.overflow == Block {
+			select {
+			case s.Values <- q:
+			case <-s.ctx.Done():
+			}
+			return
+		}
+		if !s.full(cap(s.Values), drain) {
+			return
+		}
+	}
 }
 
-func (s *QuoteStream) add(v interface{}) {
-	s.Values <- v.(*wsQuote).Quote
+func (s *QuoteStream) backfill(i *Instance, r request, e *StreamEvent) {
+	symbols := []string{r.symbol}
+	if r.symbol == "" {
+		symbols = symbols[:0]
+		for symbol := range s.symbols {
+			symbols = append(symbols, symbol)
+		}
+	}
+	for _, symbol := range symbols {
+		q, err := i.quote(s.ctx, r.venue, symbol)
+		if err != nil {
+			e.BackfillErr = err
+			continue
+		}
+		e.Quotes = append(e.Quotes, q)
+	}
 }
 
-func (s *QuoteStream) close() {
+func (s *QuoteStream) close(err error) {
+	s.finish(err)
 	close(s.Values)
+	close(s.Events)
 }
 
 //ExecutionStream contains a Values chan which streams Executions. Implements streamer interface.
 type ExecutionStream struct {
 	Values chan Execution
-	stop   bool
+	stream
+	account string
+}
+
+func (s *ExecutionStream) backlog() int {
+	return len(s.Values)
 }
 
-//Stop stops the Stream.
-func (s *ExecutionStream) Stop() {
-	s.stop = true
+func (s *ExecutionStream) newValue() apiResponse {
+	return &Execution{}
 }
 
-//Stopped returns true if the stream was stopped.
-func (s *ExecutionStream) Stopped() bool {
-	return s.stop
+func (s *ExecutionStream) add(v apiResponse) {
+	e := *v.(*Execution)
+	drain := func() bool {
+		select {
+		case <-s.Values:
+			return true
+		default:
+			return false
+		}
+	}
+	if s.overflow == Conflate {
+		s.evict(len(s.Values), drain)
+	}
+	for {
+		select {
+		case s.Values <- e:
+			return
+		case <-s.ctx.Done():
+			return
+		default:
+		}
+		if s.overflow == Block {
+			select {
+			case s.Values <- e:
+			case <-s.ctx.Done():
+			}
+			return
+		}
+		if !s.full(cap(s.Values), drain) {
+			return
+		}
+	}
 }
 
-func (s *ExecutionStream) add(v interface{}) {
-	s.Values <- *v.(*Execution)
+func (s *ExecutionStream) backfill(i *Instance, r request, e *StreamEvent) {
+	if r.symbol != "" {
+		e.Orders, e.BackfillErr = i.stockOrderStatus(s.ctx, r.venue, s.account, r.symbol)
+	} else {
+		e.Orders, e.BackfillErr = i.accountOrderStatus(s.ctx, r.venue, s.account)
+	}
 }
 
-func (s *ExecutionStream) close() {
+func (s *ExecutionStream) close(err error) {
+	s.finish(err)
 	close(s.Values)
+	close(s.Events)
 }
 
 //The Execution struct gets only returned by websocket based calls.
@@ -90,48 +376,197 @@ type Execution struct {
 	IncomingComplete bool      `json:"incomingComplete"`
 }
 
-func (i *Instance) wsURL(method string, stockOnly bool, account string) string {
+//wsRequest describes a websocket subscription. An empty symbol subscribes to the whole venue.
+//The ID correlates the log records of the stream across reconnects.
+func (i *Instance) wsRequest(method, account, venue, symbol string) request {
+	if symbol != "" {
+		return request{endpoint: method, url: fmt.Sprintf("%s%s/venues/%s/%s/stocks/%s", baseWSURL, account, venue, method, symbol), venue: venue, symbol: symbol, id: i.logs.nextID()}
+	}
+	return request{endpoint: method, url: fmt.Sprintf("%s%s/venues/%s/%s", baseWSURL, account, venue, method), venue: venue, id: i.logs.nextID()}
+}
+
+//streamTarget returns the venue and (if stockOnly) the symbol streams of the instance subscribe to.
+func (i *Instance) streamTarget(stockOnly bool) (venue, symbol string) {
+	i.RLock()
+	defer i.RUnlock()
 	if stockOnly {
-		return fmt.Sprintf("%s%s/venues/%s/%s/stocks/%s", baseWSURL, account, i.venue, method, i.symbol)
+		return i.venue, i.symbol
 	}
-	return fmt.Sprintf("%s%s/venues/%s/%s", baseWSURL, account, i.venue, method)
+	return i.venue, ""
 }
 
 //Quotes returns a stream which streams all quotes for the current venue or only the current stock.
+//Dropped connections are reestablished according to the stream config of the instance, see stream.Events.
 //A stream can be terminated with: stream.Stop()
 //See https://starfighter.readme.io/docs/quotes-ticker-tape-websocket for further info about API call.
 func (i *Instance) Quotes(stockOnly bool) *QuoteStream {
-	s := &QuoteStream{make(chan Quote), false}
-	go i.doWS(s, i.wsURL("tickertape", stockOnly, i.account), &wsQuote{})
+	return i.QuotesCtx(context.Background(), stockOnly)
+}
+
+//QuotesCtx works like Quotes() but the stream also stops when ctx is done.
+func (i *Instance) QuotesCtx(ctx context.Context, stockOnly bool) *QuoteStream {
+	venue, symbol := i.streamTarget(stockOnly)
+	return i.quotes(ctx, venue, symbol, i.GetAccount())
+}
+
+func (i *Instance) quotes(ctx context.Context, venue, symbol, account string) *QuoteStream {
+	c := i.getStreamConfig()
+	s := &QuoteStream{make(chan Quote, c.Buffer), newStream(ctx, c), map[string]bool{}}
+	s.onDrop = func() { i.metrics.dropped.Inc("tickertape") }
+	go i.doWS(s, c, i.wsRequest("tickertape", account, venue, symbol))
 	return s
 }
 
 //Executions returns a stream which streams all executions for the current venue or only the current stock.
 //Authentication is done with the account number
+//Dropped connections are reestablished according to the stream config of the instance, see stream.Events.
 //A stream can be terminated with: stream.Stop()
 //See https://starfighter.readme.io/docs/executions-fills-websocket for further info about API call.
 func (i *Instance) Executions(stockOnly bool, account string) *ExecutionStream {
-	s := &ExecutionStream{make(chan Execution), false}
-	go i.doWS(s, i.wsURL("executions", stockOnly, account), &Execution{})
+	return i.ExecutionsCtx(context.Background(), stockOnly, account)
+}
+
+//ExecutionsCtx works like Executions() but the stream also stops when ctx is done.
+func (i *Instance) ExecutionsCtx(ctx context.Context, stockOnly bool, account string) *ExecutionStream {
+	venue, symbol := i.streamTarget(stockOnly)
+	return i.executions(ctx, venue, symbol, account)
+}
+
+func (i *Instance) executions(ctx context.Context, venue, symbol, account string) *ExecutionStream {
+	c := i.getStreamConfig()
+	s := &ExecutionStream{make(chan Execution, c.Buffer), newStream(ctx, c), account}
+	s.onDrop = func() { i.metrics.dropped.Inc("executions") }
+	go i.doWS(s, c, i.wsRequest("executions", account, venue, symbol))
 	return s
 }
 
-func (i *Instance) doWS(s streamer, url string, v apiResponse) {
-	conn, _, connErr := websocket.DefaultDialer.Dial(url, http.Header{})
+//stableConnection is how long a connection has to stay up to count as working although it didn't deliver anything.
+const stableConnection = 10 * time.Second
+
+//terminal reports whether reconnecting can't fix err: the server rejected the subscription.
+func terminal(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode < 500
+}
+
+//doWS keeps a stream connected until it gets stopped or gives up.
+func (i *Instance) doWS(s streamer, c StreamConfig, r request) {
+	var err error
+	i.metrics.m.open(s, r.endpoint)
 	defer func() {
-		conn.Close()
-		s.close()
+		i.metrics.m.closed(s)
+		s.close(err)
 	}()
 
-	if !i.setErr(connErr) {
-		for !i.setErr(conn.ReadJSON(v)) {
-			if v.isOk() && !s.Stopped() {
-				s.add(v)
-			} else {
-				i.setErr(v.err("WS"))
-				s.Stop()
-				break
+	retry := RetryPolicy{MinBackoff: c.MinBackoff, MaxBackoff: c.MaxBackoff}
+	attempt := 0
+	var down, up time.Time
+
+	connected := func() {
+		i.log(s.context(), SubsystemWS, slog.LevelInfo, "ws connected", r.logAttrs(slog.Int("attempt", attempt))...)
+		if !down.IsZero() {
+			i.metrics.reconnects.Inc(r.endpoint)
+			now := time.Now()
+			e := StreamEvent{Type: Reconnected, Time: now, Attempt: attempt, Downtime: now.Sub(down)}
+			if c.Backfill {
+				s.backfill(i, r, &e)
+			}
+			s.event(e)
+			//backfilled quotes are current state, so they get delivered like any other quote.
+			for _, q := range e.Quotes {
+				s.add(&wsQuote{ErrorResult{Ok: true}, q})
 			}
 		}
+		down = time.Time{}
+		up = time.Now()
+	}
+	//a connection only ends the backoff once it proved to work, otherwise a server accepting and dropping every
+	//connection would be redialed at MinBackoff forever.
+	received := func() { attempt = 0 }
+
+	for {
+		up = time.Time{}
+		err = i.readWS(s, r, connected, received)
+		if s.Stopped() {
+			return
+		}
+		if !up.IsZero() && time.Since(up) >= stableConnection {
+			attempt = 0
+		}
+		i.setErr(err)
+		i.metrics.errors.Inc(r.endpoint, errorType(err))
+		if down.IsZero() {
+			down = time.Now()
+			i.log(s.context(), SubsystemWS, slog.LevelInfo, "ws disconnected", r.logAttrs(slog.Any("err", err))...)
+			s.event(StreamEvent{Type: Disconnected, Time: down, Err: err})
+		}
+
+		if !c.Reconnect || terminal(err) || (c.MaxAttempts > 0 && attempt >= c.MaxAttempts) {
+			i.log(s.context(), SubsystemWS, slog.LevelWarn, "ws gave up", r.logAttrs(slog.Int("attempt", attempt), slog.Any("err", err))...)
+			s.event(StreamEvent{Type: GaveUp, Time: time.Now(), Err: err, Attempt: attempt})
+			return
+		}
+		attempt++
+		if sleep(s.context(), retry.backoff(attempt)) != nil {
+			return
+		}
+	}
+}
+
+//readWS dials the websocket, calls connected once the connection is up and forwards values until an error occurs.
+//received is called with the first value.
+func (i *Instance) readWS(s streamer, r request, connected, received func()) error {
+	i.log(s.context(), SubsystemWS, slog.LevelDebug, "ws dial", r.logAttrs(slog.String("url", r.url))...)
+	conn, res, err := websocket.DefaultDialer.DialContext(s.context(), r.url, http.Header{})
+	if err != nil {
+		if res != nil && res.StatusCode != http.StatusSwitchingProtocols {
+			v := s.newValue()
+			json.NewDecoder(res.Body).Decode(v)
+			return r.apiError(res.StatusCode, res.Status, v)
+		}
+		return &TransportError{r.endpoint, r.url, err}
+	}
+	defer conn.Close()
+
+	//closing the connection is the only way to interrupt a blocked read.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.context().Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	connected()
+
+	for first := true; ; first = false {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			return &TransportError{r.endpoint, r.url, err}
+		}
+		i.metrics.messages.Inc(r.endpoint)
+		if i.logger(s.context(), SubsystemWS, LevelTrace) != nil {
+			i.log(s.context(), SubsystemWS, LevelTrace, "ws frame", r.logAttrs(slog.String("data", string(frame)))...)
+		}
+		v := s.newValue()
+		if err := json.Unmarshal(frame, v); err != nil {
+			return &TransportError{r.endpoint, r.url, err}
+		}
+		if !v.isOk() {
+			return r.apiError(0, "WS", v)
+		}
+		if first {
+			received()
+		}
+		if s.Stopped() {
+			return nil
+		}
+		i.risk.observe(v)
+		if e, ok := v.(*Execution); ok {
+			i.metrics.execution(*e)
+			i.tracer.execution(*e)
+		}
+		s.add(v)
 	}
 }
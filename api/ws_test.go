@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//flakyWS accepts every websocket connection, writes send to it and closes it.
+func flakyWS(t *testing.T, send string) (dials *int32) {
+	dials = new(int32)
+	var upgrader websocket.Upgrader
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(dials, 1)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		if send != "" {
+			conn.WriteMessage(websocket.TextMessage, []byte(send))
+		}
+		conn.Close()
+	}))
+	t.Cleanup(srv.Close)
+	api.SetBaseWSURL("ws" + strings.TrimPrefix(srv.URL, "http") + "/")
+	return
+}
+
+func flakyInstance() *api.Instance {
+	i := api.NewTestInstance()
+	c := api.DefaultStreamConfig
+	c.Reconnect = true
+	c.Backfill = false
+	c.MinBackoff, c.MaxBackoff = time.Millisecond, time.Millisecond
+	c.MaxAttempts = 3
+	i.SetStreamConfig(c)
+	return i
+}
+
+func TestStreamGivesUpOnDroppedConnections(t *testing.T) {
+	dials := flakyWS(t, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s := flakyInstance().QuotesCtx(ctx, true)
+
+	var last api.StreamEvent
+	for e := range s.Events {
+		last = e
+	}
+	if last.Type != api.GaveUp || last.Attempt != 3 {
+		t.Errorf("last event %v, attempt %d", last.Type, last.Attempt)
+	}
+	if n := atomic.LoadInt32(dials); n != 4 {
+		t.Error(n, "dials")
+	}
+	//a receive from the closed chan is no event
+	if e, ok := <-s.Events; ok || e.Type == api.Disconnected || e.Type.String() != "unknown" {
+		t.Error(e, ok)
+	}
+}
+
+func TestStreamKeepsReconnectingWhileReceiving(t *testing.T) {
+	dials := flakyWS(t, `{"ok":true,"quote":{"symbol":"FOOBAR","venue":"TESTEX","bid":100}}`)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s := flakyInstance().QuotesCtx(ctx, true)
+	defer s.Stop()
+
+	for n := 0; n < 10; n++ {
+		select {
+		case q := <-s.Values:
+			if q.Bid != 100 {
+				t.Fatal(q)
+			}
+		case <-ctx.Done():
+			t.Fatal("no quote after", n, "quotes and", atomic.LoadInt32(dials), "dials")
+		}
+	}
+}
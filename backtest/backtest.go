@@ -0,0 +1,327 @@
+// Package backtest replays recorded sessions against a strategy and simulates the fills of its orders.
+//
+// Run takes a Strategy written for backtests, RunStrategy takes a strategy.Strategy, so the code that trades live with
+// strategy.Run can be backtested unchanged.
+//
+// The replay is deterministic: the recording drives a simulated clock, the strategy is called on a single goroutine
+// and the same recording, strategy and Config always give the same Report. Our simulated orders don't move the
+// recorded market; they only consume the liquidity they take until the next recorded quote or orderbook arrives.
+package backtest
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/record"
+)
+
+//Strategy gets the recorded market data and the simulated fills of a replay.
+//It trades through t, which is bound to the stock of the quote or execution.
+type Strategy interface {
+	OnQuote(t api.Trader, q api.Quote)
+	OnExecution(t api.Trader, e api.Execution)
+}
+
+//Config configures a backtest.
+type Config struct {
+	//Account is the account of the simulated orders.
+	Account string
+	//Latency is the delay between placing or cancelling an order and the exchange acting on it.
+	Latency time.Duration
+	//QueueAhead is the share of the displayed quantity at the price of a new resting order that is assumed to be
+	//queued ahead of it: 1 puts the order at the back of the queue, 0 at the front. Trades at the price of the order
+	//work through the quantity ahead before they fill it.
+	QueueAhead float64
+	//Timer is the interval of the OnTimer calls of RunStrategy in simulated time, 0 disables them.
+	Timer time.Duration
+}
+
+//DefaultConfig is a conservative configuration: orders take 20ms to reach the exchange and queue behind everything displayed.
+var DefaultConfig = Config{Account: "BACKTEST", Latency: 20 * time.Millisecond, QueueAhead: 1}
+
+//Run replays every record of rd against s and reports how its orders did.
+//Recorded executions and order actions belong to the recorded session and are skipped.
+func Run(rd *record.Reader, s Strategy, c Config) (Report, error) {
+	b := newBacktest(s, c)
+	for {
+		v, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return b.report(), err
+		}
+		b.replay(v)
+	}
+	b.finish()
+	return b.report(), nil
+}
+
+//event is something the simulated exchange does at a given time: an order or a cancel arriving.
+type event struct {
+	at     time.Time
+	seq    uint64
+	order  *order
+	cancel bool
+}
+
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(a, b int) bool {
+	if !q[a].at.Equal(q[b].at) {
+		return q[a].at.Before(q[b].at)
+	}
+	return q[a].seq < q[b].seq
+}
+func (q eventQueue) Swap(a, b int)       { q[a], q[b] = q[b], q[a] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(*event)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	v := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return v
+}
+
+type stockKey struct {
+	venue  string
+	symbol string
+}
+
+type backtest struct {
+	s      Strategy
+	c      Config
+	now    time.Time
+	start  time.Time
+	seq    uint64
+	events eventQueue
+	stocks map[stockKey]*stock
+	list   []*stock //stocks in the order they appeared
+	orders []*order //all orders by ID
+	timer  func(now time.Time)
+	tick   time.Time //when timer is called next
+	p      *api.Portfolio
+	stats  stats
+}
+
+func newBacktest(s Strategy, c Config) *backtest {
+	return &backtest{s: s, c: c, stocks: map[stockKey]*stock{}, p: api.NewInstance("", c.Account, "", "").NewPortfolio()}
+}
+
+func (b *backtest) stock(venue, symbol string) *stock {
+	k := stockKey{venue, symbol}
+	st, ok := b.stocks[k]
+	if !ok {
+		st = &stock{b: b, venue: venue, symbol: symbol}
+		b.stocks[k] = st
+		b.list = append(b.list, st)
+	}
+	return st
+}
+
+//advance moves the clock to t, running all events and timer calls due until then. The clock never goes back.
+func (b *backtest) advance(t time.Time) {
+	for {
+		eventDue := len(b.events) > 0 && !b.events[0].at.After(t)
+		timerDue := b.timer != nil && !b.tick.IsZero() && !b.tick.After(t)
+		if !eventDue && !timerDue {
+			break
+		}
+		if timerDue && (!eventDue || b.tick.Before(b.events[0].at)) {
+			at := b.tick
+			if at.After(b.now) {
+				b.now = at
+			}
+			b.tick = at.Add(b.c.Timer)
+			b.timer(at)
+			continue
+		}
+
+		e := heap.Pop(&b.events).(*event)
+		if e.at.After(b.now) {
+			b.now = e.at
+		}
+		if e.cancel {
+			e.order.st.cancel(e.order)
+		} else {
+			e.order.st.arrive(e.order)
+		}
+	}
+	if t.After(b.now) {
+		b.now = t
+	}
+}
+
+func (b *backtest) schedule(o *order, cancel bool) {
+	b.seq++
+	heap.Push(&b.events, &event{at: b.now.Add(b.c.Latency), seq: b.seq, order: o, cancel: cancel})
+}
+
+func (b *backtest) replay(v record.Record) {
+	t := time.Unix(0, v.Session).Add(v.Mono)
+	if b.start.IsZero() {
+		b.start = t
+		if b.c.Timer > 0 {
+			b.tick = t.Add(b.c.Timer)
+		}
+	}
+	b.advance(t)
+
+	switch v.Kind {
+	case record.KindQuote:
+		b.stats.quotes++
+		st := b.stock(v.Quote.Venue, v.Quote.Symbol)
+		st.onQuote(*v.Quote)
+		b.p.Mark(*v.Quote)
+		b.s.OnQuote(st, *v.Quote)
+	case record.KindOrderbook:
+		b.stats.orderbooks++
+		b.stock(v.Orderbook.Venue, v.Orderbook.Symbol).onOrderbook(*v.Orderbook)
+	}
+	//orders the strategy placed without latency act on the market it just saw
+	b.advance(b.now)
+}
+
+//finish runs the events still pending at the end of the recording against the last known market.
+func (b *backtest) finish() {
+	for len(b.events) > 0 {
+		b.advance(b.events[0].at)
+	}
+}
+
+//fill books a fill of o and reports it to the strategy.
+func (b *backtest) fill(o *order, price, qty int) {
+	o.Fills = append(o.Fills, api.Fill{Price: price, Quantity: qty, TS: b.now})
+	o.TotalFilled += qty
+	o.Quantity -= qty
+	if o.Quantity == 0 {
+		o.Open = false
+	}
+	b.stats.fill(o, price, qty)
+
+	e := api.Execution{
+		ErrorResult:      api.ErrorResult{Ok: true},
+		Order:            o.snapshot(),
+		StandingID:       o.ID,
+		IncomingID:       o.ID,
+		Price:            price,
+		Filled:           qty,
+		FilledAt:         b.now,
+		StandingComplete: !o.Open,
+		IncomingComplete: !o.Open,
+	}
+	b.p.ApplyExecution(e)
+	b.s.OnExecution(o.st, e)
+}
+
+//order is a simulated order.
+type order struct {
+	api.Order
+	st    *stock
+	ahead int //quantity queued ahead at our price while resting
+	mid   int //midpoint when the order was placed, for slippage
+}
+
+func (o *order) snapshot() api.Order {
+	v := o.Order
+	v.Fills = append([]api.Fill(nil), o.Fills...)
+	return v
+}
+
+func rejected(endpoint string, st *stock, format string, a ...interface{}) error {
+	return &api.APIError{
+		StatusCode: http.StatusBadRequest,
+		Status:     "backtest",
+		Endpoint:   endpoint,
+		Venue:      st.venue,
+		Symbol:     st.symbol,
+		Message:    fmt.Sprintf(format, a...),
+	}
+}
+
+//Venue implements api.Trader.
+func (st *stock) Venue() string {
+	return st.venue
+}
+
+//Symbol implements api.Trader.
+func (st *stock) Symbol() string {
+	return st.symbol
+}
+
+//NewOrderCtx implements api.Trader. The order reaches the simulated exchange after Config.Latency, so the returned
+//order is open and unfilled; fills are reported to Strategy.OnExecution.
+func (st *stock) NewOrderCtx(ctx context.Context, price int, quantity int, direction api.OrderDirection, orderType api.OrderType) (api.Order, error) {
+	b := st.b
+	switch {
+	case quantity <= 0:
+		return api.Order{}, rejected("new order", st, "invalid quantity %d", quantity)
+	case price < 0 || price == 0 && orderType != api.Market:
+		return api.Order{}, rejected("new order", st, "invalid price %d", price)
+	case direction != api.Buy && direction != api.Sell:
+		return api.Order{}, rejected("new order", st, "invalid direction %q", direction)
+	}
+	switch orderType {
+	case api.Limit, api.Market, api.FillOrKill, api.ImmediateOrCancel:
+	default:
+		return api.Order{}, rejected("new order", st, "invalid order type %q", orderType)
+	}
+
+	o := &order{st: st, mid: st.mid()}
+	o.Order = api.Order{
+		ErrorResult:      api.ErrorResult{Ok: true},
+		Account:          b.c.Account,
+		Venue:            st.venue,
+		Symbol:           st.symbol,
+		Price:            price,
+		OriginalQuantity: quantity,
+		Quantity:         quantity,
+		Direction:        direction,
+		OrderType:        orderType,
+		ID:               len(b.orders),
+		TS:               b.now,
+		Fills:            []api.Fill{},
+		Open:             true,
+	}
+	b.orders = append(b.orders, o)
+	b.stats.orders++
+	b.stats.submitted += quantity
+	b.schedule(o, false)
+	return o.snapshot(), nil
+}
+
+//CancelOrderCtx implements api.Trader. The cancel reaches the simulated exchange after Config.Latency, so the
+//returned order is the state before; the order may still get filled until then.
+func (st *stock) CancelOrderCtx(ctx context.Context, ID int) (api.Order, error) {
+	o, err := st.order("cancel order", ID)
+	if err != nil {
+		return api.Order{}, err
+	}
+	if o.Open {
+		st.b.stats.cancels++
+		st.b.schedule(o, true)
+	}
+	return o.snapshot(), nil
+}
+
+//OrderStatusCtx implements api.Trader.
+func (st *stock) OrderStatusCtx(ctx context.Context, ID int) (api.Order, error) {
+	o, err := st.order("order status", ID)
+	if err != nil {
+		return api.Order{}, err
+	}
+	return o.snapshot(), nil
+}
+
+func (st *stock) order(endpoint string, ID int) (*order, error) {
+	if ID < 0 || ID >= len(st.b.orders) || st.b.orders[ID].st != st {
+		return nil, &api.APIError{StatusCode: http.StatusNotFound, Status: "backtest", Endpoint: endpoint, Venue: st.venue,
+			Symbol: st.symbol, Message: fmt.Sprintf("no order %d", ID)}
+	}
+	return st.b.orders[ID], nil
+}
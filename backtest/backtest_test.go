@@ -0,0 +1,125 @@
+package backtest_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/backtest"
+	"github.com/ianberinger/stockfighter/record"
+	"github.com/ianberinger/stockfighter/strategy"
+)
+
+//recording holds three quotes 100ms apart: a trade at 101 at 100ms and the ask dropping to 100 at 200ms.
+func recording() *record.Reader {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	base := time.Unix(1000, 0)
+	q := func(ms int, bid, bs, ask, as, last, ls int, lt time.Time) {
+		quote := api.Quote{Venue: "V", Symbol: "S", Bid: bid, BidSize: bs, Ask: ask, AskSize: as, LastPrice: last, LastSize: ls, LastTrade: lt}
+		enc.Encode(record.Record{Session: base.UnixNano(), Mono: time.Duration(ms) * time.Millisecond, Kind: record.KindQuote, Quote: &quote})
+	}
+	q(0, 100, 10, 105, 10, 102, 1, base)
+	q(100, 100, 7, 105, 10, 101, 4, base.Add(100*time.Millisecond))
+	q(200, 99, 7, 100, 10, 101, 4, base.Add(100*time.Millisecond))
+	zw.Close()
+	return record.NewReader(&buf)
+}
+
+type traderStrategy struct {
+	quotes int
+	execs  []api.Execution
+}
+
+func (s *traderStrategy) OnQuote(t api.Trader, q api.Quote) {
+	s.quotes++
+	if s.quotes == 1 {
+		t.NewOrderCtx(nil, 101, 5, api.Buy, api.Limit)
+	}
+}
+
+func (s *traderStrategy) OnExecution(t api.Trader, e api.Execution) {
+	s.execs = append(s.execs, e)
+}
+
+func TestRun(t *testing.T) {
+	s := &traderStrategy{}
+	r, err := backtest.Run(recording(), s, backtest.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//4 fill with the trade at 101, the last one when the ask crosses the resting order
+	if len(s.execs) != 2 || s.execs[0].Filled != 4 || s.execs[1].Filled != 1 || r.Filled != 5 || r.Cash != -505 {
+		t.Errorf("%+v %+v", r, s.execs)
+	}
+}
+
+type liveStrategy struct {
+	strategy.Base
+	calls   []string
+	stopAt  int
+	quotes  int
+	stopped bool
+}
+
+func (s *liveStrategy) OnStart(c *strategy.Context) error {
+	s.calls = append(s.calls, "start "+c.Symbol())
+	_, err := c.NewOrderCtx(c.Context(), 101, 5, api.Buy, api.Limit)
+	return err
+}
+
+func (s *liveStrategy) OnQuote(c *strategy.Context, q api.Quote) {
+	s.quotes++
+	if s.quotes == s.stopAt {
+		c.Stop(errors.New("enough"))
+	}
+}
+
+func (s *liveStrategy) OnExecution(c *strategy.Context, e api.Execution) {
+	s.calls = append(s.calls, "execution")
+	if c.Trader(e.Order.Symbol) == nil || c.Portfolio().Position("V", "S").Quantity != e.Order.TotalFilled {
+		s.calls = append(s.calls, "wrong context")
+	}
+}
+
+func (s *liveStrategy) OnTimer(c *strategy.Context, now time.Time) {
+	s.calls = append(s.calls, "timer")
+}
+
+func (s *liveStrategy) OnStop(c *strategy.Context) {
+	s.calls = append(s.calls, "stop")
+}
+
+func TestRunStrategy(t *testing.T) {
+	c := backtest.DefaultConfig
+	c.Timer = 50 * time.Millisecond
+	s := &liveStrategy{}
+	r, err := backtest.RunStrategy(recording(), s, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start S", "timer", "timer", "execution", "timer", "timer", "execution", "stop"}
+	if len(s.calls) != len(want) {
+		t.Fatal(s.calls)
+	}
+	for k := range want {
+		if s.calls[k] != want[k] {
+			t.Fatal(s.calls)
+		}
+	}
+	if r.Filled != 5 || r.Positions[0].Quantity != 5 {
+		t.Errorf("%+v", r)
+	}
+
+	//a strategy stopping itself ends the replay, its open order gets cancelled
+	s = &liveStrategy{stopAt: 1}
+	r, err = backtest.RunStrategy(recording(), s, c)
+	if err == nil || err.Error() != "enough" || r.Quotes != 1 || r.Cancels != 1 || r.Filled != 0 {
+		t.Errorf("%v %+v", err, r)
+	}
+}
@@ -0,0 +1,233 @@
+package backtest
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//stock is the simulated market of a single stock. It implements api.Trader.
+type stock struct {
+	b         *backtest
+	venue     string
+	symbol    string
+	bids      []api.MarketRequest //best price first
+	asks      []api.MarketRequest //best price first
+	quote     api.Quote
+	quoted    bool
+	lastTrade time.Time
+	resting   []*order //open orders that arrived, in arrival order
+}
+
+//mid returns the midpoint of the last quote, or the last trade price if a side is empty.
+func (st *stock) mid() int {
+	q := st.quote
+	if q.Bid > 0 && q.Ask > 0 {
+		return (q.Bid + q.Ask) / 2
+	}
+	return q.LastPrice
+}
+
+//onOrderbook replaces the book with a recorded snapshot.
+func (st *stock) onOrderbook(o api.Orderbook) {
+	st.bids = append([]api.MarketRequest(nil), o.Bids...)
+	st.asks = append([]api.MarketRequest(nil), o.Asks...)
+	st.cross()
+}
+
+//onQuote updates the top of the book from a quote and fills resting orders reached by a new recorded trade.
+//The last trade of the first quote happened before the recording started and is ignored.
+func (st *stock) onQuote(q api.Quote) {
+	st.quote = q
+	st.bids = top(st.bids, q.Bid, q.BidSize, true)
+	st.asks = top(st.asks, q.Ask, q.AskSize, false)
+	if q.LastTrade.After(st.lastTrade) {
+		if st.quoted && q.LastSize > 0 {
+			st.trade(q.LastPrice, q.LastSize)
+		}
+		st.lastTrade = q.LastTrade
+	}
+	st.quoted = true
+	st.cross()
+}
+
+//top makes price the best level of one side of a book with size shares. Levels better than price are gone.
+func top(levels []api.MarketRequest, price, size int, isBuy bool) []api.MarketRequest {
+	if price == 0 {
+		return nil
+	}
+	for len(levels) > 0 && better(levels[0].Price, price, isBuy) {
+		levels = levels[1:]
+	}
+	if len(levels) > 0 && levels[0].Price == price {
+		levels[0].Quantity = size
+		return levels
+	}
+	return append([]api.MarketRequest{{Price: price, Quantity: size, IsBuy: isBuy}}, levels...)
+}
+
+//better returns true if a is a better price than b for the buy or sell side.
+func better(a, b int, isBuy bool) bool {
+	if isBuy {
+		return a > b
+	}
+	return a < b
+}
+
+//reaches returns true if an order of o would trade at price.
+func reaches(o *order, price int) bool {
+	if o.OrderType == api.Market {
+		return true
+	}
+	if o.Direction == api.Buy {
+		return price <= o.Price
+	}
+	return price >= o.Price
+}
+
+//opposite returns the side of the book o trades against.
+func (st *stock) opposite(o *order) *[]api.MarketRequest {
+	if o.Direction == api.Buy {
+		return &st.asks
+	}
+	return &st.bids
+}
+
+//available returns the quantity o could take from the book right away.
+func (st *stock) available(o *order) (n int) {
+	for _, l := range *st.opposite(o) {
+		if !reaches(o, l.Price) {
+			break
+		}
+		n += l.Quantity
+	}
+	return
+}
+
+//take matches o against the book. Incoming orders trade at the prices of the book, resting ones at their own price.
+func (st *stock) take(o *order, resting bool) {
+	levels := st.opposite(o)
+	for len(*levels) > 0 && o.Open && reaches(o, (*levels)[0].Price) {
+		l := &(*levels)[0]
+		qty := l.Quantity
+		if o.Quantity < qty {
+			qty = o.Quantity
+		}
+		l.Quantity -= qty
+		price := l.Price
+		if l.Quantity == 0 {
+			*levels = (*levels)[1:]
+		}
+		if resting {
+			price = o.Price
+		}
+		if qty > 0 {
+			st.b.fill(o, price, qty)
+		}
+	}
+}
+
+//arrive handles an order reaching the exchange.
+func (st *stock) arrive(o *order) {
+	if !o.Open {
+		return
+	}
+	if o.OrderType == api.FillOrKill && st.available(o) < o.Quantity {
+		st.close(o)
+		return
+	}
+	st.take(o, false)
+	if !o.Open {
+		return
+	}
+	if o.OrderType != api.Limit {
+		st.close(o)
+		return
+	}
+
+	own := st.bids
+	if o.Direction == api.Sell {
+		own = st.asks
+	}
+	for _, l := range own {
+		if l.Price == o.Price {
+			o.ahead = int(st.b.c.QueueAhead * float64(l.Quantity))
+		}
+	}
+	st.resting = append(st.resting, o)
+}
+
+//cancel handles a cancel reaching the exchange.
+func (st *stock) cancel(o *order) {
+	if o.Open {
+		st.close(o)
+	}
+}
+
+func (st *stock) close(o *order) {
+	o.Open = false
+	o.Quantity = 0
+	for k, x := range st.resting {
+		if x == o {
+			st.resting = append(st.resting[:k], st.resting[k+1:]...)
+			break
+		}
+	}
+}
+
+//queue returns the resting orders of one side in price-time priority.
+func (st *stock) queue(direction api.OrderDirection) []*order {
+	var v []*order
+	for _, o := range st.resting {
+		if o.Direction == direction {
+			v = append(v, o)
+		}
+	}
+	sort.SliceStable(v, func(a, b int) bool { return better(v[a].Price, v[b].Price, direction == api.Buy) })
+	return v
+}
+
+//trade fills resting orders a recorded trade would have reached. Orders priced better than the trade would have
+//traded first; orders at the trade price first work off the quantity queued ahead of them.
+func (st *stock) trade(price, size int) {
+	for _, direction := range []api.OrderDirection{api.Buy, api.Sell} {
+		left := size
+		for _, o := range st.queue(direction) {
+			if left == 0 || !reaches(o, price) {
+				break
+			}
+			if o.Price == price {
+				used := o.ahead
+				if left < used {
+					used = left
+				}
+				o.ahead -= used
+				left -= used
+			}
+			qty := o.Quantity
+			if left < qty {
+				qty = left
+			}
+			if qty > 0 {
+				left -= qty
+				st.b.fill(o, o.Price, qty)
+				if !o.Open {
+					st.close(o)
+				}
+			}
+		}
+	}
+}
+
+//cross fills resting orders the recorded book moved through: the orders on the other side would have traded with ours.
+func (st *stock) cross() {
+	for _, direction := range []api.OrderDirection{api.Buy, api.Sell} {
+		for _, o := range st.queue(direction) {
+			st.take(o, true)
+			if !o.Open {
+				st.close(o)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package backtest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+type stats struct {
+	quotes     int
+	orderbooks int
+	orders     int
+	cancels    int
+	submitted  int
+	filled     int
+	slippage   float64 //cost against the midpoint at submission, summed over the filled shares that had one
+	slipShares int
+}
+
+func (s *stats) fill(o *order, price, qty int) {
+	s.filled += qty
+	if o.mid == 0 {
+		return
+	}
+	cost := price - o.mid
+	if o.Direction == api.Sell {
+		cost = -cost
+	}
+	s.slippage += float64(cost * qty)
+	s.slipShares += qty
+}
+
+//Report sums up a backtest. All amounts are in cents.
+type Report struct {
+	Start      time.Time //simulated time of the first record
+	End        time.Time //simulated time of the last event
+	Quotes     int       //quotes replayed
+	Orderbooks int       //orderbook snapshots replayed
+	Orders     int       //orders placed
+	Cancels    int       //cancels of open orders
+	Submitted  int       //shares ordered
+	Filled     int       //shares filled
+	FillRate   float64   //Filled / Submitted
+	//Slippage is the average price paid per filled share over the midpoint when the order was placed (received below
+	//it when selling). Negative values mean price improvement, e.g. from earning the spread.
+	Slippage   float64
+	Positions  []api.Position //positions in the stocks traded
+	Cash       int
+	NAV        float64 //cash plus the positions marked at the last quote
+	Realized   float64
+	Unrealized float64
+}
+
+//PnL returns the total P&L. A backtest starts out flat, so it equals NAV.
+func (r Report) PnL() float64 {
+	return r.NAV
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "replayed    %s, %d quotes, %d orderbooks\n", r.End.Sub(r.Start), r.Quotes, r.Orderbooks)
+	fmt.Fprintf(&b, "orders      %d placed, %d cancelled\n", r.Orders, r.Cancels)
+	fmt.Fprintf(&b, "fills       %d of %d shares (%.1f%%)\n", r.Filled, r.Submitted, 100*r.FillRate)
+	fmt.Fprintf(&b, "slippage    %.2f per share\n", r.Slippage)
+	for _, p := range r.Positions {
+		fmt.Fprintf(&b, "position    %s/%s %d @ %.2f, mark %d\n", p.Venue, p.Symbol, p.Quantity, p.AvgCost, p.Mark)
+	}
+	fmt.Fprintf(&b, "cash        %d\n", r.Cash)
+	fmt.Fprintf(&b, "P&L         %.2f (realized %.2f, unrealized %.2f)", r.PnL(), r.Realized, r.Unrealized)
+	return b.String()
+}
+
+func (b *backtest) report() Report {
+	s := b.stats
+	r := Report{
+		Start:      b.start,
+		End:        b.now,
+		Quotes:     s.quotes,
+		Orderbooks: s.orderbooks,
+		Orders:     s.orders,
+		Cancels:    s.cancels,
+		Submitted:  s.submitted,
+		Filled:     s.filled,
+		Cash:       b.p.Cash(),
+		NAV:        b.p.NAV(),
+	}
+	for _, p := range b.p.Positions() {
+		if p.Bought+p.Sold > 0 {
+			r.Positions = append(r.Positions, p)
+		}
+	}
+	if s.submitted > 0 {
+		r.FillRate = float64(s.filled) / float64(s.submitted)
+	}
+	if s.slipShares > 0 {
+		r.Slippage = s.slippage / float64(s.slipShares)
+	}
+	r.Realized, r.Unrealized = b.p.PnL()
+	return r
+}
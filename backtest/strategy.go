@@ -0,0 +1,104 @@
+package backtest
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/record"
+	"github.com/ianberinger/stockfighter/strategy"
+)
+
+//RunStrategy replays every record of rd against a strategy.Strategy like Run does. The strategy gets a Context made
+//by strategy.NewContext that trades the simulated stocks in the order they appear in the recording and books into the
+//portfolio of the backtest. OnStart is called before the first quote, OnTimer every Config.Timer of simulated time and
+//OnStop at the end of the recording; OnFlash is never called. Like strategy.Run, the open orders are cancelled after
+//OnStop. The replay ends early if the strategy calls Stop; RunStrategy returns the error of Stop or OnStart then.
+func RunStrategy(rd *record.Reader, s strategy.Strategy, c Config) (Report, error) {
+	a := &adapter{s: s}
+	b := newBacktest(a, c)
+	a.c = strategy.NewContext(context.Background(), b.p, b.traders)
+	b.timer = a.onTimer
+
+	var err error
+	for a.running() {
+		var v record.Record
+		if v, err = rd.Next(); err != nil {
+			break
+		}
+		b.replay(v)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+
+	if a.started {
+		s.OnStop(a.c)
+	}
+	a.done = true
+	b.timer = nil
+	for _, o := range b.orders {
+		if o.Open {
+			o.st.CancelOrderCtx(a.c.Context(), o.ID)
+		}
+	}
+	b.finish()
+	if _, stopErr := a.c.Stopped(); stopErr != nil && err == nil {
+		err = stopErr
+	}
+	return b.report(), err
+}
+
+//traders returns the simulated stocks as api.Traders.
+func (b *backtest) traders() []api.Trader {
+	traders := make([]api.Trader, len(b.list))
+	for k, st := range b.list {
+		traders[k] = st
+	}
+	return traders
+}
+
+//adapter calls a strategy.Strategy from the callbacks of a backtest.
+type adapter struct {
+	s       strategy.Strategy
+	c       *strategy.Context
+	started bool
+	done    bool //OnStop was called
+}
+
+//running reports whether the strategy should get more callbacks.
+func (a *adapter) running() bool {
+	stopped, _ := a.c.Stopped()
+	return !stopped && !a.done
+}
+
+func (a *adapter) start() bool {
+	if !a.started {
+		a.started = true
+		if err := a.s.OnStart(a.c); err != nil {
+			a.c.Stop(err)
+		}
+	}
+	return a.running()
+}
+
+//OnQuote implements Strategy.
+func (a *adapter) OnQuote(t api.Trader, q api.Quote) {
+	if a.start() {
+		a.s.OnQuote(a.c, q)
+	}
+}
+
+//OnExecution implements Strategy.
+func (a *adapter) OnExecution(t api.Trader, e api.Execution) {
+	if a.started && a.running() {
+		a.s.OnExecution(a.c, e)
+	}
+}
+
+func (a *adapter) onTimer(now time.Time) {
+	if a.started && a.running() {
+		a.s.OnTimer(a.c, now)
+	}
+}
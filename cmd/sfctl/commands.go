@@ -0,0 +1,656 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/dashboard"
+)
+
+const timeFormat = "15:04:05.000"
+
+func bookFlags(c *cli, fs *flag.FlagSet) {
+	fs.IntVar(&c.depth, "depth", 0, "number of price levels per side, 0 for all")
+}
+
+func orderFlags(c *cli, fs *flag.FlagSet) {
+	fs.StringVar(&c.orderType, "type", "limit", "order type: limit, market, fok (fill-or-kill) or ioc (immediate-or-cancel)")
+}
+
+func ordersFlags(c *cli, fs *flag.FlagSet) {
+	fs.BoolVar(&c.open, "open", false, "only list open orders")
+	fs.BoolVar(&c.allStocks, "all-stocks", false, "list orders in all stocks instead of only the current one")
+}
+
+func streamFlags(c *cli, fs *flag.FlagSet) {
+	fs.BoolVar(&c.follow, "follow", false, "keep streaming until interrupted")
+	fs.BoolVar(&c.allStocks, "all-stocks", false, "cover all stocks on the venue instead of only the current one")
+}
+
+func levelFlags(c *cli, fs *flag.FlagSet) {
+	fs.BoolVar(&c.follow, "follow", false, "status: keep printing flash messages and new trading days until the level is done")
+	fs.DurationVar(&c.interval, "interval", time.Second, "status: polling interval of --follow")
+}
+
+func dashboardFlags(c *cli, fs *flag.FlagSet) {
+	fs.StringVar(&c.addr, "addr", "localhost:8080", "address to serve the dashboard on")
+	fs.IntVar(&c.depth, "depth", dashboard.DefaultConfig.Depth, "number of price levels per side of the ladder")
+}
+
+//noArgs rejects positional arguments for commands that don't take any.
+func noArgs(args []string) error {
+	if len(args) > 0 {
+		return usagef("unexpected argument %q", args[0])
+	}
+	return nil
+}
+
+func cmdHeartbeat(c *cli, args []string) error {
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	type result struct {
+		API   bool   `json:"api"`
+		Venue string `json:"venue,omitempty"`
+		Up    bool   `json:"venueUp,omitempty"`
+	}
+	_, err := c.i.HeartbeatCtx(c.ctx)
+	if err != nil {
+		return err
+	}
+	r := result{API: true, Venue: c.cfg.Venue}
+	if r.Venue != "" {
+		if _, err := c.i.VenueHeartbeatCtx(c.ctx); err != nil {
+			return err
+		}
+		r.Up = true
+	}
+	return c.print(r, func(w io.Writer) {
+		fmt.Fprintf(w, "api\tup\n")
+		if r.Venue != "" {
+			fmt.Fprintf(w, "%s\tup\n", r.Venue)
+		}
+	})
+}
+
+func cmdStocks(c *cli, args []string) error {
+	if err := c.need("venue"); err != nil {
+		return err
+	}
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	stocks, err := c.i.AvailableStocksCtx(c.ctx)
+	if err != nil {
+		return err
+	}
+	return c.print(stocks, func(w io.Writer) {
+		fmt.Fprintln(w, "SYMBOL\tNAME")
+		for _, s := range stocks {
+			fmt.Fprintf(w, "%s\t%s\n", s.Symbol, s.Name)
+		}
+	})
+}
+
+func cmdQuote(c *cli, args []string) error {
+	if err := c.need("venue", "symbol"); err != nil {
+		return err
+	}
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	q, err := c.i.QuoteCtx(c.ctx)
+	if err != nil {
+		return err
+	}
+	return c.print(q, func(w io.Writer) {
+		fmt.Fprintf(w, "stock\t%s/%s\n", q.Venue, q.Symbol)
+		fmt.Fprintf(w, "bid\t%d x %d\t(depth %d)\n", q.Bid, q.BidSize, q.BidDepth)
+		fmt.Fprintf(w, "ask\t%d x %d\t(depth %d)\n", q.Ask, q.AskSize, q.AskDepth)
+		fmt.Fprintf(w, "last\t%d x %d\t%s\n", q.LastPrice, q.LastSize, formatTime(q.LastTrade))
+		fmt.Fprintf(w, "quote time\t%s\n", formatTime(q.QuoteTime))
+	})
+}
+
+//levels aggregates the orders of one side of the book by price and keeps the best depth levels (all if depth is 0).
+func levels(orders []api.MarketRequest, depth int) []api.MarketRequest {
+	var v []api.MarketRequest
+	for _, o := range orders {
+		if n := len(v); n > 0 && v[n-1].Price == o.Price {
+			v[n-1].Quantity += o.Quantity
+			continue
+		}
+		if depth > 0 && len(v) == depth {
+			break
+		}
+		v = append(v, o)
+	}
+	return v
+}
+
+func cmdBook(c *cli, args []string) error {
+	if err := c.need("venue", "symbol"); err != nil {
+		return err
+	}
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	b, err := c.i.OrderbookCtx(c.ctx)
+	if err != nil {
+		return err
+	}
+	b.Bids, b.Asks = levels(b.Bids, c.depth), levels(b.Asks, c.depth)
+	return c.print(b, func(w io.Writer) {
+		fmt.Fprintln(w, "BID QTY\tBID\tASK\tASK QTY")
+		for k := 0; k < len(b.Bids) || k < len(b.Asks); k++ {
+			var bid, ask [2]string
+			if k < len(b.Bids) {
+				bid = [2]string{strconv.Itoa(b.Bids[k].Quantity), strconv.Itoa(b.Bids[k].Price)}
+			}
+			if k < len(b.Asks) {
+				ask = [2]string{strconv.Itoa(b.Asks[k].Price), strconv.Itoa(b.Asks[k].Quantity)}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", bid[0], bid[1], ask[0], ask[1])
+		}
+	})
+}
+
+//parseOrderType returns an order of the type named by --type.
+func parseOrderType(s string) (api.Order, error) {
+	var o api.Order
+	switch strings.ToLower(s) {
+	case "limit":
+		o.OrderType = api.Limit
+	case "market":
+		o.OrderType = api.Market
+	case "fok", "fill-or-kill":
+		o.OrderType = api.FillOrKill
+	case "ioc", "immediate-or-cancel":
+		o.OrderType = api.ImmediateOrCancel
+	default:
+		return o, usagef("unknown order type %q", s)
+	}
+	return o, nil
+}
+
+func cmdOrder(c *cli, args []string) error {
+	if err := c.need("key", "account", "venue", "symbol"); err != nil {
+		return err
+	}
+	o, err := parseOrderType(c.orderType)
+	if err != nil {
+		return err
+	}
+	if len(args) > 2 && args[2] == "@" {
+		args = append(args[:2], args[3:]...)
+	}
+	if len(args) < 2 || len(args) > 3 {
+		return usagef("expected direction, quantity and price")
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "buy":
+		o.Direction = api.Buy
+	case "sell":
+		o.Direction = api.Sell
+	default:
+		return usagef("direction must be buy or sell, not %q", args[0])
+	}
+	if o.Quantity, err = strconv.Atoi(args[1]); err != nil || o.Quantity <= 0 {
+		return usagef("invalid quantity %q", args[1])
+	}
+	if len(args) == 3 {
+		if o.Price, err = strconv.Atoi(args[2]); err != nil || o.Price < 0 {
+			return usagef("invalid price %q, prices are in cents", args[2])
+		}
+	} else if o.OrderType != api.Market {
+		return usagef("a price is required for %s orders", o.OrderType)
+	}
+
+	v, err := c.i.NewOrderCtx(c.ctx, o.Price, o.Quantity, o.Direction, o.OrderType)
+	if err != nil {
+		return err
+	}
+	return c.printOrders([]api.Order{v}, true)
+}
+
+//printOrders prints orders, either as a list or as a single order with its fills.
+func (c *cli) printOrders(orders []api.Order, single bool) error {
+	if single && c.json {
+		return c.print(orders[0], nil)
+	}
+	return c.print(orders, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tSYMBOL\tSIDE\tTYPE\tPRICE\tQTY\tFILLED\tLEFT\tOPEN\tTIME")
+		for _, o := range orders {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%t\t%s\n",
+				o.ID, o.Symbol, o.Direction, o.OrderType, o.Price, o.OriginalQuantity, o.TotalFilled, o.Quantity, o.Open, formatTime(o.TS))
+		}
+		if single && len(orders[0].Fills) > 0 {
+			fmt.Fprintln(w, "\nFILL\tPRICE\tQTY\tTIME")
+			for k, f := range orders[0].Fills {
+				fmt.Fprintf(w, "%d\t%d\t%d\t%s\n", k+1, f.Price, f.Quantity, formatTime(f.TS))
+			}
+		}
+	})
+}
+
+//orderIDs parses the order IDs given as arguments.
+func orderIDs(args []string) ([]int, error) {
+	if len(args) == 0 {
+		return nil, usagef("no order ID given")
+	}
+	ids := make([]int, len(args))
+	for k, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, usagef("invalid order ID %q", arg)
+		}
+		ids[k] = id
+	}
+	return ids, nil
+}
+
+func cmdStatus(c *cli, args []string) error {
+	if err := c.need("key", "venue", "symbol"); err != nil {
+		return err
+	}
+	ids, err := orderIDs(args)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return usagef("expected a single order ID")
+	}
+	v, err := c.i.OrderStatusCtx(c.ctx, ids[0])
+	if err != nil {
+		return err
+	}
+	return c.printOrders([]api.Order{v}, true)
+}
+
+func cmdCancel(c *cli, args []string) error {
+	if err := c.need("key", "venue", "symbol"); err != nil {
+		return err
+	}
+	ids, err := orderIDs(args)
+	if err != nil {
+		return err
+	}
+	var orders []api.Order
+	var firstErr error
+	for _, id := range ids {
+		v, err := c.i.CancelOrderCtx(c.ctx, id)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "sfctl cancel: %d: %v\n", id, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		orders = append(orders, v)
+	}
+	if len(orders) > 0 {
+		if err := c.printOrders(orders, false); err != nil {
+			return err
+		}
+	}
+	return firstErr
+}
+
+func cmdCancelAll(c *cli, args []string) error {
+	if err := c.need("key", "account", "venue"); err != nil {
+		return err
+	}
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	before, err := c.i.AccountOrderStatusCtx(c.ctx)
+	if err != nil {
+		return err
+	}
+	open := map[int]bool{}
+	for _, o := range before {
+		if o.Open {
+			open[o.ID] = true
+		}
+	}
+
+	//the kill switch of this short-lived instance cancels every open order, whatever stock it is in.
+	killErr := c.i.KillSwitch(c.ctx)
+	after, err := c.i.AccountOrderStatusCtx(c.ctx)
+	if err != nil {
+		return err
+	}
+	var cancelled []api.Order
+	for _, o := range after {
+		if open[o.ID] {
+			cancelled = append(cancelled, o)
+		}
+	}
+	if err := c.printOrders(cancelled, false); err != nil {
+		return err
+	}
+	return killErr
+}
+
+func cmdOrders(c *cli, args []string) error {
+	need := []string{"key", "account", "venue"}
+	if !c.allStocks {
+		need = append(need, "symbol")
+	}
+	if err := c.need(need...); err != nil {
+		return err
+	}
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	orders, err := c.orders()
+	if err != nil {
+		return err
+	}
+	if c.open {
+		var open []api.Order
+		for _, o := range orders {
+			if o.Open {
+				open = append(open, o)
+			}
+		}
+		orders = open
+	}
+	return c.printOrders(orders, false)
+}
+
+//orders returns the orders of the account in the current stock or, with --all-stocks, on the whole venue.
+func (c *cli) orders() ([]api.Order, error) {
+	var (
+		orders []api.Order
+		err    error
+	)
+	if c.allStocks {
+		orders, err = c.i.AccountOrderStatusCtx(c.ctx)
+	} else {
+		orders, err = c.i.StockOrderStatusCtx(c.ctx)
+	}
+	sort.Slice(orders, func(a, b int) bool { return orders[a].ID < orders[b].ID })
+	return orders, err
+}
+
+//fill is a single fill of one of our orders, as printed by the fills command.
+type fill struct {
+	OrderID   int       `json:"orderId"`
+	Symbol    string    `json:"symbol"`
+	Direction string    `json:"direction"`
+	Price     int       `json:"price"`
+	Quantity  int       `json:"qty"`
+	TS        time.Time `json:"ts"`
+}
+
+//fillID identifies a fill by its order and the shares of the order filled before it. Fills of a sweep can share
+//price, quantity and time.
+type fillID struct {
+	order  int
+	offset int
+}
+
+//executionFillID returns the fillID of the fill reported by e.
+func executionFillID(e api.Execution) fillID {
+	return fillID{e.Order.ID, e.Order.TotalFilled - e.Filled}
+}
+
+func (c *cli) printFill(f fill) error {
+	return c.printLine(f, "%s  %-8s %-4s %8d @ %-8d order %d\n", formatTime(f.TS), f.Symbol, f.Direction, f.Quantity, f.Price, f.OrderID)
+}
+
+func cmdFills(c *cli, args []string) error {
+	need := []string{"key", "account", "venue"}
+	if !c.allStocks {
+		need = append(need, "symbol")
+	}
+	if err := c.need(need...); err != nil {
+		return err
+	}
+	if err := noArgs(args); err != nil {
+		return err
+	}
+
+	//subscribe first, so no fill gets lost between listing the old ones and streaming.
+	var executions *api.ExecutionStream
+	if c.follow {
+		executions = c.i.ExecutionsCtx(c.ctx, !c.allStocks, c.cfg.Account)
+		defer executions.Stop()
+	}
+
+	orders, err := c.orders()
+	if err != nil {
+		return err
+	}
+	var fills []fill
+	seen := map[fillID]bool{}
+	for _, o := range orders {
+		offset := 0
+		for _, f := range o.Fills {
+			fills = append(fills, fill{o.ID, o.Symbol, string(o.Direction), f.Price, f.Quantity, f.TS})
+			seen[fillID{o.ID, offset}] = true
+			offset += f.Quantity
+		}
+	}
+	sort.SliceStable(fills, func(a, b int) bool { return fills[a].TS.Before(fills[b].TS) })
+
+	for _, f := range fills {
+		if err := c.printFill(f); err != nil {
+			return err
+		}
+	}
+	if !c.follow {
+		return nil
+	}
+
+	for e := range executions.Values {
+		id := executionFillID(e)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		f := fill{e.Order.ID, e.Order.Symbol, string(e.Order.Direction), e.Price, e.Filled, e.FilledAt}
+		if err := c.printFill(f); err != nil {
+			return err
+		}
+	}
+	if c.ctx.Err() != nil {
+		return nil
+	}
+	return executions.Err()
+}
+
+func cmdTape(c *cli, args []string) error {
+	need := []string{"venue"}
+	if !c.allStocks {
+		need = append(need, "symbol")
+	}
+	if err := c.need(need...); err != nil {
+		return err
+	}
+	if err := noArgs(args); err != nil {
+		return err
+	}
+
+	quotes := c.i.QuotesCtx(c.ctx, !c.allStocks)
+	defer quotes.Stop()
+	if !c.json {
+		fmt.Fprintf(c.stdout, "%-12s  %-8s %-17s %-17s %-17s\n", "TIME", "SYMBOL", "BID", "ASK", "LAST")
+	}
+	for q := range quotes.Values {
+		err := c.printLine(q, "%-12s  %-8s %8d x %-6d %8d x %-6d %8d x %-6d\n",
+			formatTime(q.QuoteTime), q.Symbol, q.Bid, q.BidSize, q.Ask, q.AskSize, q.LastPrice, q.LastSize)
+		if err != nil || !c.follow {
+			return err
+		}
+	}
+	if c.ctx.Err() != nil {
+		return nil
+	}
+	return quotes.Err()
+}
+
+func cmdDashboard(c *cli, args []string) error {
+	if err := c.need("key", "account", "venue", "symbol"); err != nil {
+		return err
+	}
+	if err := noArgs(args); err != nil {
+		return err
+	}
+
+	cfg := dashboard.DefaultConfig
+	cfg.Depth = c.depth
+	d := dashboard.New(c.i, cfg)
+	l, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: d}
+	go srv.Serve(l)
+	defer srv.Shutdown(context.Background())
+	fmt.Fprintf(c.stderr, "serving the dashboard on http://%s/\n", l.Addr())
+
+	if err := d.Run(c.ctx); c.ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func cmdLevel(c *cli, args []string) error {
+	if err := c.need("key"); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usagef("no action given")
+	}
+	action, args := args[0], args[1:]
+	if action == "list" {
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		levels, err := c.i.LevelsCtx(c.ctx)
+		if err != nil {
+			return err
+		}
+		return c.print(levels, func(w io.Writer) {
+			for _, l := range levels {
+				fmt.Fprintln(w, l.Name)
+			}
+		})
+	}
+	if action == "start" {
+		if len(args) != 1 {
+			return usagef("expected the name of the level")
+		}
+		v, err := c.i.StartLevelCtx(c.ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return c.printLevel(v)
+	}
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	if c.cfg.Instance == 0 {
+		return usagef("no instance given, use -instance, the environment or the config file")
+	}
+
+	var (
+		v   api.LevelState
+		err error
+	)
+	switch action {
+	case "status":
+		if c.follow {
+			return c.watchLevel()
+		}
+		s, err := c.i.InstanceStatusCtx(c.ctx)
+		if err != nil {
+			return err
+		}
+		return c.printStatus(s)
+	case "restart":
+		v, err = c.i.RestartLevelCtx(c.ctx)
+	case "resume":
+		v, err = c.i.ResumeLevelCtx(c.ctx)
+	case "stop":
+		_, err = c.i.StopLevelCtx(c.ctx)
+		v.InstanceID = c.cfg.Instance
+	case "judge":
+		_, err = c.i.JudgeLevelCtx(c.ctx)
+		v.InstanceID = c.cfg.Instance
+	default:
+		return usagef("unknown action %q", action)
+	}
+	if err != nil {
+		return err
+	}
+	return c.printLevel(v)
+}
+
+func (c *cli) printLevel(v api.LevelState) error {
+	return c.print(v, func(w io.Writer) {
+		fmt.Fprintf(w, "instance\t%d\n", v.InstanceID)
+		if v.Account != "" {
+			fmt.Fprintf(w, "account\t%s\n", v.Account)
+			fmt.Fprintf(w, "venues\t%s\n", strings.Join(v.Venues, ", "))
+			fmt.Fprintf(w, "symbols\t%s\n", strings.Join(v.Symbols, ", "))
+			fmt.Fprintf(w, "seconds per trading day\t%d\n", v.SecondsPerTradingDay)
+		}
+	})
+}
+
+func (c *cli) printStatus(s api.InstanceStatus) error {
+	return c.print(s, func(w io.Writer) {
+		fmt.Fprintf(w, "instance\t%d\n", s.ID)
+		fmt.Fprintf(w, "state\t%s\n", s.State)
+		fmt.Fprintf(w, "done\t%t\n", s.Done)
+		fmt.Fprintf(w, "trading day\t%d of %d\n", s.Details.TradingDay, s.Details.EndOfTheWorldDay)
+		for _, f := range [][2]string{{api.FlashInfo, s.Flash.Info}, {api.FlashWarning, s.Flash.Warning}, {api.FlashDanger, s.Flash.Danger}} {
+			if f[1] != "" {
+				fmt.Fprintf(w, "%s\t%s\n", f[0], f[1])
+			}
+		}
+	})
+}
+
+func (c *cli) watchLevel() error {
+	w := c.i.WatchInstance(c.ctx, c.interval)
+	defer w.Stop()
+	for e := range w.Events {
+		var err error
+		switch e.Type {
+		case api.FlashMessage:
+			err = c.printLine(e, "%s  %-7s  %s\n", formatTime(e.Time), e.Severity, e.Message)
+		case api.NewTradingDay:
+			err = c.printLine(e, "%s  day %d of %d\n", formatTime(e.Time), e.Day, e.Status.Details.EndOfTheWorldDay)
+		case api.InstanceDone:
+			err = c.printLine(e, "%s  done (%s)\n", formatTime(e.Time), e.Status.State)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if c.ctx.Err() != nil {
+		return nil
+	}
+	return w.Err()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(timeFormat)
+}
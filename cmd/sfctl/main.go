@@ -0,0 +1,379 @@
+//Command sfctl is a command-line client for the stockfighter.io API.
+//
+//Usage:
+//
+//	sfctl <command> [arguments] [flags]
+//
+//The API key, account, venue, symbol and level instance are taken from flags, then from the
+//environment (SF_API_KEY, SF_ACCOUNT, SF_VENUE, SF_SYMBOL, SF_INSTANCE, SF_BASE_URL, SF_WS_URL, SF_GM_URL) and
+//finally from a JSON config file (-config, $SFCTL_CONFIG or sfctl/config.json in the user config dir)
+//with the keys apiKey, account, venue, symbol, instance, baseURL, wsURL and gmURL.
+//Run sfctl help for the list of commands.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//config holds the settings shared by all commands.
+type config struct {
+	APIKey   string `json:"apiKey"`
+	Account  string `json:"account"`
+	Venue    string `json:"venue"`
+	Symbol   string `json:"symbol"`
+	Instance int    `json:"instance"`
+	BaseURL  string `json:"baseURL"`
+	WSURL    string `json:"wsURL"`
+	GMURL    string `json:"gmURL"`
+}
+
+//command is a subcommand of sfctl.
+type command struct {
+	name  string
+	args  string
+	help  string
+	run   func(c *cli, args []string) error //gets the positional arguments
+	flags func(c *cli, fs *flag.FlagSet)    //registers the flags of the command, may be nil
+}
+
+func (cmd command) usage() string {
+	if cmd.args == "" {
+		return fmt.Sprintf("sfctl %s [flags]", cmd.name)
+	}
+	return fmt.Sprintf("sfctl %s %s [flags]", cmd.name, cmd.args)
+}
+
+var commands []command
+
+func init() {
+	//assigned in init because the help command refers to the list itself.
+	commands = []command{
+		{"heartbeat", "", "check that the API and the venue are up", cmdHeartbeat, nil},
+		{"stocks", "", "list the stocks traded on the venue", cmdStocks, nil},
+		{"quote", "", "show the quote of the stock", cmdQuote, nil},
+		{"book", "", "show the orderbook of the stock", cmdBook, bookFlags},
+		{"order", "buy|sell QTY [@ PRICE]", "place an order, e.g. order buy 100 @ 5025 --type ioc", cmdOrder, orderFlags},
+		{"status", "ID", "show the status of an order", cmdStatus, nil},
+		{"cancel", "ID...", "cancel orders", cmdCancel, nil},
+		{"cancel-all", "", "cancel all open orders of the account on the venue", cmdCancelAll, nil},
+		{"orders", "", "list the orders of the account on the venue", cmdOrders, ordersFlags},
+		{"fills", "", "list the fills of the account, --follow keeps streaming new ones", cmdFills, streamFlags},
+		{"tape", "", "print the next quote from the tickertape, --follow keeps streaming", cmdTape, streamFlags},
+		{"dashboard", "", "serve a live web view of the book, tape, orders and portfolio of the stock", cmdDashboard, dashboardFlags},
+		{"tui", "", "trade the stock interactively in a full-screen terminal UI", cmdTUI, tuiFlags},
+		{"level", "list|start NAME|status|restart|stop|resume|judge", "control a level through the GameMaster-API, status --follow watches it", cmdLevel, levelFlags},
+		{"config", "", "show the settings sfctl would use", cmdConfig, nil},
+		{"help", "[COMMAND]", "show help", cmdHelp, nil},
+	}
+}
+
+//usageError makes sfctl print the usage of the command and exit with status 2.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...interface{}) error {
+	return usageError{fmt.Sprintf(format, args...)}
+}
+
+//cli is the state of a single sfctl run.
+type cli struct {
+	ctx    context.Context
+	stdout io.Writer
+	stderr io.Writer
+	cmd    command
+
+	cfg        config
+	configPath string
+	json       bool
+	i          *api.Instance
+
+	//command flags
+	depth     int
+	orderType string
+	open      bool
+	follow    bool
+	allStocks bool
+	interval  time.Duration
+	addr      string
+	ticks     int
+	qty       int
+}
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	c := &cli{ctx: ctx, stdout: os.Stdout, stderr: os.Stderr}
+	os.Exit(c.main(os.Args[1:]))
+}
+
+func (c *cli) main(args []string) int {
+	if len(args) == 0 {
+		c.usage()
+		return 2
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		c.cmd = cmd
+		err := c.run(args[1:])
+		switch {
+		case err == nil, errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.As(err, &usageError{}):
+			fmt.Fprintf(c.stderr, "sfctl %s: %v\nusage: %s\n", cmd.name, err, cmd.usage())
+			return 2
+		case errors.Is(err, context.Canceled):
+			return 130
+		}
+		fmt.Fprintf(c.stderr, "sfctl %s: %v\n", cmd.name, err)
+		return 1
+	}
+	fmt.Fprintf(c.stderr, "sfctl: unknown command %q\n", args[0])
+	c.usage()
+	return 2
+}
+
+func (c *cli) usage() {
+	fmt.Fprintln(c.stderr, "usage: sfctl <command> [arguments] [flags]\n\ncommands:")
+	w := tabwriter.NewWriter(c.stderr, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.help)
+	}
+	w.Flush()
+	fmt.Fprintln(c.stderr, "\nRun sfctl help COMMAND for the flags of a command.")
+}
+
+//run parses the arguments of the current command and runs it.
+func (c *cli) run(args []string) error {
+	if c.cmd.name == "help" {
+		return c.cmd.run(c, args)
+	}
+	fs := c.flags()
+	pos, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	return c.cmd.run(c, pos)
+}
+
+//flags creates the flag set of the current command, including the flags shared by all commands.
+func (c *cli) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("sfctl "+c.cmd.name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: %s\n\n%s\n\nflags:\n", c.cmd.usage(), c.cmd.help)
+		fs.PrintDefaults()
+	}
+	fs.String("key", "", "API key (env SF_API_KEY)")
+	fs.String("account", "", "trading account (env SF_ACCOUNT)")
+	fs.String("venue", "", "venue (env SF_VENUE)")
+	fs.String("symbol", "", "stock symbol (env SF_SYMBOL)")
+	fs.Int("instance", 0, "level instance ID (env SF_INSTANCE)")
+	fs.String("base-url", "", "base URL of the Trade API (env SF_BASE_URL)")
+	fs.String("ws-url", "", "base URL of the websockets (env SF_WS_URL)")
+	fs.String("gm-url", "", "base URL of the GameMaster-API (env SF_GM_URL)")
+	fs.StringVar(&c.configPath, "config", "", "config file (env SFCTL_CONFIG)")
+	fs.BoolVar(&c.json, "json", false, "print JSON instead of tables")
+	if c.cmd.flags != nil {
+		c.cmd.flags(c, fs)
+	}
+	return fs
+}
+
+//parse parses flags and positional arguments in any order, loads the config and creates the API instance.
+//Everything after a "--" is positional.
+func (c *cli) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			pos = append(pos, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		pos = append(pos, rest[0])
+		args = rest[1:]
+	}
+
+	if err := c.loadConfig(fs); err != nil {
+		return nil, err
+	}
+	if c.cfg.BaseURL != "" {
+		api.SetBaseURL(c.cfg.BaseURL)
+	}
+	if c.cfg.WSURL != "" {
+		api.SetBaseWSURL(c.cfg.WSURL)
+	}
+	if c.cfg.GMURL != "" {
+		api.SetGMURL(c.cfg.GMURL)
+	}
+	c.i = api.NewInstance(c.cfg.APIKey, c.cfg.Account, c.cfg.Venue, c.cfg.Symbol)
+	c.i.SetInstanceID(c.cfg.Instance)
+	return pos, nil
+}
+
+//loadConfig merges the config file, the environment and the flags, in increasing order of precedence.
+func (c *cli) loadConfig(fs *flag.FlagSet) error {
+	path, explicit := c.configPath, c.configPath != ""
+	if !explicit {
+		path, explicit = os.LookupEnv("SFCTL_CONFIG")
+	}
+	if !explicit {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "sfctl", "config.json")
+		}
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(b, &c.cfg); err != nil {
+				return fmt.Errorf("config %s: %v", path, err)
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return err
+		}
+	}
+
+	set := func(dst *string, env, flagName string) {
+		if v, ok := os.LookupEnv(env); ok {
+			*dst = v
+		}
+		if f := fs.Lookup(flagName); f != nil && isSet(fs, flagName) {
+			*dst = f.Value.String()
+		}
+	}
+	set(&c.cfg.APIKey, "SF_API_KEY", "key")
+	set(&c.cfg.Account, "SF_ACCOUNT", "account")
+	set(&c.cfg.Venue, "SF_VENUE", "venue")
+	set(&c.cfg.Symbol, "SF_SYMBOL", "symbol")
+	set(&c.cfg.BaseURL, "SF_BASE_URL", "base-url")
+	set(&c.cfg.WSURL, "SF_WS_URL", "ws-url")
+	set(&c.cfg.GMURL, "SF_GM_URL", "gm-url")
+
+	instance := ""
+	set(&instance, "SF_INSTANCE", "instance")
+	if instance != "" {
+		id, err := strconv.Atoi(instance)
+		if err != nil {
+			return fmt.Errorf("invalid instance ID %q", instance)
+		}
+		c.cfg.Instance = id
+	}
+	return nil
+}
+
+func isSet(fs *flag.FlagSet, name string) (set bool) {
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return
+}
+
+//need returns an error naming the first setting in names that is missing.
+func (c *cli) need(names ...string) error {
+	values := map[string]string{"key": c.cfg.APIKey, "account": c.cfg.Account, "venue": c.cfg.Venue, "symbol": c.cfg.Symbol}
+	for _, name := range names {
+		if values[name] == "" {
+			return usagef("no %s given, use -%s, the environment or the config file", name, name)
+		}
+	}
+	return nil
+}
+
+//print writes v as JSON or calls table to write it as a table.
+func (c *cli) print(v interface{}, table func(w io.Writer)) error {
+	if c.json {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+//printLine writes a single value of a stream, as one line of JSON or with format.
+func (c *cli) printLine(v interface{}, format string, args ...interface{}) error {
+	if c.json {
+		return json.NewEncoder(c.stdout).Encode(v)
+	}
+	_, err := fmt.Fprintf(c.stdout, format, args...)
+	return err
+}
+
+func cmdHelp(c *cli, args []string) error {
+	if len(args) == 0 {
+		c.usage()
+		return nil
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			c.cmd = cmd
+			c.flags().Usage()
+			return nil
+		}
+	}
+	return usagef("unknown command %q", args[0])
+}
+
+func cmdConfig(c *cli, args []string) error {
+	cfg := c.cfg
+	if n := len(cfg.APIKey); n > 4 {
+		cfg.APIKey = "..." + cfg.APIKey[n-4:]
+	}
+	return c.print(cfg, func(w io.Writer) {
+		rows := map[string]string{
+			"api key":  cfg.APIKey,
+			"account":  cfg.Account,
+			"venue":    cfg.Venue,
+			"symbol":   cfg.Symbol,
+			"instance": strconv.Itoa(cfg.Instance),
+			"base url": cfg.BaseURL,
+			"ws url":   cfg.WSURL,
+			"gm url":   cfg.GMURL,
+		}
+		keys := make([]string, 0, len(rows))
+		for k := range rows {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s\t%s\n", k, rows[k])
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/api/apitest"
+)
+
+func testCLI(t *testing.T, name string) *cli {
+	cfg := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(cfg, []byte(`{"account":"EXB123456"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SFCTL_CONFIG", cfg)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return &cli{stdout: io.Discard, stderr: io.Discard, cmd: cmd}
+		}
+	}
+	t.Fatal("no command", name)
+	return nil
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		pos  []string
+		json bool
+	}{
+		{[]string{"buy", "--type", "ioc", "100", "-json", "@", "5000"}, []string{"buy", "100", "@", "5000"}, true},
+		{[]string{"buy", "--type", "ioc", "--", "-json", "--", "5000"}, []string{"buy", "-json", "--", "5000"}, false},
+		{[]string{"--", "--type"}, []string{"--type"}, false},
+	} {
+		c := testCLI(t, "order")
+		pos, err := c.parse(c.flags(), tc.args)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if !reflect.DeepEqual(pos, tc.pos) || c.json != tc.json || c.cfg.Account != "EXB123456" {
+			t.Errorf("%q: positional %q, json %v", tc.args, pos, c.json)
+		}
+	}
+}
+
+func TestTUIInterval(t *testing.T) {
+	c := testCLI(t, "tui")
+	pos, err := c.parse(c.flags(), []string{"--key", "secret", "--venue", "TESTEX", "--symbol", "FOOBAR", "--interval", "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdTUI(c, pos); !errors.As(err, new(usageError)) {
+		t.Error(err)
+	}
+}
+
+//syncBuffer is a bytes.Buffer that commands may write to while the test reads it.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+//TestFillsFollowSweep streams the fills of an order sweeping two identical asks. Both fills share price, quantity and
+//time and have to be printed.
+func TestFillsFollowSweep(t *testing.T) {
+	ex := apitest.Start(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &syncBuffer{}
+	c := testCLI(t, "fills")
+	c.ctx, c.stdout = ctx, out
+	pos, err := c.parse(c.flags(), []string{"--venue", "TESTEX", "--symbol", "FOOBAR", "--key", "secret", "--follow"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- cmdFills(c, pos) }()
+	apitest.WaitSubscribers(t, ex, 1)
+
+	other := api.NewInstance("", "OTHER", "TESTEX", "FOOBAR")
+	for k := 0; k < 2; k++ {
+		if _, err := other.NewOrderCtx(ctx, 100, 5, api.Sell, api.Limit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := api.NewTestInstance().NewOrderCtx(ctx, 100, 10, api.Buy, api.Limit); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(out.String(), "\n") < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("fills printed:\n%s", out)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+//TestTUISweep books the two identical fills of a sweep from the executions and again from the order status.
+func TestTUISweep(t *testing.T) {
+	tu := newTUI(testCLI(t, "tui"))
+	f := api.Fill{Price: 100, Quantity: 5, TS: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)}
+	o := api.Order{ID: 0, Symbol: "FOOBAR", Direction: api.Buy, OriginalQuantity: 10}
+	for k := 1; k <= 2; k++ {
+		o.Fills, o.TotalFilled, o.Open = append(o.Fills, f), k*5, k < 2
+		tu.execution(api.Execution{Order: o, Price: f.Price, Filled: f.Quantity, FilledAt: f.TS})
+	}
+	tu.addFills(o)
+	if tu.position != 10 || tu.cash != -1000 || len(tu.fills) != 2 {
+		t.Errorf("position %d, cash %d, %d fills", tu.position, tu.cash, len(tu.fills))
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+//screen is a full-screen ANSI terminal: raw input and the alternate screen buffer, restored by close.
+type screen struct {
+	in, out *os.File
+	state   *term.State
+}
+
+func openScreen(in, out *os.File) (*screen, error) {
+	if !term.IsTerminal(int(in.Fd())) || !term.IsTerminal(int(out.Fd())) {
+		return nil, errors.New("stdin and stdout must be a terminal")
+	}
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	//alternate screen, hidden cursor
+	io.WriteString(out, "\x1b[?1049h\x1b[?25l")
+	return &screen{in, out, state}, nil
+}
+
+func (s *screen) close() {
+	io.WriteString(s.out, "\x1b[?25h\x1b[?1049l")
+	term.Restore(int(s.in.Fd()), s.state)
+}
+
+//size returns the size of the terminal, 80x24 if it is unknown.
+func (s *screen) size() (width, height int) {
+	w, h, err := term.GetSize(int(s.out.Fd()))
+	if err != nil || w <= 0 || h <= 0 {
+		return 80, 24
+	}
+	return w, h
+}
+
+//draw replaces the screen with lines in a single write, so it doesn't flicker.
+func (s *screen) draw(lines []string) {
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for k, line := range lines {
+		if k > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(line)
+		b.WriteString("\x1b[K")
+	}
+	b.WriteString("\x1b[J")
+	io.WriteString(s.out, b.String())
+}
+
+//key is a key press: the character typed or the name of a special key like "up" or "ctrl-c".
+type key string
+
+//escapes are the sequences of the special keys, in both the normal and the application cursor mode.
+var escapes = map[string]key{
+	"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left",
+	"\x1bOA": "up", "\x1bOB": "down", "\x1bOC": "right", "\x1bOD": "left",
+	"\x1b[5~": "pgup", "\x1b[6~": "pgdown",
+}
+
+//readKeys sends the keys read from r until reading fails, then it closes keys.
+func readKeys(r io.Reader, keys chan<- key) {
+	defer close(keys)
+	buf := make([]byte, 256)
+	for {
+		n, err := r.Read(buf)
+		for _, k := range parseKeys(buf[:n]) {
+			keys <- k
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+//parseKeys splits input read from a raw terminal into keys. Unknown escape sequences are dropped.
+func parseKeys(b []byte) []key {
+	var keys []key
+	for len(b) > 0 {
+		switch c := b[0]; {
+		case c == 0x1b:
+			n := 1
+			if len(b) > 1 && (b[1] == '[' || b[1] == 'O') {
+				//CSI and SS3 sequences end with a letter or ~
+				for n = 2; n < len(b) && !(b[n] >= 0x40 && b[n] <= 0x7e); n++ {
+				}
+				if n < len(b) {
+					n++
+				}
+			}
+			if k, ok := escapes[string(b[:n])]; ok {
+				keys = append(keys, k)
+			} else if n == 1 {
+				keys = append(keys, "esc")
+			}
+			b = b[n:]
+		case c == 0x03:
+			keys, b = append(keys, "ctrl-c"), b[1:]
+		case c == '\t':
+			keys, b = append(keys, "tab"), b[1:]
+		case c == '\r' || c == '\n':
+			keys, b = append(keys, "enter"), b[1:]
+		case c == 0x7f || c == 0x08:
+			keys, b = append(keys, "backspace"), b[1:]
+		case c < 0x20:
+			b = b[1:]
+		default:
+			r, n := utf8.DecodeRune(b)
+			keys, b = append(keys, key(string(r))), b[n:]
+		}
+	}
+	return keys
+}
+
+//cell cuts or pads s to width columns. s must not contain escape sequences.
+func cell(s string, width int) string {
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		r := []rune(s)
+		return string(r[:width])
+	}
+	return s + strings.Repeat(" ", width-n)
+}
+
+//style wraps s in the SGR attributes attrs, e.g. "1;32" for bold green.
+func style(s, attrs string) string {
+	if attrs == "" {
+		return s
+	}
+	return "\x1b[" + attrs + "m" + s + "\x1b[0m"
+}
@@ -0,0 +1,629 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//maxFills is the number of fills the TUI keeps.
+const maxFills = 200
+
+func tuiFlags(c *cli, fs *flag.FlagSet) {
+	fs.IntVar(&c.depth, "depth", 10, "number of price levels per side of the ladder")
+	fs.IntVar(&c.ticks, "ticks", 50, "number of quotes kept on the tape")
+	fs.IntVar(&c.qty, "qty", 100, "initial order quantity")
+	fs.DurationVar(&c.interval, "interval", 500*time.Millisecond, "polling interval of the orderbook and the open orders")
+}
+
+func cmdTUI(c *cli, args []string) error {
+	if err := c.need("key", "account", "venue", "symbol"); err != nil {
+		return err
+	}
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	if c.interval <= 0 {
+		return usagef("--interval must be positive, not %v", c.interval)
+	}
+	s, err := openScreen(os.Stdin, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	keys := make(chan key, 16)
+	go readKeys(os.Stdin, keys)
+	return newTUI(c).run(c.ctx, keys, s.draw, s.size)
+}
+
+//Focus of the TUI, the panel the arrow keys move in.
+const (
+	focusLadder = iota
+	focusOrders
+)
+
+//tui is the state of sfctl tui. Only the goroutine in run touches it; API calls run in the background and hand their
+//results back as updates.
+type tui struct {
+	c       *cli
+	updates chan func(t *tui)
+
+	book     api.Orderbook
+	ticks    []api.Quote //newest first
+	orders   map[int]api.Order
+	fills    []fill //newest first
+	seen     map[fillID]bool
+	position int
+	cash     int
+
+	focus    int
+	price    int //selected price
+	order    int //index of the selected order, see openOrders
+	qty      int
+	status   string
+	failed   bool //status is an error
+	pending  int  //orders and cancels in flight
+	polling  bool
+	quit     bool
+	modified bool //needs redrawing
+}
+
+func newTUI(c *cli) *tui {
+	return &tui{
+		c:        c,
+		updates:  make(chan func(t *tui)),
+		orders:   map[int]api.Order{},
+		seen:     map[fillID]bool{},
+		qty:      c.qty,
+		status:   "connecting",
+		modified: true,
+	}
+}
+
+//run shows the TUI until q is pressed, the keys end or ctx is done. It draws at most every 50ms.
+func (t *tui) run(ctx context.Context, keys <-chan key, draw func(lines []string), size func() (width, height int)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	quotes := t.c.i.QuotesCtx(ctx, true)
+	executions := t.c.i.ExecutionsCtx(ctx, true, t.c.cfg.Account)
+	qc, ec := quotes.Values, executions.Values
+	t.poll(ctx)
+
+	poll := time.NewTicker(t.c.interval)
+	defer poll.Stop()
+	frame := time.NewTicker(50 * time.Millisecond)
+	defer frame.Stop()
+	var width, height int
+
+	for !t.quit {
+		select {
+		case <-ctx.Done():
+			return nil
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			t.key(ctx, k)
+		case q, ok := <-qc:
+			if !ok {
+				qc = nil
+				t.fail(fmt.Errorf("quotes: %v", quotes.Err()))
+				continue
+			}
+			t.quote(q)
+		case e, ok := <-ec:
+			if !ok {
+				ec = nil
+				t.fail(fmt.Errorf("executions: %v", executions.Err()))
+				continue
+			}
+			t.execution(e)
+		case update := <-t.updates:
+			update(t)
+		case <-poll.C:
+			t.poll(ctx)
+		case <-frame.C:
+			if w, h := size(); t.modified || w != width || h != height {
+				width, height, t.modified = w, h, false
+				draw(t.render(width, height))
+			}
+			continue
+		}
+		t.modified = true
+	}
+	return nil
+}
+
+//background runs call on another goroutine. The function it returns gets applied on the goroutine of run.
+func (t *tui) background(ctx context.Context, call func() func(t *tui)) {
+	go func() {
+		apply := call()
+		select {
+		case t.updates <- apply:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+//do works like background for the orders and cancels the user waits for, which are shown as pending until they return.
+func (t *tui) do(ctx context.Context, call func() func(t *tui)) {
+	t.pending++
+	t.background(ctx, func() func(t *tui) {
+		apply := call()
+		return func(t *tui) {
+			t.pending--
+			apply(t)
+		}
+	})
+}
+
+func (t *tui) setStatus(format string, args ...interface{}) {
+	t.status, t.failed = fmt.Sprintf(format, args...), false
+}
+
+func (t *tui) fail(err error) {
+	t.status, t.failed = err.Error(), true
+}
+
+//poll refreshes the orderbook and the orders, unless the last poll is still running.
+func (t *tui) poll(ctx context.Context) {
+	if t.polling {
+		return
+	}
+	t.polling = true
+	i := t.c.i
+	t.background(ctx, func() func(t *tui) {
+		book, bookErr := i.OrderbookCtx(ctx)
+		orders, ordersErr := i.StockOrderStatusCtx(ctx)
+		return func(t *tui) {
+			t.polling = false
+			if bookErr != nil {
+				t.fail(bookErr)
+			} else {
+				t.book = book
+				if t.price == 0 {
+					t.price = t.initialPrice()
+				}
+			}
+			if ordersErr != nil {
+				t.fail(ordersErr)
+				return
+			}
+			if t.status == "connecting" {
+				t.setStatus("ready")
+			}
+			open := map[int]api.Order{}
+			for _, o := range orders {
+				t.addFills(o)
+				if o.Open {
+					open[o.ID] = o
+				}
+			}
+			t.orders = open
+		}
+	})
+}
+
+//initialPrice selects the best bid, the best ask or the last price, whatever is there first.
+func (t *tui) initialPrice() int {
+	if len(t.book.Bids) > 0 {
+		return t.book.Bids[0].Price
+	}
+	if len(t.book.Asks) > 0 {
+		return t.book.Asks[0].Price
+	}
+	if len(t.ticks) > 0 {
+		return t.ticks[0].LastPrice
+	}
+	return 0
+}
+
+func (t *tui) quote(q api.Quote) {
+	t.ticks = append([]api.Quote{q}, t.ticks...)
+	if len(t.ticks) > t.c.ticks {
+		t.ticks = t.ticks[:t.c.ticks]
+	}
+}
+
+func (t *tui) execution(e api.Execution) {
+	o := e.Order
+	f := fill{o.ID, o.Symbol, string(o.Direction), e.Price, e.Filled, e.FilledAt}
+	if t.addFill(executionFillID(e), f) {
+		t.setStatus("filled %s %d @ %d, order %d", o.Direction, e.Filled, e.Price, o.ID)
+	}
+	t.update(o)
+}
+
+//update stores the state of one of our orders unless a newer one is known.
+func (t *tui) update(o api.Order) {
+	if old, ok := t.orders[o.ID]; ok && o.TotalFilled < old.TotalFilled {
+		return
+	}
+	if o.Open {
+		t.orders[o.ID] = o
+	} else {
+		delete(t.orders, o.ID)
+	}
+}
+
+func (t *tui) addFills(o api.Order) {
+	offset := 0
+	for _, f := range o.Fills {
+		t.addFill(fillID{o.ID, offset}, fill{o.ID, o.Symbol, string(o.Direction), f.Price, f.Quantity, f.TS})
+		offset += f.Quantity
+	}
+}
+
+//addFill books f with the given ID unless it was seen already and reports whether it is new.
+func (t *tui) addFill(id fillID, f fill) bool {
+	if t.seen[id] {
+		return false
+	}
+	t.seen[id] = true
+	if f.Direction == string(api.Buy) {
+		t.position += f.Quantity
+		t.cash -= f.Quantity * f.Price
+	} else {
+		t.position -= f.Quantity
+		t.cash += f.Quantity * f.Price
+	}
+	k := sort.Search(len(t.fills), func(k int) bool { return t.fills[k].TS.Before(f.TS) })
+	t.fills = append(t.fills, fill{})
+	copy(t.fills[k+1:], t.fills[k:])
+	t.fills[k] = f
+	if len(t.fills) > maxFills {
+		t.fills = t.fills[:maxFills]
+	}
+	return true
+}
+
+//openOrders returns the open orders like the ladder: sells above buys, each from the highest price down.
+func (t *tui) openOrders() []api.Order {
+	v := make([]api.Order, 0, len(t.orders))
+	for _, o := range t.orders {
+		v = append(v, o)
+	}
+	sort.Slice(v, func(a, b int) bool {
+		x, y := v[a], v[b]
+		if x.Direction != y.Direction {
+			return x.Direction == api.Sell
+		}
+		if x.Price != y.Price {
+			return x.Price > y.Price
+		}
+		return x.ID < y.ID
+	})
+	return v
+}
+
+func (t *tui) key(ctx context.Context, k key) {
+	switch k {
+	case "q", "ctrl-c":
+		t.quit = true
+	case "tab":
+		t.focus = (t.focus + 1) % 2
+	case "up", "k":
+		t.move(1)
+	case "down", "j":
+		t.move(-1)
+	case "+", "=":
+		t.price++
+	case "-":
+		if t.price > 1 {
+			t.price--
+		}
+	case "backspace":
+		t.qty /= 10
+	case "b":
+		t.place(ctx, api.Buy, api.Limit)
+	case "s":
+		t.place(ctx, api.Sell, api.Limit)
+	case "B":
+		t.place(ctx, api.Buy, api.ImmediateOrCancel)
+	case "S":
+		t.place(ctx, api.Sell, api.ImmediateOrCancel)
+	case "c":
+		t.cancelSelected(ctx)
+	case "C":
+		var ids []int
+		for id := range t.orders {
+			ids = append(ids, id)
+		}
+		t.cancel(ctx, ids)
+	case "r":
+		t.poll(ctx)
+	default:
+		if len(k) == 1 && k[0] >= '0' && k[0] <= '9' && t.qty < 1e8 {
+			t.qty = t.qty*10 + int(k[0]-'0')
+		}
+	}
+}
+
+//move selects the next price level up (dir 1) or down (-1) on the ladder, or the next order in that direction.
+func (t *tui) move(dir int) {
+	if t.focus == focusOrders {
+		t.order -= dir
+		if n := len(t.orders); t.order >= n {
+			t.order = n - 1
+		}
+		if t.order < 0 {
+			t.order = 0
+		}
+		return
+	}
+	next := 0
+	for _, r := range t.ladder(t.c.depth) {
+		if dir > 0 && r.price > t.price && (next == 0 || r.price < next) || dir < 0 && r.price < t.price && r.price > next {
+			next = r.price
+		}
+	}
+	if next != 0 {
+		t.price = next
+	}
+}
+
+func (t *tui) place(ctx context.Context, direction api.OrderDirection, orderType api.OrderType) {
+	price, qty := t.price, t.qty
+	if price <= 0 || qty <= 0 {
+		t.setStatus("select a price and type a quantity first")
+		return
+	}
+	t.setStatus("placing %s %d @ %d %s", direction, qty, price, orderType)
+	i := t.c.i
+	t.do(ctx, func() func(t *tui) {
+		o, err := i.NewOrderCtx(ctx, price, qty, direction, orderType)
+		return func(t *tui) {
+			if err != nil {
+				t.fail(err)
+				return
+			}
+			t.addFills(o)
+			t.update(o)
+			t.setStatus("order %d: %s %d @ %d %s, filled %d", o.ID, o.Direction, o.OriginalQuantity, o.Price, o.OrderType, o.TotalFilled)
+		}
+	})
+}
+
+//cancelSelected cancels the selected order, or all of our orders at the selected price on the ladder.
+func (t *tui) cancelSelected(ctx context.Context) {
+	var ids []int
+	if t.focus == focusOrders {
+		if orders := t.openOrders(); t.order < len(orders) {
+			ids = append(ids, orders[t.order].ID)
+		}
+	} else {
+		for id, o := range t.orders {
+			if o.Price == t.price {
+				ids = append(ids, id)
+			}
+		}
+	}
+	t.cancel(ctx, ids)
+}
+
+func (t *tui) cancel(ctx context.Context, ids []int) {
+	if len(ids) == 0 {
+		t.setStatus("no open orders to cancel")
+		return
+	}
+	t.setStatus("cancelling %d orders", len(ids))
+	i := t.c.i
+	for _, id := range ids {
+		id := id
+		t.do(ctx, func() func(t *tui) {
+			o, err := i.CancelOrderCtx(ctx, id)
+			return func(t *tui) {
+				if err != nil {
+					t.fail(fmt.Errorf("cancel %d: %v", id, err))
+					return
+				}
+				t.addFills(o)
+				t.update(o)
+				t.setStatus("cancelled order %d, filled %d of %d", o.ID, o.TotalFilled, o.OriginalQuantity)
+			}
+		})
+	}
+}
+
+//rung is a price level of the ladder.
+type rung struct {
+	price, bid, ask int
+	ours            int //open quantity of our orders
+}
+
+//ladder returns up to depth levels per side from the highest ask down to the lowest bid. The selected price is
+//always on it, even if there is nothing at that price.
+func (t *tui) ladder(depth int) []rung {
+	var v []rung
+	asks := levels(t.book.Asks, depth)
+	for k := len(asks) - 1; k >= 0; k-- {
+		v = append(v, rung{price: asks[k].Price, ask: asks[k].Quantity})
+	}
+	for _, l := range levels(t.book.Bids, depth) {
+		v = append(v, rung{price: l.Price, bid: l.Quantity})
+	}
+	if t.price > 0 {
+		k := sort.Search(len(v), func(k int) bool { return v[k].price <= t.price })
+		if k == len(v) || v[k].price != t.price {
+			v = append(v, rung{})
+			copy(v[k+1:], v[k:])
+			v[k] = rung{price: t.price}
+		}
+	}
+	for _, o := range t.orders {
+		for k := range v {
+			if v[k].price == o.Price {
+				v[k].ours += o.Quantity
+			}
+		}
+	}
+	return v
+}
+
+//line is a line of a panel before it gets cut to width and styled.
+type line struct {
+	text, attrs string
+}
+
+//panel lays out a title and lines in width columns and exactly height lines.
+func panel(title string, focused bool, lines []line, width, height int) []string {
+	attrs := "1"
+	if focused {
+		attrs = "1;7"
+	}
+	v := []string{style(cell(" "+title, width), attrs)}
+	for _, l := range lines {
+		if len(v) == height {
+			break
+		}
+		v = append(v, style(cell(l.text, width), l.attrs))
+	}
+	for len(v) < height {
+		v = append(v, cell("", width))
+	}
+	return v[:height]
+}
+
+//render lays out the screen: quote and position on top, the ladder next to the tape, the open orders next to the
+//fills and the keys and the last status at the bottom.
+func (t *tui) render(width, height int) []string {
+	if width < 60 || height < 16 {
+		return []string{cell("terminal too small", width)}
+	}
+	cfg := t.c.cfg
+	head := fmt.Sprintf(" %s @ %s:%s", cfg.Account, cfg.Venue, cfg.Symbol)
+	if len(t.ticks) > 0 {
+		q := t.ticks[0]
+		head += fmt.Sprintf("   bid %d x %d   ask %d x %d   last %d x %d", q.Bid, q.BidSize, q.Ask, q.AskSize, q.LastPrice, q.LastSize)
+	}
+	head += fmt.Sprintf("   position %+d   cash %d", t.position, t.cash)
+	v := []string{style(cell(head, width), "7")}
+
+	body := height - 3
+	top, bottom := body*3/5, body-body*3/5
+	lw := width / 2
+	rw := width - lw - 1
+	join := func(left, right []string) {
+		for k := range left {
+			v = append(v, left[k]+"│"+right[k])
+		}
+	}
+	join(panel("ORDERBOOK", t.focus == focusLadder, t.ladderLines(top-2), lw, top),
+		panel("TAPE", false, t.tapeLines(), rw, top))
+	join(panel("OPEN ORDERS", t.focus == focusOrders, t.orderLines(bottom-2), lw, bottom),
+		panel("FILLS", false, t.fillLines(), rw, bottom))
+
+	keys := fmt.Sprintf(" qty %d  price %d │ b/s limit  B/S ioc  ↑↓ level  +/- price  0-9 qty  c cancel  C cancel all  tab focus  r refresh  q quit", t.qty, t.price)
+	v = append(v, style(cell(keys, width), "7"))
+	status := " " + t.status
+	if t.pending > 0 {
+		status += fmt.Sprintf(" (%d pending)", t.pending)
+	}
+	attrs := ""
+	if t.failed {
+		attrs = "31"
+	}
+	return append(v, style(cell(status, width), attrs))
+}
+
+//ladderLines returns the column header and the ladder for rows lines, keeping the selected price in the middle.
+func (t *tui) ladderLines(rows int) []line {
+	ladder := t.ladder(t.c.depth)
+	start := 0
+	for k, r := range ladder {
+		if r.price == t.price {
+			start = k - rows/2
+		}
+	}
+	if start > len(ladder)-rows {
+		start = len(ladder) - rows
+	}
+	if start < 0 {
+		start = 0
+	}
+	v := []line{{text: fmt.Sprintf("%8s %8s %8s %8s", "OURS", "BID", "PRICE", "ASK")}}
+	for k := start; k < len(ladder) && k < start+rows; k++ {
+		r := ladder[k]
+		l := line{text: fmt.Sprintf("%8s %8s %8d %8s", blank(r.ours), blank(r.bid), r.price, blank(r.ask))}
+		switch {
+		case r.bid > 0:
+			l.attrs = "32"
+		case r.ask > 0:
+			l.attrs = "31"
+		}
+		if r.ours > 0 {
+			l.attrs += ";1"
+		}
+		if r.price == t.price {
+			l.attrs += ";7"
+		}
+		l.attrs = strings.TrimPrefix(l.attrs, ";")
+		v = append(v, l)
+	}
+	return v
+}
+
+//blank formats n, leaving out zeros.
+func blank(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprint(n)
+}
+
+func (t *tui) tapeLines() []line {
+	v := []line{{text: fmt.Sprintf("%-12s %15s %15s %15s", "TIME", "BID", "ASK", "LAST")}}
+	for _, q := range t.ticks {
+		v = append(v, line{text: fmt.Sprintf("%-12s %15s %15s %15s", formatTime(q.QuoteTime),
+			fmt.Sprintf("%d x %d", q.Bid, q.BidSize), fmt.Sprintf("%d x %d", q.Ask, q.AskSize), fmt.Sprintf("%d x %d", q.LastPrice, q.LastSize))})
+	}
+	return v
+}
+
+//orderLines returns the column header and the open orders for rows lines, scrolled to the selected one.
+func (t *tui) orderLines(rows int) []line {
+	orders := t.openOrders()
+	if t.order >= len(orders) {
+		t.order = len(orders) - 1
+	}
+	if t.order < 0 {
+		t.order = 0
+	}
+	start := 0
+	if t.order >= rows {
+		start = t.order - rows + 1
+	}
+	v := []line{{text: fmt.Sprintf("%-8s %-4s %-20s %8s %8s %8s", "ID", "SIDE", "TYPE", "PRICE", "QTY", "FILLED")}}
+	for k := start; k < len(orders); k++ {
+		o := orders[k]
+		l := line{text: fmt.Sprintf("%-8d %-4s %-20s %8d %8d %8d", o.ID, o.Direction, o.OrderType, o.Price, o.Quantity, o.TotalFilled), attrs: "31"}
+		if o.Direction == api.Buy {
+			l.attrs = "32"
+		}
+		if t.focus == focusOrders && k == t.order {
+			l.attrs += ";7"
+		}
+		v = append(v, l)
+	}
+	return v
+}
+
+func (t *tui) fillLines() []line {
+	v := []line{{text: fmt.Sprintf("%-12s %-4s %8s %8s %8s", "TIME", "SIDE", "PRICE", "QTY", "ORDER")}}
+	for _, f := range t.fills {
+		l := line{text: fmt.Sprintf("%-12s %-4s %8d %8d %8d", formatTime(f.TS), f.Direction, f.Price, f.Quantity, f.OrderID), attrs: "31"}
+		if f.Direction == string(api.Buy) {
+			l.attrs = "32"
+		}
+		v = append(v, l)
+	}
+	return v
+}
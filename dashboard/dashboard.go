@@ -0,0 +1,401 @@
+// Package dashboard serves a live web view of the stocks an instance trades: an orderbook ladder, a price chart of
+// the tape, the open orders and fills of the account and its portfolio.
+//
+// A Dashboard is an http.Handler with its page compiled in, so it can be mounted in any server. Run feeds it from
+// the streams of the instance and pushes every change to the browsers with server-sent events.
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//Config configures a Dashboard.
+type Config struct {
+	//Depth is the number of price levels shown per side of the ladder.
+	Depth int
+	//Trades is the number of trades kept for the price chart, DefaultConfig.Trades if <= 0.
+	Trades int
+	//Fills is the number of fills of the account that are shown, DefaultConfig.Fills if <= 0.
+	Fills int
+	//Interval is the minimum time between two updates pushed to the browsers. 0 pushes every change right away.
+	Interval time.Duration
+	//OrderPoll is the interval in which the open orders are refreshed, 0 disables it. Executions update the orders they
+	//fill right away, but new orders only show up with the next poll.
+	OrderPoll time.Duration
+	//Tracker configures the orderbooks behind the ladders. Its Account is set to the account of the instance.
+	Tracker api.TrackerConfig
+}
+
+//DefaultConfig shows 10 levels per side, 500 trades and 100 fills, updated at most 4 times a second.
+var DefaultConfig = Config{
+	Depth:     10,
+	Trades:    500,
+	Fills:     100,
+	Interval:  250 * time.Millisecond,
+	OrderPoll: time.Second,
+	Tracker:   api.DefaultTrackerConfig,
+}
+
+//State is what the dashboard shows. It is pushed to the browsers as JSON.
+type State struct {
+	Account   string    `json:"account"`
+	Updated   time.Time `json:"updated"`
+	Stocks    []Stock   `json:"stocks"`
+	Fills     []Fill    `json:"fills"` //newest first
+	Portfolio Portfolio `json:"portfolio"`
+	Err       string    `json:"error,omitempty"` //last error of the streams or polls
+}
+
+//Stock is the market of a single stock and our orders in it.
+type Stock struct {
+	Venue  string              `json:"venue"`
+	Symbol string              `json:"symbol"`
+	Quote  api.Quote           `json:"quote"`
+	Bids   []api.MarketRequest `json:"bids"` //best first
+	Asks   []api.MarketRequest `json:"asks"` //best first
+	Trades []Trade             `json:"trades"`
+	Orders []api.Order         `json:"orders"` //open orders of the account
+}
+
+//Trade is a trade seen on the tape.
+type Trade struct {
+	Time  time.Time `json:"time"`
+	Price int       `json:"price"`
+	Size  int       `json:"size"`
+}
+
+//Fill is a fill of an order of the account.
+type Fill struct {
+	Time      time.Time          `json:"time"`
+	Venue     string             `json:"venue"`
+	Symbol    string             `json:"symbol"`
+	OrderID   int                `json:"orderId"`
+	Direction api.OrderDirection `json:"direction"`
+	Price     int                `json:"price"`
+	Quantity  int                `json:"qty"`
+	offset    int                //shares of the order filled before, tells the identical fills of a sweep apart
+}
+
+//Portfolio sums up the positions of the account. Amounts are in cents.
+type Portfolio struct {
+	Cash       int            `json:"cash"`
+	NAV        float64        `json:"nav"`
+	Realized   float64        `json:"realized"`
+	Unrealized float64        `json:"unrealized"`
+	Positions  []api.Position `json:"positions"`
+}
+
+//stock is the live state of a listing.
+type stock struct {
+	l       *api.Listing
+	tracker *api.OrderBookTracker
+	quote   api.Quote
+	trades  []Trade
+	orders  map[int]api.Order
+}
+
+//Dashboard shows the stocks of an instance in the browser. See the package documentation.
+type Dashboard struct {
+	i         *api.Instance
+	c         Config
+	stocks    []*stock
+	portfolio *api.Portfolio
+
+	mu      sync.Mutex
+	fills   []Fill
+	err     error
+	dirty   bool
+	snap    []byte                   //last pushed State as JSON
+	clients map[chan []byte]struct{} //event streams of the connected browsers
+}
+
+//New returns a Dashboard for the given listings of i, or for the current stock of i if there are none.
+func New(i *api.Instance, c Config, listings ...*api.Listing) *Dashboard {
+	if len(listings) == 0 {
+		listings = []*api.Listing{i.Listing(i.GetVenue(), i.GetSymbol())}
+	}
+	if c.Trades <= 0 {
+		c.Trades = DefaultConfig.Trades
+	}
+	if c.Fills <= 0 {
+		c.Fills = DefaultConfig.Fills
+	}
+	d := &Dashboard{i: i, c: c, portfolio: i.NewPortfolio(), clients: map[chan []byte]struct{}{}}
+	for _, l := range listings {
+		d.stocks = append(d.stocks, &stock{l: l, orders: map[int]api.Order{}})
+	}
+	d.snap, _ = json.Marshal(d.state())
+	return d
+}
+
+func (d *Dashboard) setErr(err error) {
+	if err != nil {
+		d.mu.Lock()
+		d.err = err
+		d.dirty = true
+		d.mu.Unlock()
+	}
+}
+
+//Run keeps the dashboard current until ctx is done and returns ctx.Err(). It books the existing fills of the account,
+//tracks the orderbooks and follows the quotes and executions of every stock.
+func (d *Dashboard) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+	quotes, executions := make(chan api.Quote), make(chan api.Execution)
+	for _, s := range d.stocks {
+		qs, es := s.l.QuotesCtx(ctx), s.l.ExecutionsCtx(ctx)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for q := range qs.Values {
+				select {
+				case quotes <- q:
+				case <-ctx.Done():
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for e := range es.Values {
+				select {
+				case executions <- e:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+	//the streams are open, so nothing gets lost between them and the snapshots
+	venues := map[string]bool{}
+	for _, s := range d.stocks {
+		venues[s.l.Venue()] = true
+	}
+	for venue := range venues {
+		d.setErr(d.portfolio.Rebuild(ctx, venue))
+	}
+	tc := d.c.Tracker
+	tc.Account = d.i.GetAccount()
+	for _, s := range d.stocks {
+		t, err := s.l.TrackOrderBook(ctx, tc)
+		d.setErr(err)
+		d.mu.Lock()
+		s.tracker = t
+		d.mu.Unlock()
+		d.seedFills(d.pollOrders(ctx, s))
+	}
+	//stop the streams before waiting for the goroutines forwarding them
+	defer wg.Wait()
+	defer cancel()
+
+	var push <-chan time.Time
+	if d.c.Interval > 0 {
+		t := time.NewTicker(d.c.Interval)
+		defer t.Stop()
+		push = t.C
+	}
+	var poll <-chan time.Time
+	if d.c.OrderPoll > 0 {
+		t := time.NewTicker(d.c.OrderPoll)
+		defer t.Stop()
+		poll = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case q := <-quotes:
+			d.portfolio.Mark(q)
+			d.quote(q)
+		case e := <-executions:
+			d.portfolio.ApplyExecution(e)
+			d.execution(e)
+		case <-poll:
+			for _, s := range d.stocks {
+				d.pollOrders(ctx, s)
+			}
+		case <-push:
+			d.push()
+		}
+		if push == nil {
+			d.push()
+		}
+	}
+}
+
+//find returns the stock of venue and symbol, nil if it isn't shown.
+func (d *Dashboard) find(venue, symbol string) *stock {
+	for _, s := range d.stocks {
+		if s.l.Venue() == venue && s.l.Symbol() == symbol {
+			return s
+		}
+	}
+	return nil
+}
+
+func (d *Dashboard) quote(q api.Quote) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.find(q.Venue, q.Symbol)
+	if s == nil {
+		return
+	}
+	//quotes repeat the last trade until the next one
+	if q.LastSize > 0 && (len(s.trades) == 0 || q.LastTrade.After(s.trades[len(s.trades)-1].Time)) {
+		s.trades = append(s.trades, Trade{q.LastTrade, q.LastPrice, q.LastSize})
+		if n := len(s.trades) - d.c.Trades; n > 0 {
+			s.trades = append(s.trades[:0:0], s.trades[n:]...)
+		}
+	}
+	s.quote = q
+	d.dirty = true
+}
+
+func (d *Dashboard) execution(e api.Execution) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	o := e.Order
+	if s := d.find(o.Venue, o.Symbol); s != nil {
+		s.update(o)
+	}
+	d.addFill(Fill{e.FilledAt, o.Venue, o.Symbol, o.ID, o.Direction, e.Price, e.Filled, o.TotalFilled - e.Filled})
+	d.dirty = true
+}
+
+//addFill adds f to the fills unless it is known already, e.g. from the order status. d.mu must be held.
+func (d *Dashboard) addFill(f Fill) {
+	for _, x := range d.fills {
+		if x.OrderID == f.OrderID && x.Venue == f.Venue && x.offset == f.offset {
+			return
+		}
+	}
+	k := sort.Search(len(d.fills), func(k int) bool { return d.fills[k].Time.Before(f.Time) })
+	d.fills = append(d.fills, Fill{})
+	copy(d.fills[k+1:], d.fills[k:])
+	d.fills[k] = f
+	if len(d.fills) > d.c.Fills {
+		d.fills = d.fills[:d.c.Fills]
+	}
+}
+
+//seedFills adds the fills of orders, so the dashboard starts out with the fills that happened before it.
+func (d *Dashboard) seedFills(orders []api.Order) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, o := range orders {
+		offset := 0
+		for _, f := range o.Fills {
+			d.addFill(Fill{f.TS, o.Venue, o.Symbol, o.ID, o.Direction, f.Price, f.Quantity, offset})
+			offset += f.Quantity
+		}
+	}
+	d.dirty = true
+}
+
+//update stores the state of an order if it isn't older than the known one.
+func (s *stock) update(o api.Order) {
+	if old, ok := s.orders[o.ID]; ok && o.TotalFilled < old.TotalFilled {
+		return
+	}
+	if o.Open {
+		s.orders[o.ID] = o
+	} else {
+		delete(s.orders, o.ID)
+	}
+}
+
+//pollOrders refreshes the open orders of a stock and returns all of its orders.
+func (d *Dashboard) pollOrders(ctx context.Context, s *stock) []api.Order {
+	orders, err := s.l.StockOrderStatusCtx(ctx)
+	if err != nil {
+		d.setErr(err)
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	open := map[int]api.Order{}
+	for _, o := range orders {
+		if o.Open {
+			open[o.ID] = o
+		}
+	}
+	s.orders = open
+	d.dirty = true
+	return orders
+}
+
+//state returns the current State. d.mu must be held.
+func (d *Dashboard) state() State {
+	v := State{Account: d.i.GetAccount(), Updated: time.Now(), Fills: append([]Fill{}, d.fills...)}
+	if d.err != nil {
+		v.Err = d.err.Error()
+	}
+	for _, s := range d.stocks {
+		x := Stock{Venue: s.l.Venue(), Symbol: s.l.Symbol(), Quote: s.quote, Trades: append([]Trade{}, s.trades...),
+			Orders: []api.Order{}, Bids: []api.MarketRequest{}, Asks: []api.MarketRequest{}}
+		if s.tracker != nil {
+			x.Bids, x.Asks = s.tracker.Levels(true, d.c.Depth), s.tracker.Levels(false, d.c.Depth)
+		}
+		for _, o := range s.orders {
+			x.Orders = append(x.Orders, o)
+		}
+		sortOrders(x.Orders)
+		v.Stocks = append(v.Stocks, x)
+	}
+	p := d.portfolio
+	v.Portfolio.Cash, v.Portfolio.NAV, v.Portfolio.Positions = p.Cash(), p.NAV(), p.Positions()
+	v.Portfolio.Realized, v.Portfolio.Unrealized = p.PnL()
+	return v
+}
+
+//sortOrders sorts orders like a ladder: asks above bids, each from the highest price down, then by ID.
+func sortOrders(orders []api.Order) {
+	sort.Slice(orders, func(a, b int) bool {
+		x, y := orders[a], orders[b]
+		if x.Direction != y.Direction {
+			return x.Direction == api.Sell
+		}
+		if x.Price != y.Price {
+			return x.Price > y.Price
+		}
+		return x.ID < y.ID
+	})
+}
+
+//State returns what the dashboard shows right now.
+func (d *Dashboard) State() State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state()
+}
+
+//push sends the state to the browsers if it changed since the last push.
+func (d *Dashboard) push() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.dirty {
+		return
+	}
+	d.dirty = false
+	b, err := json.Marshal(d.state())
+	if err != nil {
+		return
+	}
+	d.snap = b
+	for c := range d.clients {
+		//a slow browser only needs the newest state
+		select {
+		case <-c:
+		default:
+		}
+		c <- b
+	}
+}
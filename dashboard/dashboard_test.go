@@ -0,0 +1,103 @@
+package dashboard_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/api/apitest"
+	"github.com/ianberinger/stockfighter/dashboard"
+)
+
+//state fetches the State served by d.
+func state(t *testing.T, d *dashboard.Dashboard) (v dashboard.State) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/state", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+//TestZeroConfig runs a dashboard with a zero Config, which keeps the default trades and fills and pushes every change.
+func TestZeroConfig(t *testing.T) {
+	ex := apitest.Start(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	i := api.NewTestInstance()
+	d := dashboard.New(i, dashboard.Config{})
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+	apitest.WaitSubscribers(t, ex, 2)
+
+	if _, err := i.NewOrderCtx(ctx, 5000, 10, api.Sell, api.Limit); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := i.NewOrderCtx(ctx, 5000, 4, api.Buy, api.Limit); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		v := state(t, d)
+		if len(v.Stocks) == 1 && len(v.Stocks[0].Trades) == 1 && len(v.Fills) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no trade and fills pushed %+v", v)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+//TestSweep shows both fills of an order sweeping two identical asks, which share price, quantity and time.
+func TestSweep(t *testing.T) {
+	ex := apitest.Start(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	i := api.NewTestInstance()
+	d := dashboard.New(i, dashboard.DefaultConfig)
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+	apitest.WaitSubscribers(t, ex, 2)
+
+	other := api.NewInstance("", "OTHER", "TESTEX", "FOOBAR")
+	for k := 0; k < 2; k++ {
+		if _, err := other.NewOrderCtx(ctx, 100, 5, api.Sell, api.Limit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bid, err := i.NewOrderCtx(ctx, 100, 10, api.Buy, api.Limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		v := state(t, d)
+		if len(v.Fills) == 2 {
+			for _, f := range v.Fills {
+				if f.OrderID != bid.ID || f.Quantity != 5 {
+					t.Errorf("fill %+v", f)
+				}
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("fills of the sweep %+v", v.Fills)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
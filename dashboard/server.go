@@ -0,0 +1,76 @@
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+//go:embed static
+var static embed.FS
+
+//heartbeat is the interval of the comments that keep idle event streams open through proxies.
+const heartbeat = 15 * time.Second
+
+//ServeHTTP serves the page at /, the State as JSON at /state and a stream of States as server-sent events at /events.
+//The page uses relative URLs, so the dashboard can be mounted under a prefix with http.StripPrefix.
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/state":
+		d.serveState(w, r)
+	case "/events":
+		d.serveEvents(w, r)
+	default:
+		sub, _ := fs.Sub(static, "static")
+		http.FileServer(http.FS(sub)).ServeHTTP(w, r)
+	}
+}
+
+func (d *Dashboard) serveState(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	b := d.snap
+	d.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(b)
+}
+
+func (d *Dashboard) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	//the current state goes out first, every push after it
+	c := make(chan []byte, 1)
+	d.mu.Lock()
+	c <- d.snap
+	d.clients[c] = struct{}{}
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.clients, c)
+		d.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case b := <-c:
+			w.Write([]byte("data: "))
+			w.Write(b)
+			w.Write([]byte("\n\n"))
+		case <-ticker.C:
+			w.Write([]byte(": heartbeat\n\n"))
+		}
+		flusher.Flush()
+	}
+}
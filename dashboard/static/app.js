@@ -0,0 +1,203 @@
+'use strict';
+
+// The server pushes the whole state on every change, see State in dashboard.go. Prices are in cents.
+let state = null;
+let selected = '';
+
+const $ = (sel) => document.querySelector(sel);
+
+function money(cents) {
+	return (cents / 100).toFixed(2);
+}
+
+function time(t) {
+	return new Date(t).toLocaleTimeString();
+}
+
+function key(s) {
+	return s.venue + ':' + s.symbol;
+}
+
+function rows(tbody, items, cells) {
+	tbody.replaceChildren(...items.map((item) => {
+		const tr = document.createElement('tr');
+		for (const [text, cls] of cells(item)) {
+			const td = document.createElement('td');
+			td.textContent = text;
+			if (cls) td.className = cls;
+			tr.appendChild(td);
+		}
+		return tr;
+	}));
+}
+
+function stocks() {
+	const sel = $('#stock');
+	const keys = state.stocks.map(key);
+	if (sel.options.length !== keys.length || keys.some((k, n) => sel.options[n].value !== k)) {
+		sel.replaceChildren(...keys.map((k) => new Option(k, k)));
+	}
+	if (!keys.includes(selected)) selected = keys[0] || '';
+	sel.value = selected;
+	sel.hidden = keys.length < 2;
+	return state.stocks.find((s) => key(s) === selected);
+}
+
+// ladder shows the asks above the bids, best prices in the middle, with the size of our open orders at each price.
+function ladder(s) {
+	const ours = {buy: {}, sell: {}};
+	for (const o of s.orders) {
+		ours[o.direction][o.price] = (ours[o.direction][o.price] || 0) + o.qty;
+	}
+	const max = Math.max(1, ...s.bids.map((l) => l.qty), ...s.asks.map((l) => l.qty));
+	const tbody = $('#ladder tbody');
+	tbody.replaceChildren();
+	const add = (l, isBuy, first) => {
+		const tr = document.createElement('tr');
+		if (first) tr.className = 'spread';
+		const mine = (isBuy ? ours.buy : ours.sell)[l.price];
+		const cells = isBuy ?
+			[[mine || '', 'ours'], [l.qty, 'bid'], [money(l.price), 'price'], ['', ''], ['', 'ours']] :
+			[['', 'ours'], ['', ''], [money(l.price), 'price'], [l.qty, 'ask'], [mine || '', 'ours']];
+		for (const [text, cls] of cells) {
+			const td = document.createElement('td');
+			td.textContent = text;
+			td.className = cls;
+			if (cls === 'bid' || cls === 'ask') td.style.setProperty('--w', (100 * l.qty / max) + '%');
+			tr.appendChild(td);
+		}
+		tbody.appendChild(tr);
+	};
+	s.asks.slice().reverse().forEach((l) => add(l, false, false));
+	s.bids.forEach((l, n) => add(l, true, n === 0));
+
+	const q = s.quote;
+	$('#quote').textContent = q.quoteTime ?
+		`bid ${q.bid ? money(q.bid) : '-'} x ${q.bidSize}  ask ${q.ask ? money(q.ask) : '-'} x ${q.askSize}  last ${q.last ? money(q.last) : '-'} x ${q.lastSize}  ${time(q.quoteTime)}` :
+		'waiting for quotes';
+}
+
+// chart draws the tape as a line of trade prices over time, with the current bid and ask as dashed lines.
+function chart(s) {
+	const canvas = $('#chart');
+	const ratio = window.devicePixelRatio || 1;
+	const w = canvas.clientWidth, h = canvas.clientHeight;
+	if (canvas.width !== w * ratio || canvas.height !== h * ratio) {
+		canvas.width = w * ratio;
+		canvas.height = h * ratio;
+	}
+	const ctx = canvas.getContext('2d');
+	ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+	ctx.clearRect(0, 0, w, h);
+	ctx.font = '11px monospace';
+	ctx.fillStyle = '#8a96a3';
+
+	const trades = s.trades;
+	if (trades.length === 0) {
+		ctx.fillText('no trades yet', 10, 20);
+		return;
+	}
+	const prices = trades.map((t) => t.price);
+	if (s.quote.bid) prices.push(s.quote.bid);
+	if (s.quote.ask) prices.push(s.quote.ask);
+	let lo = Math.min(...prices), hi = Math.max(...prices);
+	if (lo === hi) {
+		lo -= 1;
+		hi += 1;
+	}
+	const t0 = new Date(trades[0].time).getTime();
+	const t1 = Math.max(t0 + 1, new Date(trades[trades.length - 1].time).getTime());
+	const pad = 50;
+	const x = (t) => pad + (w - pad - 10) * (new Date(t).getTime() - t0) / (t1 - t0);
+	const y = (p) => 10 + (h - 30) * (hi - p) / (hi - lo);
+
+	ctx.fillText(money(hi), 2, y(hi) + 4);
+	ctx.fillText(money(lo), 2, y(lo) + 4);
+	ctx.fillText(time(trades[0].time), pad, h - 4);
+	ctx.fillText(time(trades[trades.length - 1].time), w - 90, h - 4);
+
+	const level = (price, color) => {
+		if (!price) return;
+		ctx.strokeStyle = color;
+		ctx.setLineDash([4, 4]);
+		ctx.beginPath();
+		ctx.moveTo(pad, y(price));
+		ctx.lineTo(w - 10, y(price));
+		ctx.stroke();
+		ctx.setLineDash([]);
+	};
+	level(s.quote.bid, '#3fb27f');
+	level(s.quote.ask, '#e5534b');
+
+	ctx.strokeStyle = '#d8dde3';
+	ctx.beginPath();
+	trades.forEach((t, n) => n === 0 ? ctx.moveTo(x(t.time), y(t.price)) : ctx.lineTo(x(t.time), y(t.price)));
+	ctx.stroke();
+}
+
+function portfolio() {
+	const p = state.portfolio;
+	const summary = [['cash', money(p.cash)], ['NAV', money(p.nav)], ['realized', money(p.realized)], ['unrealized', money(p.unrealized)]];
+	$('#summary').replaceChildren(...summary.flatMap(([k, v]) => {
+		const dt = document.createElement('dt');
+		const dd = document.createElement('dd');
+		dt.textContent = k;
+		dd.textContent = v;
+		return [dt, dd];
+	}));
+	rows($('#positions tbody'), p.positions || [], (x) => [
+		[x.Venue + ':' + x.Symbol],
+		[x.Quantity, x.Quantity > 0 ? 'buy' : x.Quantity < 0 ? 'sell' : ''],
+		[money(x.AvgCost)],
+		[x.Mark ? money(x.Mark) : '-'],
+		[money(x.Realized)],
+		[money(x.Mark ? x.Quantity * (x.Mark - x.AvgCost) : 0)],
+	]);
+}
+
+function render() {
+	$('#account').textContent = state.account;
+	const err = $('#error');
+	err.hidden = !state.error;
+	err.textContent = state.error || '';
+
+	const s = stocks();
+	if (s) {
+		ladder(s);
+		chart(s);
+		rows($('#orders tbody'), s.orders, (o) => [
+			[o.id], [o.direction, o.direction], [o.orderType], [money(o.price)], [o.totalFilled], [o.qty],
+		]);
+	}
+	rows($('#fills tbody'), state.fills, (f) => [
+		[time(f.time)], [f.venue + ':' + f.symbol], [f.orderId], [f.direction, f.direction], [money(f.price)], [f.qty],
+	]);
+	portfolio();
+}
+
+function connect() {
+	const status = $('#status');
+	const events = new EventSource('events');
+	events.onopen = () => {
+		status.textContent = 'live';
+		status.className = 'status live';
+	};
+	events.onmessage = (e) => {
+		state = JSON.parse(e.data);
+		render();
+	};
+	// EventSource reconnects by itself
+	events.onerror = () => {
+		status.textContent = 'reconnecting';
+		status.className = 'status';
+	};
+}
+
+$('#stock').addEventListener('change', (e) => {
+	selected = e.target.value;
+	if (state) render();
+});
+window.addEventListener('resize', () => {
+	if (state) render();
+});
+connect();
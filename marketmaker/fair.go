@@ -0,0 +1,63 @@
+package marketmaker
+
+import (
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//FairValue derives the fair value of a stock from its last quote and orderbook snapshot; either may be empty.
+//It returns 0 if there is no fair value.
+type FairValue func(q api.Quote, ob api.Orderbook) float64
+
+//Mid values the stock at the midpoint of the quote, or at the last trade if a side is empty.
+func Mid(q api.Quote, ob api.Orderbook) float64 {
+	if q.Bid > 0 && q.Ask > 0 {
+		return float64(q.Bid+q.Ask) / 2
+	}
+	return float64(q.LastPrice)
+}
+
+//Microprice values the stock at the midpoint weighted by the size on the other side of the quote,
+//which leans towards the side that is about to give way. It falls back to Mid.
+func Microprice(q api.Quote, ob api.Orderbook) float64 {
+	if q.Bid > 0 && q.Ask > 0 && q.BidSize+q.AskSize > 0 {
+		return float64(q.Bid*q.AskSize+q.Ask*q.BidSize) / float64(q.BidSize+q.AskSize)
+	}
+	return Mid(q, ob)
+}
+
+//Last values the stock at the last trade.
+func Last(q api.Quote, ob api.Orderbook) float64 {
+	return float64(q.LastPrice)
+}
+
+//Depth returns a FairValue that averages the volume weighted prices of the best n levels of each side of the
+//orderbook. It falls back to Mid while there is no orderbook with both sides.
+func Depth(n int) FairValue {
+	return func(q api.Quote, ob api.Orderbook) float64 {
+		bid, ask := vwap(ob.Bids, n), vwap(ob.Asks, n)
+		if bid == 0 || ask == 0 {
+			return Mid(q, ob)
+		}
+		return (bid + ask) / 2
+	}
+}
+
+//vwap returns the volume weighted price of the best n price levels. The orderbook lists orders, several of them may
+//share a level.
+func vwap(orders []api.MarketRequest, n int) float64 {
+	notional, qty, levels := 0, 0, 0
+	for k, l := range orders {
+		if k == 0 || l.Price != orders[k-1].Price {
+			levels++
+		}
+		if n > 0 && levels > n {
+			break
+		}
+		notional += l.Price * l.Quantity
+		qty += l.Quantity
+	}
+	if qty == 0 {
+		return 0
+	}
+	return float64(notional) / float64(qty)
+}
@@ -0,0 +1,358 @@
+// Package marketmaker quotes both sides of a stock around a fair value and skews the quotes by inventory.
+//
+// A MarketMaker is driven by events like the executors of package algo: feed it quotes, orderbooks, executions and
+// timer ticks from a strategy, or let Run wire it to the streams of a listing.
+package marketmaker
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//Config configures a MarketMaker. Prices are in cents.
+type Config struct {
+	//Fair derives the fair value the quotes are centered on, Mid if nil.
+	Fair FairValue
+	//Spread is the distance between our bid and ask.
+	Spread int
+	//Size is the quantity quoted on each side.
+	Size int
+	//MaxPosition limits the inventory either way: a side is only quoted with the quantity that can be filled
+	//without the position exceeding it. 0 means no limit.
+	MaxPosition int
+	//Skew moves both quotes this many cents per share of inventory against the position, so a long market maker
+	//sells cheaper and buys cheaper until the inventory is back to 0.
+	Skew float64
+	//MinRequote is the price change in cents that makes a side get requoted. Smaller changes keep the working
+	//order and its place in the queue. 0 requotes on every change.
+	MinRequote int
+	//BookInterval is the interval in which Run polls the orderbook for fair values based on it. 0 disables polling.
+	BookInterval time.Duration
+}
+
+//DefaultConfig quotes 100 shares a side 10 cents wide around the midpoint with a position limit of 500 shares,
+//moving the quotes by a cent for every 10 shares of inventory.
+var DefaultConfig = Config{Fair: Mid, Spread: 10, Size: 100, MaxPosition: 500, Skew: 0.1}
+
+//ErrInterval is returned by Run for a tick <= 0.
+var ErrInterval = errors.New("marketmaker: tick must be positive")
+
+//State is a snapshot of a MarketMaker for monitoring.
+type State struct {
+	Fair     float64 //fair value before skew, 0 while there is none
+	Bid      int     //price of the working bid, 0 if none
+	BidSize  int     //open quantity of the working bid
+	Ask      int     //price of the working ask, 0 if none
+	AskSize  int     //open quantity of the working ask
+	Position int     //inventory in shares
+	Cash     int     //cash from our fills
+	Bought   int     //shares bought
+	Sold     int     //shares sold
+	Orders   int     //orders placed
+	Requotes int     //working orders cancelled to be replaced
+	Err      error   //last error placing or cancelling an order
+	Updated  time.Time
+}
+
+//PnL returns the P&L of the fills so far, with the inventory valued at mark.
+func (s State) PnL(mark float64) float64 {
+	return float64(s.Cash) + float64(s.Position)*mark
+}
+
+//side is the working order on one side of the book.
+type side struct {
+	direction api.OrderDirection
+	order     api.Order
+	working   bool
+	replaced  api.Order //last order cancelled to be replaced, quotes may still show it
+}
+
+//MarketMaker quotes a stock through an api.Trader. Its event methods are not safe for concurrent use; call them from
+//one goroutine, as the callbacks of a strategy are. State() is safe to call from anywhere.
+type MarketMaker struct {
+	t     api.Trader
+	c     Config
+	quote api.Quote
+	book  api.Orderbook
+	bid   side
+	ask   side
+	fills map[int]int //fills booked per order ID
+	state State
+
+	mu       sync.Mutex
+	snapshot State
+}
+
+//New returns a MarketMaker quoting the stock of t.
+func New(t api.Trader, c Config) *MarketMaker {
+	if c.Fair == nil {
+		c.Fair = Mid
+	}
+	return &MarketMaker{
+		t:     t,
+		c:     c,
+		bid:   side{direction: api.Buy},
+		ask:   side{direction: api.Sell},
+		fills: map[int]int{},
+	}
+}
+
+//SetPosition sets the inventory the MarketMaker starts from, e.g. from api.Listing.Exposure().
+func (m *MarketMaker) SetPosition(position int) {
+	m.state.Position = position
+	m.publish()
+}
+
+//State returns the current state.
+func (m *MarketMaker) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshot
+}
+
+func (m *MarketMaker) publish() {
+	m.state.Bid, m.state.BidSize = m.bid.quoted()
+	m.state.Ask, m.state.AskSize = m.ask.quoted()
+	m.mu.Lock()
+	m.snapshot = m.state
+	m.mu.Unlock()
+}
+
+func (s *side) quoted() (price, size int) {
+	if !s.working {
+		return 0, 0
+	}
+	return s.order.Price, s.order.Quantity
+}
+
+//ours returns the quantity of our own orders a quote or orderbook may show at price.
+func (s *side) ours(price int) int {
+	size := 0
+	if s.working && s.order.Price == price {
+		size += s.order.Quantity
+	}
+	if s.replaced.Price == price {
+		size += s.replaced.Quantity
+	}
+	return size
+}
+
+//OnQuote requotes after a change of the tape. Our own quotes are taken out of q before it is valued.
+func (m *MarketMaker) OnQuote(ctx context.Context, q api.Quote) {
+	if q.Venue != m.t.Venue() || q.Symbol != m.t.Symbol() {
+		return
+	}
+	m.quote = m.external(q)
+	m.requote(ctx, q.QuoteTime)
+}
+
+//external removes our own quotes from q, so they don't feed back into the fair value. The stream lags behind our
+//orders, so the order a side just replaced counts as ours too. A side only we are quoting keeps the last price
+//somebody else quoted.
+func (m *MarketMaker) external(q api.Quote) api.Quote {
+	if size := m.bid.ours(q.Bid); size > 0 {
+		if q.BidSize <= size {
+			q.Bid, q.BidSize = m.quote.Bid, m.quote.BidSize
+		} else {
+			q.BidSize -= size
+		}
+	}
+	if size := m.ask.ours(q.Ask); size > 0 {
+		if q.AskSize <= size {
+			q.Ask, q.AskSize = m.quote.Ask, m.quote.AskSize
+		} else {
+			q.AskSize -= size
+		}
+	}
+	return q
+}
+
+//without returns the orders of one side of an orderbook without the shares of our own.
+func (s *side) without(orders []api.MarketRequest) []api.MarketRequest {
+	v := make([]api.MarketRequest, 0, len(orders))
+	taken := map[int]int{}
+	for _, o := range orders {
+		if n := min(o.Quantity, s.ours(o.Price)-taken[o.Price]); n > 0 {
+			o.Quantity -= n
+			taken[o.Price] += n
+		}
+		if o.Quantity > 0 {
+			v = append(v, o)
+		}
+	}
+	return v
+}
+
+//OnOrderbook requotes after a new orderbook snapshot. Our own quotes are taken out of ob before it is valued.
+func (m *MarketMaker) OnOrderbook(ctx context.Context, ob api.Orderbook) {
+	if ob.Venue != m.t.Venue() || ob.Symbol != m.t.Symbol() {
+		return
+	}
+	ob.Bids, ob.Asks = m.bid.without(ob.Bids), m.ask.without(ob.Asks)
+	m.book = ob
+	m.requote(ctx, ob.TS)
+}
+
+//OnExecution books a fill of one of our quotes and requotes with the new inventory.
+func (m *MarketMaker) OnExecution(ctx context.Context, e api.Execution) {
+	if m.update(e.Order) {
+		m.requote(ctx, e.FilledAt)
+	}
+}
+
+//OnTimer requotes, which retries sides that failed before.
+func (m *MarketMaker) OnTimer(ctx context.Context, now time.Time) {
+	m.requote(ctx, now)
+}
+
+//update books the new fills of a working order. It returns false for orders that aren't ours.
+func (m *MarketMaker) update(o api.Order) bool {
+	var s *side
+	switch {
+	case m.bid.working && m.bid.order.ID == o.ID:
+		s = &m.bid
+	case m.ask.working && m.ask.order.ID == o.ID:
+		s = &m.ask
+	default:
+		return false
+	}
+	if o.Account != s.order.Account || o.TotalFilled < s.order.TotalFilled {
+		return true
+	}
+
+	for _, f := range o.Fills[min(m.fills[o.ID], len(o.Fills)):] {
+		if o.Direction == api.Buy {
+			m.state.Position += f.Quantity
+			m.state.Bought += f.Quantity
+			m.state.Cash -= f.Price * f.Quantity
+		} else {
+			m.state.Position -= f.Quantity
+			m.state.Sold += f.Quantity
+			m.state.Cash += f.Price * f.Quantity
+		}
+	}
+	m.fills[o.ID] = len(o.Fills)
+	s.order = o
+	if !o.Open {
+		s.working = false
+		delete(m.fills, o.ID)
+	}
+	return true
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+//quotes returns the prices and sizes we want to quote; a size of 0 means the side isn't quoted.
+func (m *MarketMaker) quotes() (fair float64, bid, bidSize, ask, askSize int) {
+	fair = m.c.Fair(m.quote, m.book)
+	if fair <= 0 {
+		return
+	}
+	center := fair - m.c.Skew*float64(m.state.Position)
+	half := float64(m.c.Spread) / 2
+	bid, ask = int(math.Floor(center-half)), int(math.Ceil(center+half))
+	if ask <= bid {
+		ask = bid + 1
+	}
+	//never take liquidity: stay behind the other side of the market
+	if m.quote.Ask > 0 && bid >= m.quote.Ask {
+		bid = m.quote.Ask - 1
+	}
+	if m.quote.Bid > 0 && ask <= m.quote.Bid {
+		ask = m.quote.Bid + 1
+	}
+
+	bidSize, askSize = m.c.Size, m.c.Size
+	if m.c.MaxPosition > 0 {
+		bidSize = min(bidSize, m.c.MaxPosition-m.state.Position)
+		askSize = min(askSize, m.c.MaxPosition+m.state.Position)
+	}
+	if bid <= 0 || bidSize < 0 {
+		bidSize = 0
+	}
+	if askSize < 0 {
+		askSize = 0
+	}
+	return
+}
+
+func (m *MarketMaker) requote(ctx context.Context, now time.Time) {
+	fair, bid, bidSize, ask, askSize := m.quotes()
+	m.state.Fair = fair
+	m.set(ctx, &m.bid, bid, bidSize)
+	m.set(ctx, &m.ask, ask, askSize)
+	m.state.Updated = now
+	m.publish()
+}
+
+//set makes one side quote size at price: the working order is kept if it is close enough, otherwise it is cancelled
+//and replaced. If the cancel fails the side is left alone, so the inventory can't exceed the limits.
+func (m *MarketMaker) set(ctx context.Context, s *side, price, size int) {
+	if s.working {
+		diff := s.order.Price - price
+		if diff < 0 {
+			diff = -diff
+		}
+		if size > 0 && s.order.Quantity <= size && (diff == 0 || diff < m.c.MinRequote) {
+			return
+		}
+		o, err := m.t.CancelOrderCtx(ctx, s.order.ID)
+		if err != nil {
+			m.state.Err = err
+			return
+		}
+		s.replaced = s.order
+		m.update(o)
+		s.working = false
+		delete(m.fills, s.order.ID)
+		m.state.Requotes++
+		//the fills that arrived with the cancel changed the inventory; the next event quotes it
+		if o.TotalFilled > 0 {
+			return
+		}
+	}
+	if size <= 0 {
+		return
+	}
+
+	o, err := m.t.NewOrderCtx(ctx, price, size, s.direction, api.Limit)
+	if err != nil {
+		m.state.Err = err
+		return
+	}
+	m.state.Orders++
+	s.order, s.working = o, true
+	m.fills[o.ID] = 0
+	m.update(o)
+}
+
+//Stop cancels the working quotes.
+func (m *MarketMaker) Stop(ctx context.Context) error {
+	var firstErr error
+	for _, s := range []*side{&m.bid, &m.ask} {
+		if !s.working {
+			continue
+		}
+		o, err := m.t.CancelOrderCtx(ctx, s.order.ID)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		m.update(o)
+		s.working = false
+	}
+	m.publish()
+	return firstErr
+}
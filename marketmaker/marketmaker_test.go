@@ -0,0 +1,175 @@
+package marketmaker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/marketmaker"
+)
+
+//trader books orders without trading them.
+type trader struct {
+	orders  []api.Order
+	cancels int
+}
+
+func (t *trader) Venue() string  { return "TESTEX" }
+func (t *trader) Symbol() string { return "FOOBAR" }
+
+func (t *trader) NewOrderCtx(ctx context.Context, price, quantity int, direction api.OrderDirection, orderType api.OrderType) (api.Order, error) {
+	o := api.Order{Account: "EXB123456", Venue: "TESTEX", Symbol: "FOOBAR", ID: len(t.orders), Price: price, OriginalQuantity: quantity, Quantity: quantity, Direction: direction, OrderType: orderType, Open: true}
+	t.orders = append(t.orders, o)
+	return o, nil
+}
+
+func (t *trader) CancelOrderCtx(ctx context.Context, id int) (api.Order, error) {
+	t.cancels++
+	t.orders[id].Open = false
+	return t.orders[id], nil
+}
+
+func (t *trader) OrderStatusCtx(ctx context.Context, id int) (api.Order, error) {
+	return t.orders[id], nil
+}
+
+//fill fills n shares of order id at its price.
+func (t *trader) fill(id, n int) api.Execution {
+	o := &t.orders[id]
+	o.Quantity -= n
+	o.TotalFilled += n
+	o.Fills = append(o.Fills, api.Fill{Price: o.Price, Quantity: n})
+	o.Open = o.Quantity > 0
+	v := *o
+	v.Fills = append([]api.Fill(nil), o.Fills...)
+	return api.Execution{Order: v, Price: o.Price, Filled: n}
+}
+
+//quote returns a quote of the stock of trader.
+func quote(bid, bidSize, ask, askSize int) api.Quote {
+	return api.Quote{Venue: "TESTEX", Symbol: "FOOBAR", Bid: bid, BidSize: bidSize, Ask: ask, AskSize: askSize}
+}
+
+//quoted checks the quotes of m.
+func quoted(t *testing.T, m *marketmaker.MarketMaker, bid, bidSize, ask, askSize int) {
+	t.Helper()
+	if s := m.State(); s.Bid != bid || s.BidSize != bidSize || s.Ask != ask || s.AskSize != askSize {
+		t.Errorf("quoting %d@%d / %d@%d, want %d@%d / %d@%d", s.BidSize, s.Bid, s.AskSize, s.Ask, bidSize, bid, askSize, ask)
+	}
+}
+
+func TestSkew(t *testing.T) {
+	ctx := context.Background()
+	m := marketmaker.New(&trader{}, marketmaker.Config{Spread: 10, Size: 100, Skew: 0.1})
+	m.OnQuote(ctx, quote(1000, 10, 1100, 10))
+	quoted(t, m, 1045, 100, 1055, 100)
+
+	//long 100 shares, both quotes move down a dollar
+	m.SetPosition(100)
+	m.OnTimer(ctx, time.Now())
+	quoted(t, m, 1035, 100, 1045, 100)
+	m.SetPosition(-100)
+	m.OnTimer(ctx, time.Now())
+	quoted(t, m, 1055, 100, 1065, 100)
+}
+
+func TestMaxPosition(t *testing.T) {
+	ctx := context.Background()
+	c := marketmaker.Config{Spread: 10, Size: 100, MaxPosition: 150}
+	for _, tc := range []struct {
+		position, bidSize, askSize int
+	}{
+		{0, 100, 100},
+		{100, 50, 100},
+		{150, 0, 100},
+		{-120, 100, 30},
+		{-200, 100, 0},
+	} {
+		m := marketmaker.New(&trader{}, c)
+		m.SetPosition(tc.position)
+		m.OnQuote(ctx, quote(1000, 10, 1100, 10))
+		bid, ask := 1045, 1055
+		if tc.bidSize == 0 {
+			bid = 0
+		}
+		if tc.askSize == 0 {
+			ask = 0
+		}
+		quoted(t, m, bid, tc.bidSize, ask, tc.askSize)
+	}
+}
+
+func TestMinRequote(t *testing.T) {
+	ctx := context.Background()
+	tr := &trader{}
+	m := marketmaker.New(tr, marketmaker.Config{Spread: 10, Size: 100, MinRequote: 3})
+	m.OnQuote(ctx, quote(1000, 10, 1100, 10))
+	quoted(t, m, 1045, 100, 1055, 100)
+
+	//2 cents keep the working orders and their place in the queue
+	m.OnQuote(ctx, quote(1004, 10, 1100, 10))
+	quoted(t, m, 1045, 100, 1055, 100)
+	if tr.cancels != 0 || len(tr.orders) != 2 {
+		t.Fatalf("%d cancels, %d orders", tr.cancels, len(tr.orders))
+	}
+
+	//5 cents replace them
+	m.OnQuote(ctx, quote(1010, 10, 1100, 10))
+	quoted(t, m, 1050, 100, 1060, 100)
+	if s := m.State(); tr.cancels != 2 || s.Requotes != 2 || s.Orders != 4 {
+		t.Errorf("%d cancels, %+v", tr.cancels, s)
+	}
+}
+
+func TestOwnQuotes(t *testing.T) {
+	ctx := context.Background()
+	m := marketmaker.New(&trader{}, marketmaker.Config{Fair: marketmaker.Depth(1), Spread: 10, Size: 100, MinRequote: 100})
+	m.OnQuote(ctx, quote(1000, 10, 1100, 10))
+	quoted(t, m, 1045, 100, 1055, 100)
+
+	//30 shares bid by others next to ours, the ask is only ours and keeps the last one of somebody else
+	m.OnQuote(ctx, quote(1045, 130, 1055, 100))
+	if s := m.State(); s.Fair != 1072.5 {
+		t.Errorf("fair from the quote %v", s.Fair)
+	}
+
+	m.OnOrderbook(ctx, api.Orderbook{
+		Venue:  "TESTEX",
+		Symbol: "FOOBAR",
+		Bids:   []api.MarketRequest{{Price: 1045, Quantity: 100, IsBuy: true}, {Price: 1045, Quantity: 20, IsBuy: true}, {Price: 1040, Quantity: 50, IsBuy: true}},
+		Asks:   []api.MarketRequest{{Price: 1055, Quantity: 100, IsBuy: false}, {Price: 1060, Quantity: 60, IsBuy: false}},
+	})
+	if s := m.State(); s.Fair != 1052.5 {
+		t.Errorf("fair from the orderbook %v", s.Fair)
+	}
+}
+
+func TestFills(t *testing.T) {
+	ctx := context.Background()
+	tr := &trader{}
+	m := marketmaker.New(tr, marketmaker.Config{Spread: 10, Size: 100})
+	m.OnQuote(ctx, quote(1000, 10, 1100, 10))
+	quoted(t, m, 1045, 100, 1055, 100)
+
+	e := tr.fill(0, 40)
+	m.OnExecution(ctx, e)
+	m.OnExecution(ctx, e)
+	if s := m.State(); s.Position != 40 || s.Bought != 40 || s.Cash != -41800 || s.BidSize != 60 {
+		t.Errorf("partial fill booked %+v", s)
+	}
+
+	//the last fill closes the bid, a new one is placed
+	m.OnExecution(ctx, tr.fill(0, 60))
+	m.OnExecution(ctx, tr.fill(1, 30))
+	if s := m.State(); s.Position != 70 || s.Bought != 100 || s.Sold != 30 || s.Cash != -104500+31650 || s.Orders != 3 {
+		t.Errorf("fills booked %+v", s)
+	}
+	quoted(t, m, 1045, 100, 1055, 70)
+
+	//executions of other orders are ignored
+	m.OnExecution(ctx, api.Execution{Order: api.Order{ID: 99, Direction: api.Buy, TotalFilled: 10, Fills: []api.Fill{{Price: 1, Quantity: 10}}}})
+	if s := m.State(); s.Position != 70 {
+		t.Errorf("foreign fill booked %+v", s)
+	}
+}
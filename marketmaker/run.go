@@ -0,0 +1,63 @@
+package marketmaker
+
+import (
+	"context"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//Run quotes l with m until ctx is done. It feeds m the current quote, then the quotes and executions of l, polls
+//the orderbook every Config.BookInterval and ticks m every tick. The inventory starts from the exposure of l as the
+//risk gate knows it. The working quotes are cancelled (for at most 5 seconds) before Run returns ctx.Err().
+//A tick <= 0 returns ErrInterval.
+func Run(ctx context.Context, l *api.Listing, m *MarketMaker, tick time.Duration) error {
+	if tick <= 0 {
+		return ErrInterval
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	qs, es := l.QuotesCtx(runCtx), l.ExecutionsCtx(runCtx)
+	quotes, executions := qs.Values, es.Values
+	t := time.NewTicker(tick)
+	defer t.Stop()
+	var book <-chan time.Time
+	if m.c.BookInterval > 0 {
+		bt := time.NewTicker(m.c.BookInterval)
+		defer bt.Stop()
+		book = bt.C
+	}
+
+	m.SetPosition(l.Exposure().Position)
+	//the stream only sends changes, start from the current quote
+	if q, err := l.QuoteCtx(runCtx); err == nil {
+		m.OnQuote(runCtx, q)
+	}
+	for {
+		select {
+		case q, ok := <-quotes:
+			if !ok {
+				quotes = nil
+				continue
+			}
+			m.OnQuote(runCtx, q)
+		case e, ok := <-executions:
+			if !ok {
+				executions = nil
+				continue
+			}
+			m.OnExecution(runCtx, e)
+		case <-book:
+			if ob, err := l.OrderbookCtx(runCtx); err == nil {
+				m.OnOrderbook(runCtx, ob)
+			}
+		case now := <-t.C:
+			m.OnTimer(runCtx, now)
+		case <-ctx.Done():
+			cctx, ccancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer ccancel()
+			m.Stop(cctx)
+			return ctx.Err()
+		}
+	}
+}
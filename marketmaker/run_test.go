@@ -0,0 +1,20 @@
+package marketmaker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/marketmaker"
+)
+
+func TestRunInterval(t *testing.T) {
+	l := api.NewTestInstance().Listing("TESTEX", "FOOBAR")
+	m := marketmaker.New(l, marketmaker.DefaultConfig)
+	for _, tick := range []time.Duration{0, -time.Second} {
+		if err := marketmaker.Run(context.Background(), l, m, tick); err != marketmaker.ErrInterval {
+			t.Error(tick, err)
+		}
+	}
+}
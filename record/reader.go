@@ -0,0 +1,162 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+)
+
+//Reader reads the Records of a recording in the order they were written.
+//
+//A recording whose Recorder died before closing contains a damaged gzip member. Reader skips damaged members and
+//continues with the next intact one, so sessions appended afterwards stay readable.
+type Reader struct {
+	raw     *memberReader
+	closer  io.Closer
+	zr      *gzip.Reader
+	lines   *bufio.Reader //decompressed lines of the current member, nil between members
+	damaged int
+	resync  bool //the member being read may be a false header within the last damaged one, so its damage belongs to it
+}
+
+//memberHeader is the header of every gzip member a Recorder writes.
+var memberHeader = []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 0xff}
+
+//memberReader reads the compressed input and keeps the bytes of the current member, so the Reader can search them for
+//the next member if the current one turns out to be damaged. It is a ByteReader, so gzip doesn't read ahead.
+type memberReader struct {
+	r      *bufio.Reader
+	member []byte
+}
+
+func (m *memberReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.member = append(m.member, p[:n]...)
+	return n, err
+}
+
+func (m *memberReader) ReadByte() (byte, error) {
+	b, err := m.r.ReadByte()
+	if err == nil {
+		m.member = append(m.member, b)
+	}
+	return b, err
+}
+
+//Open opens the recording at path.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewReader(f)
+	r.closer = f
+	return r, nil
+}
+
+//NewReader returns a Reader reading a recording from rd. Close() doesn't close rd.
+func NewReader(rd io.Reader) *Reader {
+	return &Reader{raw: &memberReader{r: bufio.NewReader(rd)}}
+}
+
+//Close closes the file opened by Open.
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+//Damaged returns the number of damaged gzip members skipped so far. Records of a damaged member that were read before
+//the damage was detected have been returned by Next().
+func (r *Reader) Damaged() int {
+	return r.damaged
+}
+
+//Next returns the next Record. It returns io.EOF at the end of the recording.
+func (r *Reader) Next() (Record, error) {
+	for {
+		if r.lines == nil {
+			if err := r.nextMember(); err != nil {
+				return Record{}, err
+			}
+			continue
+		}
+
+		//the Recorder only writes valid lines and finishes members after complete lines, so anything else is damage
+		line, err := r.lines.ReadBytes('\n')
+		if err == nil {
+			var v Record
+			if json.Unmarshal(line, &v) == nil {
+				r.resync = false
+				return v, nil
+			}
+		} else if err == io.EOF && len(line) == 0 {
+			r.lines = nil
+			continue
+		}
+		r.damage()
+	}
+}
+
+//nextMember starts decompressing the next intact gzip member. It returns io.EOF if there is none.
+func (r *Reader) nextMember() error {
+	for {
+		if _, err := r.raw.r.Peek(1); err != nil {
+			return err
+		}
+
+		r.raw.member = r.raw.member[:0]
+		var err error
+		if r.zr == nil {
+			r.zr, err = gzip.NewReader(r.raw)
+		} else {
+			err = r.zr.Reset(r.raw)
+		}
+		if err != nil {
+			r.damage()
+			continue
+		}
+		r.zr.Multistream(false)
+		r.lines = bufio.NewReader(r.zr)
+		return nil
+	}
+}
+
+//damage counts a damaged member and skips to the next gzip header after its start. The decompressor may have read
+//into the following member already, so the search starts over from the bytes of the damaged one. Compressed data can
+//look like a header, so damage found before the next Record is counted as part of the same damaged member unless the
+//header found is a complete Recorder header.
+func (r *Reader) damage() {
+	if !r.resync {
+		r.damaged++
+		r.resync = true
+	}
+	r.lines = nil
+	var rest []byte
+	if len(r.raw.member) > 1 {
+		rest = append(rest, r.raw.member[1:]...)
+	}
+	r.raw.member = r.raw.member[:0]
+	if len(rest) > 0 {
+		r.raw.r = bufio.NewReader(io.MultiReader(bytes.NewReader(rest), r.raw.r))
+	}
+
+	//a gzip header starts with the magic number and the deflate method
+	for {
+		b, err := r.raw.r.Peek(3)
+		if err != nil {
+			r.raw.r.Discard(len(b))
+			return
+		}
+		if b[0] == 0x1f && b[1] == 0x8b && b[2] == 8 {
+			h, _ := r.raw.r.Peek(len(memberHeader))
+			r.resync = !bytes.Equal(h, memberHeader)
+			return
+		}
+		r.raw.r.Discard(1)
+	}
+}
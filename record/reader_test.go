@@ -0,0 +1,71 @@
+package record_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/ianberinger/stockfighter/api"
+	"github.com/ianberinger/stockfighter/record"
+)
+
+//member returns a complete gzip member as written by a Recorder, holding n quotes with bids from bid on.
+func member(t *testing.T, bid, n int) []byte {
+	var buf bytes.Buffer
+	r := record.NewRecorder(&buf)
+	for k := 0; k < n; k++ {
+		if err := r.Quote(api.Quote{Venue: "TESTEX", Symbol: "FOOBAR", Bid: bid + k}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+//truncated returns a member cut off before its first complete record, like one left by a Recorder that died.
+func truncated(t *testing.T, bid int) []byte {
+	return member(t, bid, 100)[:16]
+}
+
+func read(t *testing.T, recording []byte) (bids []int, damaged int) {
+	rd := record.NewReader(bytes.NewReader(recording))
+	for {
+		rec, err := rd.Next()
+		if err == io.EOF {
+			return bids, rd.Damaged()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Quote != nil && rec.Quote.Bid < 1000 {
+			bids = append(bids, rec.Quote.Bid)
+		}
+	}
+}
+
+func TestReaderSkipsDamagedMember(t *testing.T) {
+	recording := bytes.Join([][]byte{member(t, 1, 2), truncated(t, 1000), member(t, 3, 2)}, nil)
+	bids, damaged := read(t, recording)
+	if damaged != 1 || len(bids) != 4 || bids[0] != 1 || bids[3] != 4 {
+		t.Fatal(bids, damaged)
+	}
+}
+
+func TestReaderCountsAdjacentDamagedMembers(t *testing.T) {
+	recording := bytes.Join([][]byte{member(t, 1, 2), truncated(t, 1000), truncated(t, 2000), member(t, 3, 2)}, nil)
+	bids, damaged := read(t, recording)
+	if damaged != 2 || len(bids) != 4 || bids[0] != 1 || bids[3] != 4 {
+		t.Fatal(bids, damaged)
+	}
+}
+
+func TestSnapshotOrderbooksInterval(t *testing.T) {
+	r := record.NewRecorder(io.Discard)
+	defer r.Close()
+	if err := r.SnapshotOrderbooks(context.Background(), 0); err != record.ErrInterval {
+		t.Fatal(err)
+	}
+}
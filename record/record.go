@@ -0,0 +1,71 @@
+// Package record persists market data and order activity to disk for post-mortems and replays.
+//
+// A recording is a gzip compressed file of JSON lines, one Record per line. Files are only ever appended to:
+// every Recorder writes its own gzip member, and a Reader reads all members of a file as one stream.
+package record
+
+import (
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//Kind tells what a Record contains.
+type Kind string
+
+//Record kinds.
+const (
+	KindQuote       Kind = "quote"
+	KindExecution   Kind = "execution"
+	KindOrderbook   Kind = "orderbook"
+	KindOrder       Kind = "order"
+	KindStreamEvent Kind = "stream event"
+)
+
+//Record is a single entry of a recording. Exactly one of the pointer fields is set, according to Kind.
+type Record struct {
+	Seq      uint64        `json:"seq"`      //position within the recording session, starting at 1
+	Session  int64         `json:"session"`  //start of the recording session in unix nanoseconds
+	Received time.Time     `json:"received"` //wall clock time the value was received
+	Mono     time.Duration `json:"mono"`     //time since the session started on the monotonic clock, never decreasing
+	Kind     Kind          `json:"kind"`
+
+	Quote       *api.Quote     `json:"quote,omitempty"`
+	Execution   *api.Execution `json:"execution,omitempty"`
+	Orderbook   *api.Orderbook `json:"orderbook,omitempty"`
+	Order       *OrderAction   `json:"order,omitempty"`
+	StreamEvent *StreamEvent   `json:"streamEvent,omitempty"`
+}
+
+//Order actions.
+const (
+	ActionNew    = "new"    //an order was placed
+	ActionCancel = "cancel" //an order was cancelled
+	ActionUpdate = "update" //an order managed by an OrderManager changed
+)
+
+//OrderAction is something we did with one of our orders, or a change of one.
+type OrderAction struct {
+	Action string    `json:"action"`
+	Order  api.Order `json:"order"`           //the order as returned by the API
+	Ref    int       `json:"ref,omitempty"`   //reference of orders placed through an OrderManager
+	State  string    `json:"state,omitempty"` //state of orders placed through an OrderManager
+	Error  string    `json:"error,omitempty"` //error of the API call
+}
+
+//StreamEvent is an api.StreamEvent in a form that can be stored.
+type StreamEvent struct {
+	Stream   string        `json:"stream"` //"quotes" or "executions"
+	Type     string        `json:"type"`
+	Error    string        `json:"error,omitempty"`
+	Attempt  int           `json:"attempt,omitempty"`
+	Downtime time.Duration `json:"downtime,omitempty"`
+}
+
+func newStreamEvent(stream string, e api.StreamEvent) *StreamEvent {
+	v := &StreamEvent{Stream: stream, Type: e.Type.String(), Attempt: e.Attempt, Downtime: e.Downtime}
+	if e.Err != nil {
+		v.Error = e.Err.Error()
+	}
+	return v
+}
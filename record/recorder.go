@@ -0,0 +1,316 @@
+package record
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//FlushInterval is how often a Recorder writes buffered records out. Records that weren't written out are lost on a crash.
+const FlushInterval = time.Second
+
+//ErrClosed is returned when recording to a closed Recorder.
+var ErrClosed = errors.New("record: recorder closed")
+
+//ErrInterval is returned by SnapshotOrderbooks for an interval <= 0.
+var ErrInterval = errors.New("record: snapshot interval must be positive")
+
+//Recorder appends Records to a recording. It is safe for concurrent use.
+type Recorder struct {
+	w      io.Writer
+	closer io.Closer
+	start  time.Time
+	stop   chan struct{}
+	done   chan struct{}
+
+	mu     sync.Mutex
+	zw     *gzip.Writer
+	enc    *json.Encoder
+	open   bool //a gzip member was started and not finished yet
+	seq    uint64
+	last   time.Duration
+	err    error
+	closed bool
+}
+
+//Create opens the file at path for appending, creating it if necessary, and returns a Recorder writing to it.
+func Create(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(f)
+	r.closer = f
+	return r, nil
+}
+
+//NewRecorder returns a Recorder writing to w. Close() doesn't close w.
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{w: w, start: time.Now(), stop: make(chan struct{}), done: make(chan struct{})}
+	r.zw = gzip.NewWriter(w)
+	r.enc = json.NewEncoder(r.zw)
+	go r.flusher()
+	return r
+}
+
+func (r *Recorder) flusher() {
+	defer close(r.done)
+	t := time.NewTicker(FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			r.Flush()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+//Err returns the first error that occurred while writing. The Recorder drops all records after it.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+//Flush writes all buffered records out. Every flush finishes a gzip member, so everything flushed stays readable even if
+//the process dies later.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.flush()
+}
+
+//flush must be called with r.mu held.
+func (r *Recorder) flush() error {
+	if r.err != nil || !r.open {
+		return r.err
+	}
+	r.open = false
+	if err := r.zw.Close(); err != nil {
+		r.err = err
+	}
+	return r.err
+}
+
+//Close flushes the Recorder and closes the file opened by Create.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrClosed
+	}
+	r.closed = true
+	err := r.flush()
+	r.mu.Unlock()
+
+	close(r.stop)
+	<-r.done
+	if r.closer != nil {
+		if closeErr := r.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+//write adds v to the recording with received as receive time.
+func (r *Recorder) write(received time.Time, v Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	//received carries a monotonic clock reading, but values received concurrently may arrive here out of order.
+	mono := received.Sub(r.start)
+	if mono < r.last {
+		mono = r.last
+	}
+	r.last = mono
+	r.seq++
+	v.Seq, v.Session, v.Received, v.Mono = r.seq, r.start.UnixNano(), received.Round(0), mono
+
+	if !r.open {
+		r.zw.Reset(r.w)
+		r.open = true
+	}
+	if err := r.enc.Encode(v); err != nil {
+		r.err = err
+	}
+	return r.err
+}
+
+//Quote records q.
+func (r *Recorder) Quote(q api.Quote) error {
+	return r.write(time.Now(), Record{Kind: KindQuote, Quote: &q})
+}
+
+//Execution records e.
+func (r *Recorder) Execution(e api.Execution) error {
+	return r.write(time.Now(), Record{Kind: KindExecution, Execution: &e})
+}
+
+//Orderbook records a snapshot of an orderbook.
+func (r *Recorder) Orderbook(o api.Orderbook) error {
+	return r.write(time.Now(), Record{Kind: KindOrderbook, Orderbook: &o})
+}
+
+//Order records an action on one of our orders, e.g. Order(ActionNew, l.NewOrder(...), i.GetErr()).
+//o is what the API call returned and err its error, if any.
+func (r *Recorder) Order(action string, o api.Order, err error) error {
+	v := &OrderAction{Action: action, Order: o}
+	if err != nil {
+		v.Error = err.Error()
+	}
+	return r.write(time.Now(), Record{Kind: KindOrder, Order: v})
+}
+
+//Event records an event of a stream. stream names it, e.g. "quotes" or "executions".
+func (r *Recorder) Event(stream string, e api.StreamEvent) error {
+	return r.write(time.Now(), Record{Kind: KindStreamEvent, StreamEvent: newStreamEvent(stream, e)})
+}
+
+//OrderManager records every update of the orders managed by m as ActionUpdate.
+func (r *Recorder) OrderManager(m *api.OrderManager) {
+	m.OnUpdate(func(u api.OrderUpdate) {
+		v := &OrderAction{Action: ActionUpdate, Order: u.Order.Order, Ref: u.Order.Ref, State: u.Order.State.String()}
+		if u.Order.Err != nil {
+			v.Error = u.Order.Err.Error()
+		}
+		r.write(time.Now(), Record{Kind: KindOrder, Order: v})
+	})
+}
+
+//RecordQuotes records every Quote and StreamEvent of s until s is closed. It blocks, run it in its own goroutine.
+func (r *Recorder) RecordQuotes(s *api.QuoteStream) {
+	r.teeQuotes(s, nil, nil)
+}
+
+//TeeQuotes records every Quote and StreamEvent of s and forwards them on the returned chans, which get closed along with s.
+//Quotes are forwarded in order and wait for the reader; events get dropped when nobody reads them, like on s.Events.
+func (r *Recorder) TeeQuotes(s *api.QuoteStream) (<-chan api.Quote, <-chan api.StreamEvent) {
+	values, events := make(chan api.Quote, cap(s.Values)), make(chan api.StreamEvent, cap(s.Events))
+	go r.teeQuotes(s, values, events)
+	return values, events
+}
+
+func (r *Recorder) teeQuotes(s *api.QuoteStream, values chan<- api.Quote, events chan<- api.StreamEvent) {
+	if values != nil {
+		defer close(values)
+		defer close(events)
+	}
+	in, inEvents := s.Values, s.Events
+	for in != nil || inEvents != nil {
+		select {
+		case q, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			r.Quote(q)
+			if values != nil {
+				values <- q
+			}
+		case e, ok := <-inEvents:
+			if !ok {
+				inEvents = nil
+				continue
+			}
+			r.Event("quotes", e)
+			forwardEvent(events, e)
+		}
+	}
+}
+
+//RecordExecutions records every Execution and StreamEvent of s until s is closed. It blocks, run it in its own goroutine.
+func (r *Recorder) RecordExecutions(s *api.ExecutionStream) {
+	r.teeExecutions(s, nil, nil)
+}
+
+//TeeExecutions records every Execution and StreamEvent of s and forwards them on the returned chans, which get closed
+//along with s. Executions are forwarded in order and wait for the reader; events get dropped when nobody reads them.
+func (r *Recorder) TeeExecutions(s *api.ExecutionStream) (<-chan api.Execution, <-chan api.StreamEvent) {
+	values, events := make(chan api.Execution, cap(s.Values)), make(chan api.StreamEvent, cap(s.Events))
+	go r.teeExecutions(s, values, events)
+	return values, events
+}
+
+func (r *Recorder) teeExecutions(s *api.ExecutionStream, values chan<- api.Execution, events chan<- api.StreamEvent) {
+	if values != nil {
+		defer close(values)
+		defer close(events)
+	}
+	in, inEvents := s.Values, s.Events
+	for in != nil || inEvents != nil {
+		select {
+		case e, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			r.Execution(e)
+			if values != nil {
+				values <- e
+			}
+		case e, ok := <-inEvents:
+			if !ok {
+				inEvents = nil
+				continue
+			}
+			r.Event("executions", e)
+			forwardEvent(events, e)
+		}
+	}
+}
+
+func forwardEvent(events chan<- api.StreamEvent, e api.StreamEvent) {
+	if events == nil {
+		return
+	}
+	select {
+	case events <- e:
+	default:
+	}
+}
+
+//SnapshotOrderbooks records the orderbook of every listing each interval until ctx is done. Failed requests are skipped.
+//It blocks and returns ctx.Err() or the error that stopped the Recorder.
+func (r *Recorder) SnapshotOrderbooks(ctx context.Context, interval time.Duration, listings ...*api.Listing) error {
+	if interval <= 0 {
+		return ErrInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		for _, l := range listings {
+			o, err := l.OrderbookCtx(ctx)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				continue
+			}
+			if err := r.Orderbook(o); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package strategy
+
+import (
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//gauges publish the portfolio of a run in the metrics of the instance (see api.Instance.Metrics). Amounts are in cents.
+type gauges struct {
+	position *api.Gauge
+	cash     *api.Gauge
+	nav      *api.Gauge
+	pnl      *api.Gauge
+}
+
+func newGauges(m *api.Metrics) gauges {
+	return gauges{
+		position: m.Gauge("stockfighter_strategy_position_shares", "Position of the running strategy by stock.", "venue", "symbol"),
+		cash:     m.Gauge("stockfighter_strategy_cash_cents", "Cash of the running strategy."),
+		nav:      m.Gauge("stockfighter_strategy_nav_cents", "Net asset value of the running strategy."),
+		pnl:      m.Gauge("stockfighter_strategy_pnl_cents", "Realized and unrealized P&L of the running strategy.", "kind"),
+	}
+}
+
+func (g gauges) update(p *api.Portfolio) {
+	for _, pos := range p.Positions() {
+		g.position.Set(float64(pos.Quantity), pos.Venue, pos.Symbol)
+	}
+	realized, unrealized := p.PnL()
+	g.cash.Set(float64(p.Cash()))
+	g.nav.Set(p.NAV())
+	g.pnl.Set(realized, "realized")
+	g.pnl.Set(unrealized, "unrealized")
+}
@@ -0,0 +1,166 @@
+package strategy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//Config configures a run.
+type Config struct {
+	//Level is started with the GameMaster before the run and all its stocks are traded. If empty, the current venue
+	//and symbol of the instance are traded.
+	Level string
+	//StopLevel stops the level instance when the run ends.
+	StopLevel bool
+	//Timer is the interval of OnTimer calls, 0 disables them.
+	Timer time.Duration
+	//Watch is the interval in which the level instance gets polled for OnFlash, 0 disables it.
+	//Instances without an instance ID aren't watched.
+	Watch time.Duration
+	//Risk replaces the risk limits of the instance during the run if set.
+	Risk *api.RiskLimits
+	//CancelTimeout bounds OnStop, the cancellation of all open orders and stopping the level at the end of the run.
+	//0 means no limit.
+	CancelTimeout time.Duration
+}
+
+//DefaultConfig ticks every second, watches the level instance every second and gives the cancel-all 5 seconds.
+var DefaultConfig = Config{Timer: time.Second, Watch: time.Second, CancelTimeout: 5 * time.Second}
+
+//Run runs s on i until ctx is done, the strategy calls Stop or the level is done. The position, cash, NAV and P&L of
+//the run are published as gauges in the metrics of the instance.
+//
+//When the run ends, OnStop is called and all open orders of the account are cancelled with the kill switch of the
+//instance, which is released again afterwards unless it was engaged before. Run returns the error passed to Stop,
+//ctx.Err() if ctx is done, the error of OnStart or starting the level, or else the error of cancelling open orders.
+func Run(ctx context.Context, i *api.Instance, s Strategy, c Config) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rc := &Context{ctx: ctx, i: i, portfolio: i.NewPortfolio(), stop: make(chan struct{})}
+	if c.Level != "" {
+		level, err := i.StartLevelCtx(ctx, c.Level)
+		if err != nil {
+			return err
+		}
+		rc.level = level
+		rc.listings = i.LevelListings(level)
+	} else if i.GetVenue() != "" && i.GetSymbol() != "" {
+		rc.listings = []*api.Listing{i.Listing(i.GetVenue(), i.GetSymbol())}
+	}
+	if c.StopLevel && i.GetInstanceID() != 0 {
+		defer func() {
+			sctx, scancel := c.cleanupContext()
+			defer scancel()
+			i.StopLevelCtx(sctx)
+		}()
+	}
+	if c.Risk != nil {
+		prev := i.GetRiskLimits()
+		i.SetRiskLimits(*c.Risk)
+		defer i.SetRiskLimits(prev)
+	}
+
+	//fan the streams of all stocks in, so the loop below delivers everything on one goroutine
+	var wg sync.WaitGroup
+	quotes, executions := make(chan api.Quote), make(chan api.Execution)
+	for _, l := range rc.listings {
+		qs, es := l.QuotesCtx(ctx), l.ExecutionsCtx(ctx)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for q := range qs.Values {
+				select {
+				case quotes <- q:
+				case <-ctx.Done():
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for e := range es.Values {
+				select {
+				case executions <- e:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer cancel()
+
+	var events <-chan api.InstanceEvent
+	if c.Watch > 0 && i.GetInstanceID() != 0 {
+		w := i.WatchInstance(ctx, c.Watch)
+		defer w.Stop()
+		events = w.Events
+	}
+	var tick <-chan time.Time
+	if c.Timer > 0 {
+		t := time.NewTicker(c.Timer)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	g := newGauges(i.Metrics())
+	g.update(rc.portfolio)
+	if err := s.OnStart(rc); err != nil {
+		return finish(rc, s, c, err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return finish(rc, s, c, ctx.Err())
+		case <-rc.stop:
+			return finish(rc, s, c, rc.stopErr())
+		case q := <-quotes:
+			rc.portfolio.Mark(q)
+			g.update(rc.portfolio)
+			s.OnQuote(rc, q)
+		case e := <-executions:
+			rc.portfolio.ApplyExecution(e)
+			g.update(rc.portfolio)
+			s.OnExecution(rc, e)
+		case now := <-tick:
+			s.OnTimer(rc, now)
+		case e, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			s.OnFlash(rc, e)
+			if e.Type == api.InstanceDone {
+				return finish(rc, s, c, nil)
+			}
+		}
+	}
+}
+
+//cleanupContext returns the context for the work done after the run context is done.
+func (c Config) cleanupContext() (context.Context, context.CancelFunc) {
+	if c.CancelTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), c.CancelTimeout)
+}
+
+//finish calls OnStop and cancels all open orders. It returns err, or the error of the cancellation if err is nil.
+func finish(rc *Context, s Strategy, c Config, err error) error {
+	ctx, cancel := c.cleanupContext()
+	defer cancel()
+	rc.ctx = ctx
+	s.OnStop(rc)
+
+	killed := rc.i.Killed()
+	cancelErr := rc.i.KillSwitch(ctx)
+	if !killed {
+		rc.i.ResetKillSwitch()
+	}
+	if err == nil {
+		err = cancelErr
+	}
+	return err
+}
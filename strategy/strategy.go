@@ -0,0 +1,213 @@
+// Package strategy runs event-driven trading strategies against an api.Instance.
+//
+// Run starts the level, opens the quote and execution streams of every stock, delivers their values together with
+// timer ticks and level events to a Strategy on a single goroutine, and cancels all open orders when it is done.
+package strategy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ianberinger/stockfighter/api"
+)
+
+//ErrNoStock is returned when ordering through a Context that has no stock to trade.
+var ErrNoStock = errors.New("strategy: no stock to trade")
+
+//Strategy gets the events of a run. All callbacks are called on the same goroutine, one at a time, so a strategy
+//needs no locking for its own state. Callbacks should return quickly, events queue up while one runs.
+type Strategy interface {
+	//OnStart is called once the streams are open, before any other callback. An error aborts the run.
+	OnStart(c *Context) error
+	//OnQuote is called for every quote of a traded stock, after it marked the portfolio.
+	OnQuote(c *Context, q api.Quote)
+	//OnExecution is called for every fill of our orders, after it was booked in the portfolio.
+	OnExecution(c *Context, e api.Execution)
+	//OnTimer is called every Config.Timer.
+	OnTimer(c *Context, now time.Time)
+	//OnFlash is called for every event of the level instance: flash messages, new trading days and the end of the level.
+	OnFlash(c *Context, e api.InstanceEvent)
+	//OnStop is called once when the run ends, before the open orders get cancelled.
+	OnStop(c *Context)
+}
+
+//Base implements every callback of Strategy by doing nothing. Embed it to implement only the callbacks you need.
+type Base struct{}
+
+//OnStart implements Strategy.
+func (Base) OnStart(c *Context) error { return nil }
+
+//OnQuote implements Strategy.
+func (Base) OnQuote(c *Context, q api.Quote) {}
+
+//OnExecution implements Strategy.
+func (Base) OnExecution(c *Context, e api.Execution) {}
+
+//OnTimer implements Strategy.
+func (Base) OnTimer(c *Context, now time.Time) {}
+
+//OnFlash implements Strategy.
+func (Base) OnFlash(c *Context, e api.InstanceEvent) {}
+
+//OnStop implements Strategy.
+func (Base) OnStop(c *Context) {}
+
+//Context is passed to the callbacks of a Strategy. It implements api.Trader for the first stock of the run; use
+//Trader() or Listing() for the others. Orders of a Run go through the instance, so they pass its risk gate.
+type Context struct {
+	ctx       context.Context
+	i         *api.Instance
+	level     api.LevelState
+	listings  []*api.Listing
+	traders   func() []api.Trader //set instead of i and listings by NewContext
+	portfolio *api.Portfolio
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	mu       sync.Mutex
+	err      error
+}
+
+//NewContext returns a Context for driving a Strategy without Run, e.g. in a backtest. traders returns the stocks
+//of the run, the first one being the stock the Context trades itself; it is called on every lookup, so the stocks may
+//change during the run. Instance and Listing return nil for such a Context.
+func NewContext(ctx context.Context, p *api.Portfolio, traders func() []api.Trader) *Context {
+	return &Context{ctx: ctx, traders: traders, portfolio: p, stop: make(chan struct{})}
+}
+
+//Context returns the context of the run. It is done once the run is stopping; during OnStop it is a fresh context
+//bounded by Config.CancelTimeout.
+func (c *Context) Context() context.Context {
+	return c.ctx
+}
+
+//Instance returns the instance the strategy runs on, nil if the Context was made by NewContext.
+func (c *Context) Instance() *api.Instance {
+	return c.i
+}
+
+//Level returns the state of the level started by Run, empty if Config.Level wasn't set.
+func (c *Context) Level() api.LevelState {
+	return c.level
+}
+
+//Listings returns the stocks of the run: every stock of the level, or the current stock of the instance.
+func (c *Context) Listings() []*api.Listing {
+	return append([]*api.Listing(nil), c.listings...)
+}
+
+//Listing returns the listing of a traded stock, nil if symbol isn't traded in this run.
+func (c *Context) Listing(symbol string) *api.Listing {
+	for _, l := range c.listings {
+		if l.Symbol() == symbol {
+			return l
+		}
+	}
+	return nil
+}
+
+//Traders returns the stocks of the run. They are the listings of a Run.
+func (c *Context) Traders() []api.Trader {
+	if c.traders != nil {
+		return c.traders()
+	}
+	traders := make([]api.Trader, len(c.listings))
+	for k, l := range c.listings {
+		traders[k] = l
+	}
+	return traders
+}
+
+//Trader returns a traded stock, nil if symbol isn't traded in this run.
+func (c *Context) Trader(symbol string) api.Trader {
+	for _, t := range c.Traders() {
+		if t.Symbol() == symbol {
+			return t
+		}
+	}
+	return nil
+}
+
+//Portfolio returns the portfolio of the run. It books every execution and marks every quote of the traded stocks.
+func (c *Context) Portfolio() *api.Portfolio {
+	return c.portfolio
+}
+
+//Stop ends the run after the current callback; Run returns err. It is safe to call from any goroutine.
+func (c *Context) Stop(err error) {
+	c.stopOnce.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		close(c.stop)
+	})
+}
+
+func (c *Context) stopErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+//Stopped reports whether Stop was called and with which error. It is meant for code driving a Context made by NewContext.
+func (c *Context) Stopped() (bool, error) {
+	select {
+	case <-c.stop:
+		return true, c.stopErr()
+	default:
+		return false, nil
+	}
+}
+
+func (c *Context) primary() (api.Trader, error) {
+	traders := c.Traders()
+	if len(traders) == 0 {
+		return nil, ErrNoStock
+	}
+	return traders[0], nil
+}
+
+//Venue implements api.Trader. It returns the venue of the first stock.
+func (c *Context) Venue() string {
+	if l, err := c.primary(); err == nil {
+		return l.Venue()
+	}
+	return ""
+}
+
+//Symbol implements api.Trader. It returns the symbol of the first stock.
+func (c *Context) Symbol() string {
+	if l, err := c.primary(); err == nil {
+		return l.Symbol()
+	}
+	return ""
+}
+
+//NewOrderCtx implements api.Trader. It places an order in the first stock.
+func (c *Context) NewOrderCtx(ctx context.Context, price int, quantity int, direction api.OrderDirection, orderType api.OrderType) (api.Order, error) {
+	l, err := c.primary()
+	if err != nil {
+		return api.Order{}, err
+	}
+	return l.NewOrderCtx(ctx, price, quantity, direction, orderType)
+}
+
+//CancelOrderCtx implements api.Trader. It cancels an order in the first stock.
+func (c *Context) CancelOrderCtx(ctx context.Context, ID int) (api.Order, error) {
+	l, err := c.primary()
+	if err != nil {
+		return api.Order{}, err
+	}
+	return l.CancelOrderCtx(ctx, ID)
+}
+
+//OrderStatusCtx implements api.Trader. It returns the status of an order in the first stock.
+func (c *Context) OrderStatusCtx(ctx context.Context, ID int) (api.Order, error) {
+	l, err := c.primary()
+	if err != nil {
+		return api.Order{}, err
+	}
+	return l.OrderStatusCtx(ctx, ID)
+}